@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+type Arena struct {
+	models [2]string
+	wins   [2]int
+	ties   int
+	bad    int
+}
+
+func (arena *Arena) scoreboard() string {
+	return fmt.Sprintf("Scoreboard: %v %v, %v %v, ties %v, both bad %v", arena.models[0], arena.wins[0], arena.models[1], arena.wins[1], arena.ties, arena.bad)
+}
+
+func (app *App) readArenaVote() (string, error) {
+	for {
+		answer, err := app.readUserInput("Which answer is better? Enter A, B, tie, bad, or nothing to skip: ")
+		if err != nil {
+			return "", err
+		}
+		switch vote := strings.ToLower(answer); vote {
+		case "", "a", "b", "tie", "bad":
+			return vote, nil
+		}
+		app.printer.PrintWarning("enter A, B, tie or bad\n")
+	}
+}
+
+func (app *App) arenaRound(prompt string) error {
+	arena := app.arena
+	order := []int{0, 1}
+	if rand.IntN(2) == 1 {
+		order = []int{1, 0}
+	}
+	question := session.NewMessage("user", prompt)
+	messages := app.withRetrievedChunks(append(slices.Clone(app.context), question), []Message{question})
+	if !app.quiet {
+		app.printer.Print("%v\n", theme.Dim.Sprint("Waiting for both models..."))
+	}
+	candidates := app.generateFromModels([]string{arena.models[order[0]], arena.models[order[1]]}, messages)
+	candidates[0].label = "A"
+	candidates[1].label = "B"
+	width, _, ok := terminalSize()
+	if !ok || app.wrapDisabled {
+		width = 0
+	}
+	app.printPaged(formatCandidates(candidates, width))
+	if app.reader == nil {
+		return nil
+	}
+	vote, err := app.readArenaVote()
+	if err != nil || vote == "" {
+		return err
+	}
+	kept := -1
+	switch vote {
+	case "a", "b":
+		kept = int(vote[0] - 'a')
+		arena.wins[order[kept]]++
+	case "tie":
+		kept = 0
+		arena.ties++
+	case "bad":
+		arena.bad++
+	}
+	app.printer.Print("A was %v, B was %v.\n%v\n", theme.Model.Sprint(arena.models[order[0]]), theme.Model.Sprint(arena.models[order[1]]), arena.scoreboard())
+	if kept >= 0 && candidates[kept].err == nil && !app.forgetful {
+		app.appendToContext(question, candidates[kept].answer)
+	}
+	return nil
+}
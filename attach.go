@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const largeAttachmentSize = 100 * 1024
+
+var fileReferencePattern = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+var fenceLanguages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".rs":    "rust",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "cpp",
+	".cc":    "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".rb":    "ruby",
+	".php":   "php",
+	".lua":   "lua",
+	".sh":    "sh",
+	".bash":  "bash",
+	".zsh":   "zsh",
+	".ps1":   "powershell",
+	".sql":   "sql",
+	".html":  "html",
+	".css":   "css",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".xml":   "xml",
+	".md":    "markdown",
+	".hs":    "haskell",
+}
+
+func fenceLanguage(path string) string {
+	switch strings.ToLower(filepath.Base(path)) {
+	case "makefile":
+		return "makefile"
+	case "dockerfile":
+		return "dockerfile"
+	}
+	return fenceLanguages[strings.ToLower(filepath.Ext(path))]
+}
+
+func codeFence(content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence
+}
+
+func fencedFile(name string, content string) string {
+	fence := codeFence(content)
+	return fmt.Sprintf("%v:\n%v%v\n%v\n%v", name, fence, fenceLanguage(name), strings.TrimRight(content, "\r\n"), fence)
+}
+
+func (app *App) confirm(question string) bool {
+	answer, err := app.readUserInput(question + " [y/N] ")
+	return err == nil && (strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes"))
+}
+
+func (app *App) checkAttachmentSize(path string, size int64) error {
+	if size > largeAttachmentSize && !app.confirm(fmt.Sprintf("%v is %v KiB large. Include it anyway?", path, size/1024)) {
+		return fmt.Errorf("%v is too large (%v KiB)", path, size/1024)
+	}
+	return nil
+}
+
+func (app *App) readAttachment(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%v is not a regular file", path)
+	}
+	if extract, ok := documentExtractors[strings.ToLower(filepath.Ext(path))]; ok {
+		text, err := extract(path)
+		if err != nil {
+			return "", err
+		}
+		return text, app.checkAttachmentSize(path, int64(len(text)))
+	}
+	err = app.checkAttachmentSize(path, info.Size())
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("%v is a binary file", path)
+	}
+	return string(data), nil
+}
+
+func referencedFile(reference string) (string, bool) {
+	for _, path := range []string{reference, strings.TrimRight(reference, ".,;:!?)\"'")} {
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().IsRegular() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func (app *App) expandFileReferences(text string) (string, error) {
+	var result strings.Builder
+	last := 0
+	for _, match := range fileReferencePattern.FindAllStringSubmatchIndex(text, -1) {
+		path, ok := referencedFile(text[match[4]:match[5]])
+		if !ok {
+			continue
+		}
+		content, err := app.readAttachment(path)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(text[last:match[3]])
+		result.WriteString("\n" + fencedFile(path, content) + "\n")
+		last = match[4] + len(path)
+	}
+	result.WriteString(text[last:])
+	return result.String(), nil
+}
+
+func (app *App) attachFiles(pattern string, role string, combined bool) (int, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pattern '%v': %w", pattern, err)
+	}
+	var blocks []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		content, err := app.readAttachment(path)
+		if err != nil {
+			return 0, err
+		}
+		blocks = append(blocks, fencedFile(path, content))
+	}
+	if len(blocks) == 0 {
+		return 0, fmt.Errorf("no files match '%v'", pattern)
+	}
+	if combined {
+		app.appendToContext(session.NewMessage(role, strings.Join(blocks, "\n\n")))
+		return len(blocks), nil
+	}
+	messages := make([]Message, len(blocks))
+	for i, block := range blocks {
+		messages[i] = session.NewMessage(role, block)
+	}
+	app.appendToContext(messages...)
+	return len(blocks), nil
+}
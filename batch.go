@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/providers"
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+type BatchPrompt struct {
+	ID      string    `json:"id,omitempty"`
+	Prompt  string    `json:"prompt"`
+	Context []Message `json:"context,omitempty"`
+}
+
+type BatchResult struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Prompt   string `json:"prompt"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+	status   int
+}
+
+type batchJob struct {
+	index  int
+	prompt BatchPrompt
+	err    error
+}
+
+func runBatch(args []string) int {
+	app := App{printer: &ConsoleUserPrinter{}, capi: providers.NewOpenAI()}
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gptrepl batch [flags]\n\nRuns every prompt in a JSONL file through the model. Each line must be an object such as\n{\"id\": \"q1\", \"prompt\": \"...\", \"context\": [...]}, where \"id\" and \"context\" are optional.\nOne JSON result is written per prompt, in the same order as the input.\n\n")
+		flags.PrintDefaults()
+	}
+	var baseContext []Message
+	addJsonCtx := func(path string) error {
+		messages, err := parseContextFile(path)
+		if err != nil {
+			return err
+		}
+		baseContext = append(baseContext, messages...)
+		return nil
+	}
+	inPath := flags.String("in", "-", "The JSONL file containing the prompts. Use \"-\" to read from stdin.")
+	outPath := flags.String("out", "-", "The JSONL file where results are written. Use \"-\" to write to stdout.")
+	flags.StringVar(&app.provider, "provider", "auto", providerFlagUsage)
+	model := flags.String("model", "", modelFlagUsage)
+	apiKey := flags.String("apikey", "", apiKeyFlagUsage)
+	concurrency := flags.Uint("concurrency", 4, "The maximum amount of requests sent at the same time.")
+	flags.UintVar(&app.maxRetries, "maxretries", 5, "The maximum amount of attempts at retrying each request. If set to zero, no retries will be made.")
+	flags.Func("ctx", "Load and append a JSON context file, which is sent before the context of every prompt. Can be used multiple times.", addJsonCtx)
+	remote := flags.Bool("remote", false, "Submit the prompts to the OpenAI Batch API instead of sending them one by one. Batches are cheaper, but may take up to 24 hours to complete. -concurrency and -maxretries are ignored.")
+	remoteID := flags.String("remote-id", "", "Resume waiting for a batch previously submitted with -remote, given its ID. The same -in file must be used.")
+	pollInterval := flags.Duration("poll", 30*time.Second, "How often to check the status of a batch submitted with -remote.")
+	flags.StringVar(&app.otelEndpoint, "otel-endpoint", "", "Send a trace of every request to the model to the given OpenTelemetry collector, using OTLP over HTTP, e.g. http://localhost:4318.")
+	flags.StringVar(&app.traceDestination, "trace", "", "Record every request to the model as a line of JSON appended to the given file, or send it to the given http:// or https:// URL.")
+	flags.StringVar(&app.traceTags, "trace-tags", "", "Tags added to every record of -trace, as key=value pairs separated by commas.")
+	configPath := flags.String("config", "", fmt.Sprintf("Path to a JSON configuration file (defaults to %v), whose \"redaction\" section is applied to the prompts.", defaultConfigPath()))
+	flags.BoolVar(&app.cacheEnabled, "cache", false, cacheFlagUsage+" Ignored with -remote.")
+	flags.BoolVar(&app.redactionDisabled, "noredact", false, "Don't mask text that looks like a secret in the prompts and contexts sent to the model.")
+	flags.Parse(args)
+
+	app.SetModel(*model)
+	app.SetApiKey(*apiKey)
+	err := app.selectProvider()
+	if errors.Is(err, ErrNoProvider) {
+		printApiKeyHelpMessage(app.printer)
+		return exitAuth
+	}
+	if err != nil {
+		app.printer.PrintError("%v\n", err)
+		return 1
+	}
+	if *concurrency == 0 {
+		app.printer.PrintError("-concurrency must be at least 1\n")
+		return 1
+	}
+	mustExist := *configPath != ""
+	if !mustExist {
+		*configPath = defaultConfigPath()
+	}
+	app.config, err = loadConfig(*configPath, mustExist)
+	if err != nil {
+		app.printer.PrintError("failed to load configuration file: %v\n", err)
+		return 1
+	}
+
+	provider := app.capi
+	isRemote := *remote || *remoteID != ""
+	if !isRemote && (app.otelEndpoint != "" || app.traceDestination != "") {
+		if err := app.startTelemetry(); err != nil {
+			app.printer.PrintError("%v\n", err)
+			return 1
+		}
+		defer app.telemetry.shutdown()
+	}
+	if !isRemote && app.cacheEnabled {
+		if err := app.startCaching(); err != nil {
+			app.printer.PrintError("%v\n", err)
+			return 1
+		}
+	}
+	if !app.redactionDisabled {
+		if err := app.startRedacting(); err != nil {
+			app.printer.PrintError("%v\n", err)
+			return 1
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if *inPath != "-" {
+		file, err := os.Open(*inPath)
+		if err != nil {
+			app.printer.PrintError("%v\n", err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			app.printer.PrintError("%v\n", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	var total, failed int
+	status := exitFailure
+	if isRemote {
+		if app.provider != "openai" {
+			app.printer.PrintError("-remote is only supported by the openai provider\n")
+			return 1
+		}
+		rb := RemoteBatch{
+			client:       provider.(*providers.OpenAI).Client(),
+			model:        app.model,
+			pollInterval: *pollInterval,
+			printer:      app.printer,
+			showProgress: *outPath != "-",
+		}
+		rb.redactor, _ = app.capi.(*RedactingCompletionAPI)
+		total, failed, err = rb.run(baseContext, in, out, *remoteID)
+	} else {
+		total, failed, status, err = runBatchPrompts(app.capi, baseContext, in, out, int(*concurrency), app.maxRetries)
+	}
+	if err != nil {
+		app.printer.PrintError("%v\n", err)
+		return 1
+	}
+	if failed > 0 {
+		app.printer.PrintError("%v of %v prompts failed\n", failed, total)
+		return status
+	}
+	return 0
+}
+
+func runBatchPrompts(capi CompletionAPI, baseContext []Message, in io.Reader, out io.Writer, concurrency int, maxRetries uint) (int, int, int, error) {
+	jobs := make(chan batchJob)
+	results := make(chan BatchResult)
+	var workers sync.WaitGroup
+	for range concurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				results <- runBatchJob(capi, baseContext, job, maxRetries)
+			}
+		}()
+	}
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		index := 0
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			job := batchJob{index: index}
+			job.err = json.Unmarshal([]byte(line), &job.prompt)
+			jobs <- job
+			index++
+		}
+		readErr = scanner.Err()
+	}()
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	encoder := json.NewEncoder(out)
+	pending := make(map[int]BatchResult)
+	next, failed, status := 0, 0, 0
+	var writeErr error
+	for result := range results {
+		pending[result.Index] = result
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if ready.Error != "" {
+				failed++
+				if status == 0 {
+					status = ready.status
+				} else if status != ready.status {
+					status = exitFailure
+				}
+			}
+			if writeErr == nil {
+				writeErr = encoder.Encode(ready)
+			}
+			next++
+		}
+	}
+	if readErr != nil {
+		return next, failed, exitFailure, fmt.Errorf("failed to read prompts: %v", readErr)
+	}
+	if writeErr != nil {
+		return next, failed, exitFailure, fmt.Errorf("failed to write results: %v", writeErr)
+	}
+	return next, failed, status, nil
+}
+
+func runBatchJob(capi CompletionAPI, baseContext []Message, job batchJob, maxRetries uint) BatchResult {
+	result := BatchResult{Index: job.index, ID: job.prompt.ID, Prompt: job.prompt.Prompt}
+	messages, err := batchJobMessages(baseContext, job)
+	if err != nil {
+		result.Error = err.Error()
+		result.status = exitFailure
+		return result
+	}
+	stream, err := sendWithRetries(capi, messages, maxRetries, nil)
+	if providerErr, ok := providers.NewProviderError(err); ok {
+		result.Error = providerErr.Error()
+		result.status = exitStatus(err)
+		return result
+	} else if err != nil {
+		result.Error = fmt.Sprintf("failed to send context: %v", err)
+		result.status = exitStatus(err)
+		return result
+	}
+	response, err := session.Collect(stream, func(string) {})
+	if providerErr, ok := providers.NewProviderError(err); ok {
+		result.Error = providerErr.Error()
+		result.status = exitStream
+		return result
+	} else if err != nil {
+		result.Error = fmt.Sprintf("stream error: %v", err)
+		result.status = exitStream
+		return result
+	}
+	result.Response = response
+	return result
+}
+
+func batchJobMessages(baseContext []Message, job batchJob) ([]Message, error) {
+	if job.err != nil {
+		return nil, fmt.Errorf("invalid prompt: %v", job.err)
+	}
+	if strings.TrimSpace(job.prompt.Prompt) == "" {
+		return nil, fmt.Errorf("empty prompt")
+	}
+	for idx, msg := range job.prompt.Context {
+		if !session.IsRoleValid(msg.Role) {
+			return nil, fmt.Errorf("message #%v (starting from zero) of the context has an invalid \"role\" attribute", idx)
+		}
+	}
+	messages := make([]Message, 0, len(baseContext)+len(job.prompt.Context)+1)
+	messages = append(messages, baseContext...)
+	messages = append(messages, job.prompt.Context...)
+	messages = append(messages, Message{Role: "user", Content: job.prompt.Prompt})
+	return messages, nil
+}
+
+func readBatchJobs(in io.Reader) ([]batchJob, error) {
+	var jobs []batchJob
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		job := batchJob{index: len(jobs)}
+		job.err = json.Unmarshal([]byte(line), &job.prompt)
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read prompts: %v", err)
+	}
+	return jobs, nil
+}
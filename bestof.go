@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const maxBestOf = 10
+
+func (app *App) generateInBackground(count int, messages []Message) func() []Candidate {
+	candidates := make([]Candidate, count)
+	if _, concurrent := cloneCompletionAPI(app.capi); !concurrent {
+		return func() []Candidate {
+			for i := range candidates {
+				candidates[i].label = app.model
+				candidates[i].answer, candidates[i].err = generateWith(app.capi, app.model, messages, app.maxRetries)
+			}
+			return candidates
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range candidates {
+		candidates[i].label = app.model
+		capi, _ := cloneCompletionAPI(app.capi)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			candidates[i].answer, candidates[i].err = generateWith(capi, app.model, messages, app.maxRetries)
+		}()
+	}
+	return func() []Candidate {
+		wg.Wait()
+		return candidates
+	}
+}
+
+func (app *App) bestOf(args string) error {
+	countArg, prompt, _ := strings.Cut(args, " ")
+	count, err := strconv.Atoi(countArg)
+	if err != nil || count < 2 || count > maxBestOf {
+		return fmt.Errorf("expected the amount of answers (from 2 to %v), followed by an optional prompt", maxBestOf)
+	}
+	var pending []Message
+	if prompt = strings.TrimSpace(prompt); prompt != "" {
+		pending = append(pending, session.NewMessage("user", prompt))
+	} else if len(app.context) == 0 || app.context[len(app.context)-1].Role != "user" {
+		return fmt.Errorf("expected a prompt, since the last message in the context is not from the user")
+	}
+	messages := app.withRetrievedChunks(append(slices.Clone(app.context), pending...), pending)
+	wait := app.generateInBackground(count-1, messages)
+	if !app.quiet {
+		app.printer.Print("%v\n", theme.Heading.Sprint("[1]"))
+	}
+	first, err := app.generateAnswer(messages)
+	others := wait()
+	app.metrics.requests += len(others)
+	if err != nil {
+		return err
+	}
+	candidates := append([]Candidate{{label: app.model, answer: first}}, others...)
+	for i, candidate := range candidates[1:] {
+		if candidate.err != nil {
+			app.metrics.errors++
+		}
+		app.printer.Print("\n%v\n%v\n", theme.Heading.Sprintf("[%v]", i+2), candidateText(candidate))
+	}
+	chosen, err := app.pickCandidate(candidates, fmt.Sprintf("Enter the number of the answer to keep (1-%v), or nothing to keep the first one: ", count))
+	if err != nil {
+		return err
+	}
+	if chosen < 0 {
+		chosen = 0
+	}
+	if !app.forgetful {
+		app.appendToContext(append(pending, candidates[chosen].answer)...)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var botPlatforms = []string{"slack", "discord"}
+
+var defaultBotCommands = []string{"help", "clear", "print", "pop", "undo", "redo", "regen", "retry", "system", "persona", "model", "stats"}
+
+type BotConfig struct {
+	Slack    SlackBotConfig   `json:"slack"`
+	Discord  DiscordBotConfig `json:"discord"`
+	Commands []string         `json:"commands"`
+}
+
+type SlackBotConfig struct {
+	BotToken string `json:"bot_token"`
+	AppToken string `json:"app_token"`
+}
+
+type DiscordBotConfig struct {
+	Token string `json:"token"`
+}
+
+type Bot struct {
+	app *App
+	mu  sync.Mutex
+}
+
+type BotPrinter struct {
+	output strings.Builder
+}
+
+func (printer *BotPrinter) Print(format string, a ...interface{}) {
+	fmt.Fprintf(&printer.output, format, a...)
+}
+
+func (printer *BotPrinter) PrintWarning(format string, a ...interface{}) {
+	fmt.Fprintf(&printer.output, "Warning: "+format, a...)
+}
+
+func (printer *BotPrinter) PrintError(format string, a ...interface{}) {
+	fmt.Fprintf(&printer.output, "Error: "+format, a...)
+}
+
+var botConversationPattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func botSessionPath(conversation string) (string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bot-"+botConversationPattern.ReplaceAllString(conversation, "_")+".json"), nil
+}
+
+func (app *App) useSessionFile(path string) error {
+	if path == app.autosaveFilePath {
+		return nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			return err
+		}
+		app.Conversation = Conversation{model: app.model, autosaveFilePath: path, created: time.Now()}
+		return nil
+	}
+	return app.loadSession(SessionInfo{path: path})
+}
+
+func (bot *Bot) handle(conversation string, text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	app := bot.app
+	printer := &BotPrinter{}
+	previous := app.printer
+	app.printer = printer
+	defer func() { app.printer = previous }()
+	path, err := botSessionPath(conversation)
+	if err == nil {
+		err = app.useSessionFile(path)
+	}
+	if err != nil {
+		app.reportError(fmt.Errorf("failed to load the conversation: %w", err))
+	} else if command, ok := strings.CutPrefix(text, "!"); ok {
+		app.executeLine("/" + command)
+	} else {
+		if app.router != "" {
+			err = app.askRouted(text)
+		} else {
+			err = app.askQuestion(text)
+		}
+		if err != nil {
+			app.reportError(fmt.Errorf("%w (no changes done to context)", err))
+		}
+	}
+	return strings.TrimSpace(printer.output.String())
+}
+
+func splitBotReply(reply string, limit int) []string {
+	var parts []string
+	for len(reply) > limit {
+		cut := strings.LastIndex(reply[:limit], "\n")
+		if cut <= 0 {
+			cut = limit
+		}
+		parts = append(parts, reply[:cut])
+		reply = strings.TrimLeft(reply[cut:], "\n")
+	}
+	if reply != "" {
+		parts = append(parts, reply)
+	}
+	return parts
+}
+
+func (app *App) runBot() int {
+	if len(app.config.Bot.Commands) > 0 {
+		app.config.Commands.Allow = app.config.Bot.Commands
+	} else if len(app.config.Commands.Allow) == 0 {
+		app.config.Commands.Allow = defaultBotCommands
+	}
+	bot := &Bot{app: app}
+	var err error
+	switch app.botPlatform {
+	case "slack":
+		err = runSlackBot(app.config.Bot.Slack, bot.handle)
+	case "discord":
+		err = runDiscordBot(app.config.Bot.Discord, bot.handle)
+	default:
+		err = fmt.Errorf("invalid value for -platform: '%v'. Use one of: %v", app.botPlatform, strings.Join(botPlatforms, ", "))
+	}
+	if err != nil {
+		app.printer.PrintError("%v\n", err)
+		return 1
+	}
+	return 0
+}
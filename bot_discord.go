@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const discordMessageLimit = 2000
+
+func runDiscordBot(config DiscordBotConfig, handle func(conversation string, text string) string) error {
+	if config.Token == "" {
+		return fmt.Errorf("the discord bot needs bot.discord.token in the configuration file")
+	}
+	client, err := discordgo.New("Bot " + config.Token)
+	if err != nil {
+		return err
+	}
+	client.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentMessageContent
+	client.AddHandler(func(s *discordgo.Session, message *discordgo.MessageCreate) {
+		if message.Author == nil || message.Author.Bot {
+			return
+		}
+		for _, part := range splitBotReply(handle("discord-"+message.ChannelID, message.Content), discordMessageLimit) {
+			if _, err := s.ChannelMessageSend(message.ChannelID, part); err != nil {
+				debugLog.Debug("discord", "error", err.Error())
+			}
+		}
+	})
+	if err := client.Open(); err != nil {
+		return err
+	}
+	defer client.Close()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	return nil
+}
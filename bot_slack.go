@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+const slackMessageLimit = 4000
+
+var slackMentionPattern = regexp.MustCompile(`^\s*<@[A-Z0-9]+>\s*`)
+
+var slackUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+func runSlackBot(config SlackBotConfig, handle func(conversation string, text string) string) error {
+	if config.BotToken == "" || config.AppToken == "" {
+		return fmt.Errorf("the slack bot needs bot.slack.bot_token and bot.slack.app_token in the configuration file")
+	}
+	api := slack.New(config.BotToken, slack.OptionAppLevelToken(config.AppToken))
+	client := socketmode.New(api)
+	go func() {
+		for event := range client.Events {
+			if event.Type != socketmode.EventTypeEventsAPI {
+				continue
+			}
+			client.Ack(*event.Request)
+			payload, ok := event.Data.(slackevents.EventsAPIEvent)
+			if !ok || payload.Type != slackevents.CallbackEvent {
+				continue
+			}
+			message, ok := payload.InnerEvent.Data.(*slackevents.MessageEvent)
+			if !ok || message.BotID != "" || message.SubType != "" {
+				continue
+			}
+			conversation := "slack-" + message.Channel
+			if message.ThreadTimeStamp != "" {
+				conversation += "-" + message.ThreadTimeStamp
+			}
+			text := slackUnescaper.Replace(slackMentionPattern.ReplaceAllString(message.Text, ""))
+			for _, part := range splitBotReply(handle(conversation, text), slackMessageLimit) {
+				_, _, err := api.PostMessage(message.Channel, slack.MsgOptionText(part, false), slack.MsgOptionTS(message.ThreadTimeStamp))
+				if err != nil {
+					debugLog.Debug("slack", "error", err.Error())
+				}
+			}
+		}
+	}()
+	return client.Run()
+}
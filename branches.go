@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const defaultBranch = "main"
+
+var branchNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+func (app *App) currentBranch() string {
+	if app.branch == "" {
+		return defaultBranch
+	}
+	return app.branch
+}
+
+func (app *App) branchDir() string {
+	if app.autosaveFilePath == "" {
+		return ""
+	}
+	return app.autosaveFilePath + ".branches"
+}
+
+func (app *App) branchNames() []string {
+	names := []string{app.currentBranch()}
+	for name := range app.branches {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (app *App) storeBranch(name string, ctx []Message) error {
+	if app.branches == nil {
+		app.branches = make(map[string][]Message)
+	}
+	app.branches[name] = ctx
+	dir := app.branchDir()
+	if dir == "" {
+		return nil
+	}
+	err := os.MkdirAll(dir, 0770)
+	if err != nil {
+		return fmt.Errorf("failed to create branch directory: %v", err)
+	}
+	return writeContextFileWithMetadata(filepath.Join(dir, name+".json"), ctx, ContextMetadata{Model: app.model, Branch: name})
+}
+
+func (app *App) loadBranches() error {
+	dir := app.branchDir()
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name, isJSON := strings.CutSuffix(entry.Name(), ".json")
+		if !isJSON || entry.IsDir() || name == app.currentBranch() || !branchNamePattern.MatchString(name) {
+			continue
+		}
+		ctx, err := parseContextFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if app.branches == nil {
+			app.branches = make(map[string][]Message)
+		}
+		app.branches[name] = ctx
+	}
+	return nil
+}
+
+func (app *App) fork(name string) error {
+	if !branchNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid branch name '%v'. Use only letters, digits, '.', '_' and '-'", name)
+	}
+	if _, exists := app.branches[name]; exists || name == app.currentBranch() {
+		return fmt.Errorf("branch '%v' already exists", name)
+	}
+	err := app.storeBranch(app.currentBranch(), slices.Clone(app.context))
+	if err != nil {
+		return err
+	}
+	app.branch = name
+	delete(app.branches, name)
+	app.tryUpdateAutosaveFile()
+	return nil
+}
+
+func (app *App) switchBranch(name string) error {
+	if name == app.currentBranch() {
+		return fmt.Errorf("already on branch '%v'", name)
+	}
+	ctx, exists := app.branches[name]
+	if !exists {
+		return fmt.Errorf("no branch named '%v'. Use /fork to create it", name)
+	}
+	err := app.storeBranch(app.currentBranch(), slices.Clone(app.context))
+	if err != nil {
+		return err
+	}
+	delete(app.branches, name)
+	app.branch = name
+	app.context = ctx
+	app.undoStack = nil
+	app.redoStack = nil
+	app.tryUpdateAutosaveFile()
+	return nil
+}
+
+func (app *App) mergeBranch(name string) (int, error) {
+	other, exists := app.branches[name]
+	if !exists {
+		return 0, fmt.Errorf("no branch named '%v'", name)
+	}
+	common := 0
+	for common < len(app.context) && common < len(other) && app.context[common].Role == other[common].Role && app.context[common].Content == other[common].Content {
+		common++
+	}
+	if common == len(other) {
+		return 0, nil
+	}
+	app.appendToContext(other[common:]...)
+	return len(other) - common, nil
+}
+
+func (app *App) deleteBranch(name string) error {
+	if name == app.currentBranch() {
+		return fmt.Errorf("can't delete the current branch")
+	}
+	if _, exists := app.branches[name]; !exists {
+		return fmt.Errorf("no branch named '%v'", name)
+	}
+	delete(app.branches, name)
+	if dir := app.branchDir(); dir != "" {
+		err := os.Remove(filepath.Join(dir, name+".json"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
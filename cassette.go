@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+type cassetteMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type CassetteEntry struct {
+	Model    string            `json:"model"`
+	Messages []cassetteMessage `json:"messages"`
+	Deltas   []string          `json:"deltas"`
+	Error    string            `json:"error,omitempty"`
+}
+
+func cassetteMessages(messages []Message) []cassetteMessage {
+	result := make([]cassetteMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = cassetteMessage{Role: msg.Role, Content: msg.Content}
+	}
+	return result
+}
+
+type RecordingCompletionAPI struct {
+	CompletionAPI
+	model string
+	mu    *sync.Mutex
+	file  *os.File
+}
+
+func newRecordingCompletionAPI(capi CompletionAPI, path string) (*RecordingCompletionAPI, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingCompletionAPI{CompletionAPI: capi, mu: &sync.Mutex{}, file: file}, nil
+}
+
+func (r *RecordingCompletionAPI) SetModel(model string) {
+	r.model = model
+	r.CompletionAPI.SetModel(model)
+}
+
+func (r *RecordingCompletionAPI) record(entry CassetteEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file.Write(append(data, '\n'))
+}
+
+func (r *RecordingCompletionAPI) SendContext(messages []Message) (<-chan CompletionDelta, error) {
+	entry := CassetteEntry{Model: r.model, Messages: cassetteMessages(messages), Deltas: []string{}}
+	stream, err := r.CompletionAPI.SendContext(messages)
+	if err != nil {
+		entry.Error = err.Error()
+		r.record(entry)
+		return nil, err
+	}
+	out := make(chan CompletionDelta, 32)
+	go func() {
+		defer close(out)
+		for delta := range stream {
+			if delta.Err != nil {
+				if !errors.Is(delta.Err, io.EOF) {
+					entry.Error = delta.Err.Error()
+				}
+				r.record(entry)
+				out <- delta
+				return
+			}
+			entry.Deltas = append(entry.Deltas, delta.Text)
+			out <- delta
+		}
+		r.record(entry)
+	}()
+	return out, nil
+}
+
+type ReplayCompletionAPI struct {
+	entries []CassetteEntry
+	used    []bool
+	model   string
+	mu      sync.Mutex
+}
+
+func newReplayCompletionAPI(path string) (*ReplayCompletionAPI, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []CassetteEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry CassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%v: no recorded responses", path)
+	}
+	return &ReplayCompletionAPI{entries: entries, used: make([]bool, len(entries))}, nil
+}
+
+func (r *ReplayCompletionAPI) defaultModel() string {
+	return r.entries[0].Model
+}
+
+func (r *ReplayCompletionAPI) find(messages []cassetteMessage) (CassetteEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := -1
+	for i, entry := range r.entries {
+		if entry.Model != r.model || !slices.Equal(entry.Messages, messages) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return entry, true
+		}
+		last = i
+	}
+	if last < 0 {
+		return CassetteEntry{}, false
+	}
+	return r.entries[last], true
+}
+
+func (r *ReplayCompletionAPI) SendContext(messages []Message) (<-chan CompletionDelta, error) {
+	entry, ok := r.find(cassetteMessages(messages))
+	if !ok {
+		return nil, fmt.Errorf("no recorded response for this request to %v", r.model)
+	}
+	if entry.Error != "" && len(entry.Deltas) == 0 {
+		return nil, errors.New(entry.Error)
+	}
+	out := make(chan CompletionDelta, len(entry.Deltas)+1)
+	for _, delta := range entry.Deltas {
+		out <- CompletionDelta{Text: delta}
+	}
+	if entry.Error != "" {
+		out <- CompletionDelta{Err: errors.New(entry.Error)}
+	} else {
+		out <- CompletionDelta{Err: io.EOF}
+	}
+	close(out)
+	return out, nil
+}
+
+func (r *ReplayCompletionAPI) SetModel(model string) {
+	r.model = model
+}
+
+func (r *ReplayCompletionAPI) SetApiKey(string) {
+}
+
+func (r *ReplayCompletionAPI) SetTemperature(float32) {
+}
+
+func (r *ReplayCompletionAPI) ListModels() ([]string, error) {
+	var models []string
+	for _, entry := range r.entries {
+		if !slices.Contains(models, entry.Model) {
+			models = append(models, entry.Model)
+		}
+	}
+	return models, nil
+}
+
+func (app *App) useReplay(path string) error {
+	capi, err := newReplayCompletionAPI(path)
+	if err != nil {
+		return err
+	}
+	app.useProvider("replay", capi, "", capi.defaultModel())
+	return nil
+}
+
+func (app *App) startRecording(path string) error {
+	capi, err := newRecordingCompletionAPI(app.capi, path)
+	if err != nil {
+		return err
+	}
+	app.capi = capi
+	app.SetModel(app.model)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Sa-RSt/gptrepl/session"
+	"github.com/atotto/clipboard"
+)
+
+var readClipboard = clipboard.ReadAll
+
+var writeClipboard = clipboard.WriteAll
+
+func lastMessageWithRole(ctx []Message, role string) (int, error) {
+	for i := len(ctx) - 1; i >= 0; i-- {
+		if ctx[i].Role == role {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("the context has no %v messages", role)
+}
+
+func nthLastMessageWithRole(ctx []Message, role string, n int) (int, error) {
+	found := 0
+	for i := len(ctx) - 1; i >= 0; i-- {
+		if ctx[i].Role != role {
+			continue
+		}
+		found++
+		if found == n {
+			return i, nil
+		}
+	}
+	if found == 0 {
+		return 0, fmt.Errorf("the context has no %v messages", role)
+	}
+	return 0, fmt.Errorf("the context has only %v %v messages", found, role)
+}
+
+func (app *App) pasteFromClipboard() error {
+	text, err := readClipboard()
+	if err != nil {
+		return fmt.Errorf("failed to read the clipboard: %w", err)
+	}
+	if text == "" {
+		return fmt.Errorf("the clipboard is empty")
+	}
+	text, err = app.fitAttachment("the clipboard content", text)
+	if err != nil {
+		return err
+	}
+	app.appendToContext(session.NewMessage("user", text))
+	return nil
+}
+
+func copyToClipboard(text string) error {
+	err := writeClipboard(text)
+	if err != nil {
+		return fmt.Errorf("failed to write to the clipboard: %w", err)
+	}
+	return nil
+}
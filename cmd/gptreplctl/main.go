@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/control"
+)
+
+func main() {
+	socket := flag.String("socket", control.DefaultSocketPath(), "The control socket of the running gptrepl (see its -control-socket flag).")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: gptreplctl [flags] send text...\n\nSends a prompt or a slash command to a running gptrepl started with -control, as if it had been typed in its\ninteractive shell. Use \"-\" as the text to read it from stdin, e.g. to send a selection from an editor.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 || flag.Arg(0) != "send" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	line := strings.Join(flag.Args()[1:], " ")
+	if line == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read from stdin: %v\n", err)
+			os.Exit(1)
+		}
+		line = string(data)
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		fmt.Fprintf(os.Stderr, "nothing to send\n")
+		os.Exit(2)
+	}
+	if err := control.Send(*socket, line); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
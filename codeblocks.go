@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func codeBlocks(content string) []contentBlock {
+	var blocks []contentBlock
+	for _, block := range splitCodeBlocks(content) {
+		if block.code {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func (app *App) selectCodeBlock(spec string) (contentBlock, error) {
+	index, err := lastMessageWithRole(app.context, "assistant")
+	if err != nil {
+		return contentBlock{}, err
+	}
+	blocks := codeBlocks(app.context[index].Content)
+	if len(blocks) == 0 {
+		return contentBlock{}, fmt.Errorf("the last answer has no code blocks")
+	}
+	if spec == "" {
+		if len(blocks) == 1 {
+			return blocks[0], nil
+		}
+		for i, block := range blocks {
+			app.printer.Print("%v. %v\n", i+1, codeBlockSummary(block))
+		}
+		return contentBlock{}, fmt.Errorf("the last answer has %v code blocks. Choose one by its number", len(blocks))
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil {
+		return contentBlock{}, fmt.Errorf("invalid code block number: '%v'", spec)
+	}
+	if n < 0 {
+		n += len(blocks) + 1
+	}
+	if n < 1 || n > len(blocks) {
+		return contentBlock{}, fmt.Errorf("no code block number %v. The last answer has %v code blocks", spec, len(blocks))
+	}
+	return blocks[n-1], nil
+}
+
+func codeBlockSummary(block contentBlock) string {
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(block.text), "\n")
+	if len(firstLine) > 60 {
+		firstLine = firstLine[:57] + "..."
+	}
+	language := block.language
+	if language == "" {
+		language = "text"
+	}
+	return fmt.Sprintf("[%v] %v", language, firstLine)
+}
@@ -4,110 +4,529 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
-	"github.com/fatih/color"
+	"github.com/Sa-RSt/gptrepl/session"
 )
 
 type Command struct {
 	fn          func(*App, string) error
 	description string
 	args        [][]string
+	category    string
 }
 
+const miscCategory = "Miscellaneous"
+
+var commandCategories = []struct {
+	name     string
+	commands []string
+}{
+	{"Context editing", []string{"clear", "print", "last", "append", "prepend", "system", "persona", "var", "delete", "insert", "move", "pop", "escape", "nano", "ns", "send", "regen", "retry", "undo", "redo", "edit", "editlast"}},
+	{"Files", []string{"save", "export", "import", "savemd", "loadmd", "replacefrom", "appendfrom", "prependfrom", "file", "dir", "pdf", "sh", "gitdiff", "paste", "copy", "copycode", "savecode", "runcode", "apply"}},
+	{"Model and settings", []string{"model", "comparemodels", "bestof", "forgetful", "keybindings", "autosave", "transcript", "cache", "debug"}},
+	{"Sessions", []string{"sessions", "load", "rename", "delete-session", "fork", "branch", "switch", "merge", "tab", "remember", "recall", "recall-session"}},
+	{pluginCategory, nil},
+	{miscCategory, []string{"help", "stats", "exit"}},
+}
+
+const maxHelpUsageWidth = 28
+const minHelpDescriptionWidth = 30
+
 var ErrExpectNoArguments = fmt.Errorf("expected no arguments")
 
 func (app *App) registerCommandHandlers() {
 	app.commandHandlers = map[string]Command{
-		"help":        NewCommand(helpCommand, `Shows this help page.`, [][]string{}),
-		"save":        NewCommand(saveCommand, `Saves current conversation context in a JSON file.`, [][]string{{"path"}}),
+		"help": NewCommand(helpCommand, `Shows this help page.`, [][]string{}),
+		"save": NewCommand(saveCommand, `Saves current conversation context in a JSON file. If a range is given (e.g. /save out.json 5:20), only
+		the selected messages are saved. `+rangeSyntaxHelp, [][]string{{"path"}, {"range?"}}),
+		"export": NewCommand(exportCommand, `Exports the conversation context (or a range of it) to a file in another format: Markdown (e.g.
+		/export md chat.md), a standalone HTML page (e.g. /export html chat.html) or a ShareGPT dataset (e.g. /export sharegpt data.json). With --stats, a footer with the amount of turns, estimated tokens and cost, models used and duration is added. With
+		--timestamps, the date of the conversation and the time of each message are included. `+rangeSyntaxHelp, [][]string{{"md", "html", "sharegpt"}, {"path"}, {"range?"}, {"--stats?", "--timestamps?"}}),
+		"import": NewCommand(importCommand, `Replaces the current conversation context with a conversation from a ChatGPT data export (conversations.json)
+		or a ShareGPT dataset. If the file has several conversations, they are listed and the number of the one to import must be given
+		(e.g. /import chatgpt conversations.json 3).`, [][]string{{"chatgpt", "sharegpt"}, {"path"}, {"N?"}}),
+		"savemd": NewCommand(saveMarkdownCommand, `Saves the conversation context (or a range of it) in a plain text file that is easy to edit by hand, in the
+		same format used by /edit: each message starts with a line containing its role in brackets (e.g. [user]), followed by its content.
+		Content lines that would look like a role are escaped with a backslash.`, [][]string{{"path"}, {"range?"}}),
+		"loadmd":      NewCommand(loadMarkdownCommand, `Replaces the current conversation context with the one in a plain text file in the format created by /savemd.`, [][]string{{"path"}}),
 		"replacefrom": NewCommand(replaceFromCommand, `Replaces the current conversation context from JSON file in the same format as created by /save.`, [][]string{{"path"}}),
 		"appendfrom":  NewCommand(appendFromCommand, `Appends the context from the JSON file to the current context.`, [][]string{{"path"}}),
 		"prependfrom": NewCommand(prependFromCommand, `Adds the context from the JSON file to the beggining of the current context.`, [][]string{{"path"}}),
 		"clear":       NewCommand(clearCommand, `Clears the current conversation context.`, [][]string{}),
-		"print":       NewCommand(printCommand, `Prints the current conversation context.`, [][]string{}),
-		"append":      NewCommand(appendCommand, `Appends a message to the current conversation context.`, [][]string{{"user", "assistant", "system"}, {"message"}}),
-		"prepend":     NewCommand(prependCommand, `Adds a message to the beggining of the current conversation context.`, [][]string{{"user", "assistant", "system"}, {"message"}}),
-		"model":       NewCommand(modelCommand, `Switches the current model (e.g. gpt-3.5-turbo), keeping the conversation context.`, [][]string{{"model-name"}}),
+		"print": NewCommand(printCommand, `Prints the current conversation context. With -n, each message is preceded by its number. With --verbose,
+		the time of each message is shown, along with how long answers took to be generated and their estimated token counts. When a range
+		is given (e.g. /print 5..10 or /print last), only the selected messages are printed, and role=ROLE prints only the messages with that
+		role (e.g. /print role=system). When the output doesn't fit in the terminal, it is shown with $PAGER (less -R by default), unless
+		-nopager is given. `+rangeSyntaxHelp, [][]string{{"-n?", "--verbose?"}, {"range?"}, {"role=ROLE?"}}),
+		"append":  NewCommand(appendCommand, `Appends a message to the current conversation context.`, [][]string{{"user", "assistant", "system"}, {"message"}}),
+		"prepend": NewCommand(prependCommand, `Adds a message to the beggining of the current conversation context.`, [][]string{{"user", "assistant", "system"}, {"message"}}),
+		"system": NewCommand(systemCommand, `Sets the system prompt: replaces the first message of the context if it is a system message, or adds a system
+		message to the beginning of the context otherwise. When run with no arguments outside of quiet mode, prints the current system prompt.`, [][]string{{"text?"}}),
+		"persona": NewCommand(personaCommand, `Sets the system prompt (see /system) to the contents of a persona file, i.e. a Markdown file in
+		$XDG_CONFIG_HOME/gptrepl/personas (~/.config/gptrepl/personas by default) named after the persona (e.g. /persona reviewer loads reviewer.md).
+		With --clear, every other system message is removed from the context. /persona list (or no arguments) lists the available personas.`, [][]string{{"persona?"}, {"--clear?"}}),
+		"var": NewCommand(varCommand, `Manages variables that are expanded in questions: /var set NAME VALUE sets one, after which every {{NAME}}
+		in the questions you type is replaced with VALUE. /var unset NAME removes it and /var list (or no arguments) lists them. The built-in
+		variables {{date}}, {{time}}, {{cwd}} and {{clipboard}} are also available.`, [][]string{{"set?", "unset?", "list?"}, {"name?"}, {"value?"}}),
+		"file": NewCommand(fileCommand, `Appends the files matching a glob pattern (e.g. /file src/*.go) to the context, each in its own message
+		starting with the file name followed by its contents in a code block. With --combined, all files go in a single message. The role
+		defaults to "user". Binary files are refused and files larger than 100 KiB are only added after confirmation.`, [][]string{{"pattern"}, {"user?", "assistant?", "system?"}, {"--combined?"}}),
+		"dir": NewCommand(dirCommand, `Appends a digest of a directory (the current one by default) to the context as a user message: a tree of its
+		files followed by the contents of each of them. Files ignored by .gitignore files and the .git directory are skipped, and binary
+		files are only listed. -include and -exclude select the files whose contents are added by glob patterns matched against their names
+		or relative paths (e.g. /dir src -include *.go -exclude *_test.go), and can be given several times. The estimated amount of tokens
+		is shown for confirmation before the digest is added.`, [][]string{{"path?"}, {"-include?"}, {"-exclude?"}}),
+		"sh": NewCommand(shCommand, `Runs a shell command (e.g. /sh go test ./...), shows its output and appends the command, its output (both
+		stdout and stderr) and its exit status to the context as a user message, so that the model can be asked about it.`, [][]string{{"command"}}),
+		"gitdiff": NewCommand(gitDiffCommand, `Appends the output of git diff for the current repository to the context as a user message. With --staged,
+		the staged changes are used instead, and a REF (e.g. /gitdiff main) compares the working tree with it. With --review, the model is also
+		asked to review the changes right away.`, [][]string{{"--staged?"}, {"ref?"}, {"--review?"}}),
+		"paste": NewCommand(pasteCommand, `Appends the content of the system clipboard to the context as a user message.`, [][]string{}),
+		"copy": NewCommand(copyCommand, `Copies the last answer from the model to the system clipboard, or the message with the given number (see
+		/print -n). Negative numbers count from the end.`, [][]string{{"N?"}}),
+		"copycode": NewCommand(copyCodeCommand, `Copies a code block of the last answer from the model to the system clipboard. N selects the code block
+		(negative numbers count from the end). If the answer has several code blocks and N isn't given, they are listed.`, [][]string{{"N?"}}),
+		"savecode": NewCommand(saveCodeCommand, `Writes a code block of the last answer from the model to a file (e.g. /savecode 2 main.go). N selects the
+		code block as in /copycode.`, [][]string{{"N?"}, {"path"}}),
+		"runcode": NewCommand(runCodeCommand, `Shows a code block of the last answer from the model (selected by N as in /copycode) and, after confirmation,
+		runs it with the interpreter for its language (shell, Python, JavaScript, Ruby or PowerShell). Its output and exit status are
+		then appended to the context as a user message.`, [][]string{{"N?"}}),
+		"apply": NewCommand(applyCommand, `Applies the unified diff in the last answer from the model to the files in the current directory, using git
+		apply (which also works outside of git repositories). The diff is shown first and applied after confirmation. With --dry-run, it is
+		only checked whether the diff applies cleanly. With --yes, it is applied without confirmation, which is required outside of
+		the interactive shell.`, [][]string{{"--dry-run?", "--yes?"}}),
+		"pdf": NewCommand(pdfCommand, `Extracts the text of a PDF document and appends it to the context as a user message. Pages can be selected
+		with ranges such as 3, 2-5, 7- or 1-3,8. If the text is very long, its estimated amount of tokens is shown for confirmation first.
+		Word documents (.docx) and PDF documents can also be added with /file.`, [][]string{{"path"}, {"pages?"}}),
+		"remember": NewCommand(rememberCommand, `Stores a text, or the contents of a file if a path is given, in the long-term memory of gptrepl
+		($XDG_DATA_HOME/gptrepl/memory.json). Before each question is sent, the excerpts of the memory most relevant to it are retrieved with
+		OpenAI embeddings and sent along with it (see -rag).`, [][]string{{"text|path"}}),
+		"recall": NewCommand(recallCommand, `Shows the excerpts of the memory (see /remember) and of the documents indexed with -docs that are most
+		relevant to the given text.`, [][]string{{"text"}}),
+		"recall-session": NewCommand(recallSessionCommand, `Searches the saved sessions for the past exchanges (a question and its answers) most relevant to the
+		given text, using OpenAI embeddings that are cached between runs. In the interactive shell, one of the exchanges found can then be
+		added to the context as a system message, or its session can be opened.`, [][]string{{"text"}}),
+		"stats": NewCommand(statsCommand, `Shows metrics of the current run of gptrepl: the amount of requests sent to the model, retries and errors,
+		the estimated prompt and completion tokens, the average time until the first token of answers and the average generation speed.
+		To print a summary of them on exit, use -stats-on-exit.`, [][]string{}),
+		"transcript": NewCommand(transcriptCommand, `Starts or stops appending a plain text record of everything shown on the screen to a file (see -transcript).
+		/transcript on PATH starts writing to PATH, which defaults to the last file used. /transcript off stops it. With no arguments,
+		shows where the transcript is being written.`, [][]string{{"on?", "off?"}, {"path?"}}),
+		"debug": NewCommand(debugCommand, `/debug last shows the last request sent to the model exactly as it was serialized, with the API key redacted,
+		followed by the status and the raw events of its response (up to the last 200), to find out why an answer looks wrong.`, [][]string{{"last"}}),
+		"cache": NewCommand(cacheCommand, `/cache clear removes every answer stored by -cache. With no arguments, shows whether answers are being cached
+		and how many are stored.`, [][]string{{"clear?"}}),
+		"comparemodels": NewCommand(compareModelsCommand, `Sends the context and the prompt to each of the given models at the same time and shows their answers side by side
+		(e.g. /comparemodels gpt-4o claude-3-5-sonnet-latest Explain monads). In the interactive shell, one of the answers can then be kept
+		in the context together with the prompt. Put -- between the models and the prompt if a model isn't recognized.`, [][]string{{"model-name"}, {"model-name"}, {"prompt"}}),
+		"bestof": NewCommand(bestOfCommand, `Generates N answers to the prompt (or to the context, if its last message is from the user), streaming the first
+		one and showing the others numbered after it. In the interactive shell, the answer that is stored in the context can then be chosen.
+		It is the first one otherwise.`, [][]string{{"N"}, {"prompt?"}}),
+		"last": NewCommand(lastCommand, `Prints the last answer from the model as plain text, without colors or streaming, or the Nth answer counting
+		from the end (e.g. /last 2 prints the one before the last). With > path (e.g. /last > answer.md), the answer is written to the file
+		instead.`, [][]string{{"N?"}, {"> path?"}}),
+		"delete": NewCommand(deleteCommand, `Removes the message with the given number (see /print -n) or a range of messages from the context.
+		`+rangeSyntaxHelp, [][]string{{"range"}}),
+		"insert": NewCommand(insertCommand, `Inserts a message at position N of the context, moving the message that was there and the following ones
+		down. N may be one more than the amount of messages, which appends the message.`, [][]string{{"N"}, {"user", "assistant", "system"}, {"message"}}),
+		"move": NewCommand(moveCommand, `Moves the message with number FROM so that it ends up at position TO. Negative numbers count from the end.`, [][]string{{"FROM"}, {"TO"}}),
+		"model": NewCommand(modelCommand, `Switches the current model (e.g. gpt-3.5-turbo), keeping the conversation context. When run
+		with no arguments outside of quiet mode, shows a filterable list of the models available from the provider.`, [][]string{{"model-name?"}}),
 		"pop": NewCommand(popCommand, `Removes the last N messages from the context. N defaults to 2, as to pop the last answer given by the model and
 		the question that led to it.`, [][]string{{"N?"}}),
 		"escape": NewCommand(escapeCommand, `Appends the following text and sends the context to the model, storing its response in the context. Useful for
-		sending empty strings or messages beggining with the slash "/" character.`, [][]string{{"text"}}),
+		sending empty strings or messages beggining with the slash "/" character. In forgetful mode, neither the text nor the response
+		are stored unless --keep is given.`, [][]string{{"--keep?"}, {"text"}}),
 		"nano": NewCommand(nanoCommand, `Opens a nano (by default) text editor instance. You can write a multi-line prompt in it, which will be appended
-		to the context (without sending it) once saved and closed. To use a different text editor, specify its path in the GPTREPL_TEXT_EDITOR environment variable.
+		to the context (without sending it) once saved and closed. To use a different text editor, set the GPTREPL_TEXT_EDITOR, VISUAL or EDITOR environment variable (e.g. "code --wait").
 		See also /ns, which may be more useful for interactive sessions in most cases.`, [][]string{{"user", "assistant", "system"}}),
-		"ns":   NewCommand(nanoSendCommand, `The same as running /nano and then /send. Role is set to "user" by default. Also prints the message when not in quiet mode.`, [][]string{{"user?", "assistant?", "system?"}}),
-		"send": NewCommand(sendCommand, `Sends the current context as-is to the model and stores its response in the context.`, [][]string{}),
+		"ns": NewCommand(nanoSendCommand, `The same as running /nano and then /send. Role is set to "user" by default. Also prints the message when not in quiet mode.
+		In forgetful mode, neither the message nor the response are stored unless --keep is given.`, [][]string{{"--keep?"}, {"user?", "assistant?", "system?"}}),
+		"send": NewCommand(sendCommand, `Sends the current context as-is to the model and stores its response in the context. In forgetful mode, the
+		response is not stored unless --keep is given.`, [][]string{{"--keep?"}}),
+		"regen": NewCommand(regenCommand, `Replaces the last answer from the model with a new one, generated from the same context. A different model
+		(e.g. /regen gpt-4o) and/or temperature (e.g. /regen 1.2) can be given for this answer only.`, [][]string{{"model-name?"}, {"temperature?"}}),
+		"retry": NewCommand(retryCommand, `Sends the last failed request again, including the message that was being sent (e.g. a question), so that
+		it doesn't need to be typed again.`, [][]string{}),
+		"undo": NewCommand(undoCommand, `Reverts the last change to the context, such as a question and its answer, /pop, /clear or /replacefrom.`, [][]string{}),
+		"redo": NewCommand(redoCommand, `Re-applies the last change reverted by /undo.`, [][]string{}),
+		"fork": NewCommand(forkCommand, `Copies the current context into a new branch with the given name and switches to it, so that an alternative
+		continuation can be explored without losing the current one. When autosave is enabled, branches are also stored next to the autosave file.`, [][]string{{"branch-name"}}),
+		"branch": NewCommand(branchCommand, `Lists the branches of the conversation (the default one is "main"), marking the current one.
+		/branch delete NAME removes a branch.`, [][]string{{"list?", "delete?"}, {"branch-name?"}}),
+		"switch": NewCommand(switchCommand, `Switches to another branch created with /fork, keeping the current context in its own branch.`, [][]string{{"branch-name"}}),
+		"merge":  NewCommand(mergeCommand, `Appends the messages of another branch that come after the part it shares with the current context.`, [][]string{{"branch-name"}}),
+		"tab": NewCommand(tabCommand, `Manages independent conversations, each with its own context, model and autosave file. /tab new opens a new tab
+		and switches to it, /tab N switches to tab N, /tab close [N] closes the current tab or tab N and /tab list (or no arguments) lists them.`, [][]string{{"new?", "list?", "close?", "N?"}}),
+		"sessions": NewCommand(sessionsCommand, `Lists the saved sessions, most recently updated first. Unless -nosessions or -autosave is given, every
+		conversation of the interactive shell is saved as a session in $XDG_DATA_HOME/gptrepl/sessions (~/.local/share/gptrepl/sessions by default).`, [][]string{}),
+		"load":           NewCommand(loadCommand, `Loads a saved session by its ID or title, replacing the current conversation. Changes are then saved to that session.`, [][]string{{"session"}}),
+		"rename":         NewCommand(renameCommand, `Sets the title of the current session, shown by /sessions. By default, the first question is used as the title.`, [][]string{{"title"}}),
+		"delete-session": NewCommand(deleteSessionCommand, `Deletes a saved session by its ID or title. The current session can't be deleted.`, [][]string{{"session"}}),
 		"autosave": NewCommand(autosaveCommand, `Changes the autosave file path. Every time the context changes, it is automatically saved to this file. Run
 		with no arguments to disable this feature. WARNING: The file will be overwritten. You may want to load it first with
 		/replacefrom, /appendfrom or /prependfrom.`, [][]string{{"path?"}}),
 		"edit": NewCommand(editCommand, `Opens a nano (by default) text editor instance showing the current conversation context and allowing it to be edited.
-		The context is updated once the editor is closed and the file has been saved. To use a different text editor, specify its path in the GPTREPL_TEXT_EDITOR environment variable.`, [][]string{}),
+		The context is updated once the editor is closed and the file has been saved. If a message number N is given (see /print -n), only that
+		message is opened in the editor and replaced. Negative numbers count from the end. To use a different text editor, set the GPTREPL_TEXT_EDITOR, VISUAL or EDITOR environment variable (e.g. "code --wait").`, [][]string{{"N?"}}),
+		"editlast": NewCommand(editLastCommand, `Opens the text editor pre-filled with the last message in the context, or the last message with the given role,
+		and replaces it with the edited text once the editor is closed.`, [][]string{{"user?", "assistant?", "system?"}}),
 		"forgetful": NewCommand(forgetfulCommand, `Enables/disables forgetful mode. When it is enabled, questions and their respective answers
-		from the model are not addded to the context. Forgetful mode does not affect commands (such as /escape). When not in quiet mode,
+		from the model are not addded to the context. This also applies to /send, /escape and /ns, unless they are run with --keep. When not in quiet mode,
 		running this command with no arguments prints whether forgetful mode is currently enabled.`, [][]string{{"true", "false", "0", "1"}}),
-		"exit": NewCommand(exitCommand, `Exits the program.`, [][]string{{"status-code?"}}),
+		"keybindings": NewCommand(keybindingsCommand, `Switches the line editor between vi-style modal editing and emacs-style keybindings (the default).
+		In vi mode, the prompt shows [N] in normal mode and [I] in insert mode. When not in quiet mode, running this command with no
+		arguments prints the current keybindings.`, [][]string{{"vi?", "emacs?"}}),
+		"exit": NewCommand(exitCommand, `Exits the program. If the -exit-summary flag is set, a short summary of the session is
+		requested from the model and stored in the autosave file first.`, [][]string{{"status-code?"}}),
+	}
+	for _, category := range commandCategories {
+		for _, name := range category.commands {
+			if command, ok := app.commandHandlers[name]; ok {
+				command.category = category.name
+				app.commandHandlers[name] = command
+			}
+		}
 	}
 }
 
 func NewCommand(fn func(*App, string) error, description string, args [][]string) Command {
-	return Command{fn, description, args}
+	return Command{fn: fn, description: description, args: args}
 }
 
 func helpCommand(app *App, args string) error {
 	if args != "" {
 		app.printer.PrintWarning("This command takes no arguments. Showing help anyways\n")
 	}
+	grouped := make(map[string][]string)
+	usages := make(map[string]string)
+	usageWidth := 0
 	for name, command := range app.commandHandlers {
-		app.printer.Print("/%v", color.CyanString(name))
-		for _, choices := range command.args {
-			colored := make([]string, len(choices))
-			for i, choice := range choices {
-				colored[i] = color.MagentaString(choice)
-			}
-			app.printer.Print(" <%v>", strings.Join(colored, "|"))
+		if !app.config.isCommandEnabled(name) {
+			continue
 		}
-		app.printer.Print("\n")
-		for _, line := range textWrap(command.description, 50) {
-			app.printer.Print("  %v\n", line)
+		category := command.category
+		if category == "" {
+			category = miscCategory
+		}
+		grouped[category] = append(grouped[category], name)
+		usage := "/" + theme.Command.Sprint(name)
+		if len(command.args) > 0 {
+			usage += " " + formatCommandArgs(command.args, theme.Argument.SprintFunc())
+		}
+		usages[name] = usage
+		usageWidth = max(usageWidth, utf8.RuneCountInString(ansiEscapePattern.ReplaceAllString(usage, "")))
+	}
+	usageWidth = min(usageWidth, maxHelpUsageWidth)
+	indent := strings.Repeat(" ", usageWidth+2)
+	if helpWidth()-len(indent) < minHelpDescriptionWidth {
+		indent = "  "
+		usageWidth = 0
+	}
+	first := true
+	for _, category := range commandCategories {
+		names := grouped[category.name]
+		if len(names) == 0 {
+			continue
+		}
+		if !first {
+			app.printer.Print("\n")
+		}
+		first = false
+		app.printer.Print("%v\n", theme.Heading.Sprint(category.name))
+		slices.Sort(names)
+		for _, name := range names {
+			lines := textWrap(app.commandHandlers[name].description, helpWidth()-len(indent))
+			usage := usages[name]
+			if usageWidth > 0 && utf8.RuneCountInString(ansiEscapePattern.ReplaceAllString(usage, "")) <= usageWidth && len(lines) > 0 {
+				app.printer.Print("%v  %v\n", padRight(usage, usageWidth), lines[0])
+				lines = lines[1:]
+			} else {
+				app.printer.Print("%v\n", usage)
+			}
+			for _, line := range lines {
+				app.printer.Print("%v%v\n", indent, line)
+			}
 		}
 	}
 	return nil
 }
 
-func saveCommand(app *App, path string) error {
+func saveCommand(app *App, args string) error {
+	path, spec := cutRangeArgument(args)
+	if path == "" {
+		return fmt.Errorf("at least one argument required (path to JSON file, optionally followed by a range)")
+	}
+	ctx, err := app.selectMessages(spec)
+	if err != nil {
+		return err
+	}
+	return writeContextFileWithMetadata(path, ctx, app.contextMetadata())
+}
+
+func exportCommand(app *App, args string) error {
+	format, rest, _ := strings.Cut(args, " ")
+	if !slices.Contains(exportFormats, format) {
+		return fmt.Errorf("expected a format (%v) followed by a path", strings.Join(exportFormats, ", "))
+	}
+	rest, flags := cutExportFlags(strings.TrimSpace(rest))
+	path, spec := cutRangeArgument(rest)
 	if path == "" {
-		return fmt.Errorf("exactly one argument required (path to JSON file)")
+		return fmt.Errorf("expected a path after the format")
 	}
-	return writeContextFile(path, app.context)
+	ctx, err := app.selectMessages(spec)
+	if err != nil {
+		return err
+	}
+	return app.exportContext(format, path, ctx, app.exportOptions(ctx, flags))
+}
+
+func saveMarkdownCommand(app *App, args string) error {
+	path, spec := cutRangeArgument(args)
+	if path == "" {
+		return fmt.Errorf("at least one argument required (path to the file, optionally followed by a range)")
+	}
+	ctx, err := app.selectMessages(spec)
+	if err != nil {
+		return err
+	}
+	return writePlainTextContextFile(path, ctx)
+}
+
+func loadMarkdownCommand(app *App, path string) error {
+	if path == "" {
+		return fmt.Errorf("expected exactly one argument (path to the file)")
+	}
+	ctx, err := parsePlainTextContextFile(path)
+	if err != nil {
+		return err
+	}
+	app.setContext(ctx)
+	return nil
+}
+
+func importCommand(app *App, args string) error {
+	format, rest, _ := strings.Cut(args, " ")
+	if !slices.Contains(importFormats, format) {
+		return fmt.Errorf("expected a format (%v) followed by a path", strings.Join(importFormats, ", "))
+	}
+	path, number := cutConversationNumber(strings.TrimSpace(rest))
+	if path == "" {
+		return fmt.Errorf("expected a path after the format")
+	}
+	return app.importConversation(format, path, number)
 }
 
 func replaceFromCommand(app *App, path string) error {
-	ctx, err := readContextFileFromArguments(path)
+	ctx, err := app.readContextFileFromArguments(path)
 	if err != nil {
 		return err
 	}
-	app.context = ctx
+	app.setContext(ctx)
 	return nil
 }
 
 func appendFromCommand(app *App, path string) error {
-	ctx, err := readContextFileFromArguments(path)
+	ctx, err := app.readContextFileFromArguments(path)
 	if err != nil {
 		return err
 	}
-	app.context = append(app.context, ctx...)
+	app.appendToContext(ctx...)
 	return nil
 }
 
 func prependFromCommand(app *App, path string) error {
-	ctx, err := readContextFileFromArguments(path)
+	ctx, err := app.readContextFileFromArguments(path)
+	if err != nil {
+		return err
+	}
+	app.setContext(append(ctx, app.context...))
+	return nil
+}
+
+func deleteCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a message number or range")
+	}
+	start, end, err := parseMessageRange(args, app.context)
 	if err != nil {
 		return err
 	}
-	ctx = append(ctx, app.context...)
-	app.context = ctx
+	app.deleteMessages(start, end)
+	return nil
+}
+
+func insertCommand(app *App, args string) error {
+	position, rest, _ := strings.Cut(args, " ")
+	n, err := strconv.Atoi(position)
+	if err != nil {
+		return fmt.Errorf("expected a message number, got '%v'", position)
+	}
+	if n < 1 || n > len(app.context)+1 {
+		return fmt.Errorf("position must be between 1 and %v", len(app.context)+1)
+	}
+	role, msg, err := parseSingleMessageFromArguments(strings.TrimSpace(rest))
+	if err != nil {
+		return err
+	}
+	app.insertMessage(n-1, session.NewMessage(role, strings.TrimSpace(msg)))
+	return nil
+}
+
+func moveCommand(app *App, args string) error {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return fmt.Errorf("expected exactly two arguments (FROM and TO)")
+	}
+	from, err := parseMessageIndex(fields[0], app.context)
+	if err != nil {
+		return err
+	}
+	to, err := parseMessageIndex(fields[1], app.context)
+	if err != nil {
+		return err
+	}
+	app.moveMessage(from, to)
+	return nil
+}
+
+func regenCommand(app *App, args string) error {
+	n := len(app.context)
+	if n == 0 || app.context[n-1].Role != "assistant" {
+		return fmt.Errorf("the last message in the context is not an answer from the model")
+	}
+	model := app.model
+	temperature := app.temperature
+	for _, arg := range strings.Fields(args) {
+		value, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			model = arg
+			continue
+		}
+		if value < 0 {
+			return fmt.Errorf("temperature must not be negative")
+		}
+		temperature = float32(value)
+	}
+	previousModel, previousTemperature := app.model, app.temperature
+	app.SetModel(model)
+	app.SetTemperature(temperature)
+	defer func() {
+		app.SetModel(previousModel)
+		app.SetTemperature(previousTemperature)
+	}()
+	answer, err := app.generateAnswer(app.context[:n-1])
+	if err != nil {
+		return err
+	}
+	app.replaceMessage(n-1, answer)
+	return nil
+}
+
+func retryCommand(app *App, args string) error {
+	if args != "" {
+		return ErrExpectNoArguments
+	}
+	if app.failedRequest == nil {
+		return fmt.Errorf("nothing to retry")
+	}
+	return app.sendAndStore(app.failedRequest.pending, app.failedRequest.keep)
+}
+
+func undoCommand(app *App, args string) error {
+	if args != "" {
+		return ErrExpectNoArguments
+	}
+	if !app.undo() {
+		return fmt.Errorf("nothing to undo")
+	}
+	if !app.quiet {
+		app.printer.Print("Undone. The context now has %v messages.\n", len(app.context))
+	}
+	return nil
+}
+
+func redoCommand(app *App, args string) error {
+	if args != "" {
+		return ErrExpectNoArguments
+	}
+	if !app.redo() {
+		return fmt.Errorf("nothing to redo")
+	}
+	if !app.quiet {
+		app.printer.Print("Redone. The context now has %v messages.\n", len(app.context))
+	}
+	return nil
+}
+
+func forkCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a branch name")
+	}
+	err := app.fork(args)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("Switched to new branch '%v'.\n", args)
+	}
+	return nil
+}
+
+func branchCommand(app *App, args string) error {
+	subcommand, name, _ := strings.Cut(args, " ")
+	switch subcommand {
+	case "", "list":
+		if name != "" {
+			return fmt.Errorf("/branch list takes no arguments")
+		}
+		for _, branch := range app.branchNames() {
+			marker, length := " ", len(app.branches[branch])
+			if branch == app.currentBranch() {
+				marker, length = "*", len(app.context)
+			}
+			app.printer.Print("%v %v (%v messages)\n", marker, branch, length)
+		}
+		return nil
+	case "delete":
+		if name == "" {
+			return fmt.Errorf("expected a branch name")
+		}
+		return app.deleteBranch(strings.TrimSpace(name))
+	}
+	return fmt.Errorf("unknown subcommand '%v'. Expected list or delete", subcommand)
+}
+
+func switchCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a branch name")
+	}
+	err := app.switchBranch(args)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("Switched to branch '%v'. The context now has %v messages.\n", args, len(app.context))
+	}
+	return nil
+}
+
+func mergeCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a branch name")
+	}
+	added, err := app.mergeBranch(args)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("Merged %v messages from branch '%v'.\n", added, args)
+	}
 	return nil
 }
 
@@ -115,16 +534,59 @@ func clearCommand(app *App, args string) error {
 	if args != "" {
 		return ErrExpectNoArguments
 	}
-	app.context = make([]Message, 0)
-	app.tryUpdateAutosaveFile()
+	app.setContext(make([]Message, 0))
 	return nil
 }
 
 func printCommand(app *App, args string) error {
-	if args != "" {
-		app.printer.PrintWarning("this command takes no arguments. Printing context anyways\n")
+	parsed := parseCommandArguments(args)
+	numbered, verbose := false, false
+	for _, flag := range parsed.flags {
+		switch flag {
+		case "-n":
+			numbered = true
+		case "--verbose":
+			verbose = true
+		default:
+			app.printer.PrintWarning("this command takes no arguments other than -n, --verbose, a range and role=ROLE. Ignoring '%v'\n", flag)
+		}
+	}
+	role := ""
+	for key, value := range parsed.options {
+		if key != "role" {
+			app.printer.PrintWarning("this command takes no arguments other than -n, --verbose, a range and role=ROLE. Ignoring '%v=%v'\n", key, value)
+			continue
+		}
+		if !session.IsRoleValid(value) {
+			return fmt.Errorf("invalid role '%v'. Use user, assistant or system", value)
+		}
+		role = value
+	}
+	start, end, ranged := 0, len(app.context), false
+	for _, arg := range parsed.positional {
+		if !isMessageRange(arg) || ranged {
+			app.printer.PrintWarning("this command takes no arguments other than -n, --verbose, a range and role=ROLE. Ignoring '%v'\n", arg)
+			continue
+		}
+		var err error
+		start, end, err = parseMessageRange(arg, app.context)
+		if err != nil {
+			return err
+		}
+		ranged = true
+	}
+	var output strings.Builder
+	for i := start; i < end; i++ {
+		if role != "" && app.context[i].Role != role {
+			continue
+		}
+		number := 0
+		if numbered {
+			number = i + 1
+		}
+		output.WriteString(formatMessages(app.context[i:i+1], true, number, verbose))
 	}
-	app.printer.Print(plainTextRepresentation(app.context, true))
+	app.printPaged(output.String())
 	return nil
 }
 
@@ -137,7 +599,7 @@ func appendCommand(app *App, args string) error {
 	if msg == "" {
 		app.printer.PrintWarning("appending empty string to context\n")
 	}
-	app.appendToContext(Message{Role: role, Content: msg})
+	app.appendToContext(session.NewMessage(role, msg))
 	return nil
 }
 
@@ -151,20 +613,449 @@ func prependCommand(app *App, args string) error {
 		app.printer.PrintWarning("prepending empty string to context\n")
 	}
 	new := make([]Message, 0, 1+len(app.context))
-	new = append(new, Message{Role: role, Content: msg})
+	new = append(new, session.NewMessage(role, msg))
 	new = append(new, app.context...)
-	app.context = new
+	app.setContext(new)
+	return nil
+}
+
+func systemCommand(app *App, args string) error {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		if app.quiet {
+			app.printer.PrintWarning("system was run with no arguments in quiet mode.")
+			return nil
+		}
+		prompt, ok := systemPrompt(app.context)
+		if !ok {
+			app.printer.Print("There is no system prompt.\n")
+			return nil
+		}
+		app.printer.Print("%v\n", prompt)
+		return nil
+	}
+	app.setContext(withSystemPrompt(app.context, args))
+	return nil
+}
+
+func personaCommand(app *App, args string) error {
+	name, clear := strings.CutSuffix(strings.TrimSpace(args), " --clear")
+	name = strings.TrimSpace(name)
+	if name == "" || name == "list" {
+		if clear {
+			return fmt.Errorf("/persona list takes no arguments")
+		}
+		names, err := listPersonas()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			dir, _ := personasDir()
+			app.printer.Print("No personas found. Create Markdown files in %v to add them.\n", dir)
+			return nil
+		}
+		for _, name := range names {
+			app.printer.Print("%v\n", name)
+		}
+		return nil
+	}
+	return app.usePersona(name, clear)
+}
+
+func varCommand(app *App, args string) error {
+	subcommand, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	switch subcommand {
+	case "", "list":
+		if rest != "" {
+			return fmt.Errorf("/var list takes no arguments")
+		}
+		for _, name := range app.varNames() {
+			app.printer.Print("%v = %v\n", name, app.vars[name])
+		}
+		app.printer.Print("Built-in: %v\n", "{{"+strings.Join(builtinVarNames(), "}}, {{")+"}}")
+		return nil
+	case "set":
+		name, value, ok := strings.Cut(rest, " ")
+		if !ok {
+			return fmt.Errorf("expected a variable name followed by its value")
+		}
+		return app.setVar(name, strings.TrimSpace(value))
+	case "unset":
+		if _, ok := app.vars[rest]; !ok {
+			return fmt.Errorf("no variable named '%v'", rest)
+		}
+		delete(app.vars, rest)
+		return nil
+	}
+	return fmt.Errorf("unknown subcommand '%v'. Use set, unset or list", subcommand)
+}
+
+func fileCommand(app *App, args string) error {
+	args, combined := strings.CutSuffix(args, " --combined")
+	pattern := strings.TrimSpace(args)
+	role := "user"
+	i := strings.LastIndex(pattern, " ")
+	if i >= 0 && session.IsRoleValid(pattern[i+1:]) {
+		role = pattern[i+1:]
+		pattern = strings.TrimSpace(pattern[:i])
+	}
+	if pattern == "" {
+		return fmt.Errorf("expected a file name or glob pattern")
+	}
+	count, err := app.attachFiles(pattern, role, combined)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("Added %v files to the context.\n", count)
+	}
+	return nil
+}
+
+func dirCommand(app *App, args string) error {
+	options, err := parseDirArguments(args)
+	if err != nil {
+		return err
+	}
+	return app.attachDirectory(options)
+}
+
+func shCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a shell command")
+	}
+	return app.runAndAppend("", "$ "+args, shellExec(args))
+}
+
+func gitDiffCommand(app *App, args string) error {
+	parsed := parseCommandArguments(args)
+	staged := false
+	review := false
+	for _, flag := range parsed.flags {
+		switch flag {
+		case "--staged", "--cached":
+			staged = true
+		case "--review":
+			review = true
+		default:
+			return fmt.Errorf("unexpected argument: '%v'", flag)
+		}
+	}
+	for key, value := range parsed.options {
+		return fmt.Errorf("unexpected argument: '%v=%v'", key, value)
+	}
+	if len(parsed.positional) > 1 {
+		return fmt.Errorf("unexpected argument: '%v'", parsed.positional[1])
+	}
+	ref := ""
+	if len(parsed.positional) == 1 {
+		ref = parsed.positional[0]
+	}
+	return app.appendGitDiff(staged, ref, review)
+}
+
+func pasteCommand(app *App, args string) error {
+	if args != "" {
+		return ErrExpectNoArguments
+	}
+	return app.pasteFromClipboard()
+}
+
+func copyCommand(app *App, args string) error {
+	var index int
+	var err error
+	if args == "" {
+		index, err = lastMessageWithRole(app.context, "assistant")
+	} else {
+		index, err = parseMessageIndex(args, app.context)
+	}
+	if err != nil {
+		return err
+	}
+	err = copyToClipboard(app.context[index].Content)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("Copied message %v to the clipboard.\n", index+1)
+	}
+	return nil
+}
+
+func copyCodeCommand(app *App, args string) error {
+	block, err := app.selectCodeBlock(args)
+	if err != nil {
+		return err
+	}
+	err = copyToClipboard(block.text)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("Copied %v to the clipboard.\n", codeBlockSummary(block))
+	}
+	return nil
+}
+
+func saveCodeCommand(app *App, args string) error {
+	spec, path, _ := strings.Cut(args, " ")
+	if _, err := strconv.Atoi(spec); err != nil {
+		spec, path = "", args
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return fmt.Errorf("expected the path of the file to write")
+	}
+	block, err := app.selectCodeBlock(spec)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(block.text+"\n"), 0660)
+}
+
+func runCodeCommand(app *App, args string) error {
+	return app.runCodeBlock(args)
+}
+
+func applyCommand(app *App, args string) error {
+	if args != "" && args != "--dry-run" && args != "--yes" {
+		return fmt.Errorf("unexpected argument: '%v'. Only --dry-run or --yes are accepted", args)
+	}
+	return app.applyDiff(args == "--dry-run", args == "--yes")
+}
+
+func pdfCommand(app *App, args string) error {
+	path := args
+	var ranges []PageRange
+	i := strings.LastIndex(args, " ")
+	if i >= 0 && strings.ContainsAny(args[i+1:], "0123456789") && strings.Trim(args[i+1:], "0123456789-,") == "" {
+		var err error
+		ranges, err = parsePageRanges(args[i+1:])
+		if err != nil {
+			return err
+		}
+		path = strings.TrimSpace(args[:i])
+	}
+	if path == "" {
+		return fmt.Errorf("expected the path of a PDF document")
+	}
+	return app.attachPDF(path, ranges)
+}
+
+func rememberCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a text or the path of a file to remember")
+	}
+	source, text := "note", args
+	if info, err := os.Stat(args); err == nil && info.Mode().IsRegular() {
+		content, err := app.readAttachment(args)
+		if err != nil {
+			return err
+		}
+		source, text = args, content
+	}
+	count, err := app.remember(source, text)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("Remembered %v excerpts.\n", count)
+	}
+	return nil
+}
+
+func recallCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a text to search for")
+	}
+	chunks, err := app.recall(args, max(int(app.ragChunks), 3))
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("the memory is empty. Use /remember or -docs to add to it")
+	}
+	for _, chunk := range chunks {
+		app.printer.Print("%v %v\n%v\n\n", theme.Label.Sprintf("[%v]", chunk.Source), theme.Dim.Sprintf("(%.2f)", chunk.score), chunk.Text)
+	}
+	return nil
+}
+
+func recallSessionCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a text to search for")
+	}
+	return app.recallSession(args)
+}
+
+func statsCommand(app *App, args string) error {
+	if args != "" {
+		return ErrExpectNoArguments
+	}
+	app.printer.Print("%v", app.metrics.String())
+	return nil
+}
+
+func transcriptCommand(app *App, args string) error {
+	action, path, _ := strings.Cut(args, " ")
+	path = strings.TrimSpace(path)
+	switch action {
+	case "":
+		if app.transcript == nil {
+			app.printer.Print("The transcript is off.\n")
+		} else {
+			app.printer.Print("The transcript is being written to %v.\n", app.transcript.path)
+		}
+		return nil
+	case "on":
+		if path == "" {
+			path = app.transcriptPath
+		}
+		if path == "" {
+			return fmt.Errorf("expected the path of the transcript")
+		}
+		return app.startTranscript(path)
+	case "off":
+		if path != "" {
+			return fmt.Errorf("unexpected argument: '%v'", path)
+		}
+		app.stopTranscript()
+		return nil
+	}
+	return fmt.Errorf("unrecognized argument: '%v'. Expected on or off", action)
+}
+
+func debugCommand(app *App, args string) error {
+	if args != "last" {
+		return fmt.Errorf("expected \"last\"")
+	}
+	return app.debugLast()
+}
+
+func cacheCommand(app *App, args string) error {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return err
+	}
+	switch args {
+	case "":
+		state := "off"
+		if app.responseCache != nil {
+			state = "on"
+		}
+		app.printer.Print("The response cache is %v (%v answers stored in %v).\n", state, cachedResponseCount(dir), dir)
+		return nil
+	case "clear":
+		removed, err := clearResponseCache(dir)
+		if err != nil {
+			return err
+		}
+		if !app.quiet {
+			app.printer.Print("Removed %v cached answers.\n", removed)
+		}
+		return nil
+	}
+	return fmt.Errorf("unrecognized argument: '%v'. Expected clear", args)
+}
+
+func compareModelsCommand(app *App, args string) error {
+	return app.compareModels(args)
+}
+
+func bestOfCommand(app *App, args string) error {
+	return app.bestOf(args)
+}
+
+func lastCommand(app *App, args string) error {
+	spec, path, redirected := strings.Cut(args, ">")
+	spec = strings.TrimSpace(spec)
+	path = strings.TrimSpace(path)
+	if redirected && path == "" {
+		return fmt.Errorf("expected the path of the file to write after '>'")
+	}
+	n := 1
+	if spec != "" {
+		var err error
+		n, err = strconv.Atoi(spec)
+		if err != nil || n < 1 {
+			return fmt.Errorf("expected a positive number, got '%v'", spec)
+		}
+	}
+	index, err := nthLastMessageWithRole(app.context, "assistant", n)
+	if err != nil {
+		return err
+	}
+	content := app.context[index].Content
+	if redirected {
+		return os.WriteFile(path, []byte(content+"\n"), 0660)
+	}
+	app.printer.Print("%v\n", content)
 	return nil
 }
 
 func modelCommand(app *App, model string) error {
-	if model == "" {
+	if model == "" && app.quiet {
 		return fmt.Errorf("expected exactly one argument (the identifier of the model)")
 	}
+	if model == "" {
+		var err error
+		model, err = app.pickModel()
+		if err != nil || model == "" {
+			return err
+		}
+	}
 	app.SetModel(model)
 	return nil
 }
 
+func (app *App) pickModel() (string, error) {
+	if app.modelListCache == nil {
+		models, err := app.capi.ListModels()
+		if err != nil {
+			return "", err
+		}
+		app.modelListCache = models
+	}
+	filter := ""
+	for {
+		matches := filterModels(app.modelListCache, filter)
+		if len(matches) == 0 {
+			app.printer.PrintWarning("no models match \"%v\"\n", filter)
+			matches = app.modelListCache
+			filter = ""
+		}
+		families, groups := groupModelsByFamily(matches)
+		var numbered []string
+		for _, family := range families {
+			app.printer.Print("%v\n", theme.Heading.Sprint(family))
+			for _, model := range groups[family] {
+				numbered = append(numbered, model)
+				annotation := ""
+				if size, ok := modelContextWindow(model); ok {
+					annotation = fmt.Sprintf(" (%v context)", formatTokenCount(size))
+				}
+				app.printer.Print("  %v) %v%v\n", theme.Index.Sprint(len(numbered)), theme.Model.Sprint(model), annotation)
+			}
+		}
+		answer, err := app.readUserInput("Number or exact ID to select, text to filter, empty to cancel: ")
+		if err != nil || answer == "" {
+			return "", nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil {
+			if n < 1 || n > len(numbered) {
+				app.printer.PrintWarning("choose a number between 1 and %v\n", len(numbered))
+				continue
+			}
+			return numbered[n-1], nil
+		}
+		if slices.Contains(app.modelListCache, answer) {
+			return answer, nil
+		}
+		filter = answer
+	}
+}
+
 func popCommand(app *App, args string) error {
 	n, err := parseSingleIntegerFromArguments(args, 2)
 	if err != nil {
@@ -173,19 +1064,14 @@ func popCommand(app *App, args string) error {
 	return app.popFromContext(int(n))
 }
 
-func escapeCommand(app *App, messageContent string) error {
-	app.appendToContext(Message{Role: "user", Content: messageContent})
-	resp, err := app.sendContextAndProcessResponse()
-	if err != nil {
-		return err
-	}
-	app.appendToContext(Message{Role: "assistant", Content: resp})
-	return nil
+func escapeCommand(app *App, args string) error {
+	keep, messageContent := cutKeepFlag(args)
+	return app.sendAndStore([]Message{session.NewMessage("user", messageContent)}, keep)
 }
 
 func nanoCommand(app *App, role string) error {
 
-	if !isRoleValid(role) {
+	if !session.IsRoleValid(role) {
 		return fmt.Errorf("invalid role: \"%v\"", role)
 	}
 
@@ -199,27 +1085,24 @@ func nanoCommand(app *App, role string) error {
 		return fmt.Errorf("no content in file")
 	}
 
-	app.appendToContext(Message{Role: role, Content: content})
+	app.appendToContext(session.NewMessage(role, content))
 	return nil
 }
 
 func sendCommand(app *App, args string) error {
+	keep, args := cutKeepFlag(args)
 	if args != "" {
 		return ErrExpectNoArguments
 	}
-	responseContent, err := app.sendContextAndProcessResponse()
-	if err != nil {
-		return err
-	}
-	app.appendToContext(Message{Role: "assistant", Content: responseContent})
-	return nil
+	return app.sendAndStore(nil, keep)
 }
 
-func nanoSendCommand(app *App, role string) error {
+func nanoSendCommand(app *App, args string) error {
+	keep, role := cutKeepFlag(args)
 	if role == "" {
 		role = "user"
 	}
-	if !isRoleValid(role) {
+	if !session.IsRoleValid(role) {
 		return fmt.Errorf("invalid role: \"%v\"", role)
 	}
 
@@ -233,18 +1116,73 @@ func nanoSendCommand(app *App, role string) error {
 		return fmt.Errorf("no content in file")
 	}
 
-	app.appendToContext(Message{Role: role, Content: content})
 	app.printer.Print("%v\n", content)
 
-	responseContent, err := app.sendContextAndProcessResponse()
+	return app.sendAndStore([]Message{session.NewMessage(role, content)}, keep)
+}
+
+func sessionsCommand(app *App, args string) error {
+	if args != "" {
+		return ErrExpectNoArguments
+	}
+	sessions, err := listSessions()
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 && !app.quiet {
+		app.printer.Print("No saved sessions.\n")
+	}
+	for _, session := range sessions {
+		marker := " "
+		if session.path == app.autosaveFilePath {
+			marker = "*"
+		}
+		app.printer.Print("%v %v %v (%v, %v messages, updated %v)\n", marker, theme.Success.Sprint(session.id), session.title, theme.Model.Sprint(session.model), session.messages, session.updated.Local().Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+func loadCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a session ID or title")
+	}
+	session, err := findSession(args)
+	if err != nil {
+		return err
+	}
+	err = app.loadSession(session)
 	if err != nil {
 		return err
 	}
-	app.appendToContext(Message{Role: "assistant", Content: responseContent})
+	if !app.quiet {
+		app.printer.Print("Loaded session %v with %v messages.\n", session.id, len(app.context))
+	}
+	return nil
+}
 
+func renameCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a title")
+	}
+	if app.autosaveFilePath == "" {
+		return fmt.Errorf("the current conversation isn't being saved. Use /autosave or start gptrepl without -nosessions")
+	}
+	app.title = args
+	app.tryUpdateAutosaveFile()
 	return nil
 }
 
+func deleteSessionCommand(app *App, args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a session ID or title")
+	}
+	session, err := findSession(args)
+	if err != nil {
+		return err
+	}
+	return app.deleteSession(session)
+}
+
 func autosaveCommand(app *App, path string) error {
 	app.autosaveFilePath = path
 	app.tryUpdateAutosaveFile()
@@ -253,7 +1191,11 @@ func autosaveCommand(app *App, path string) error {
 
 func editCommand(app *App, args string) error {
 	if args != "" {
-		return ErrExpectNoArguments
+		index, err := parseMessageIndex(args, app.context)
+		if err != nil {
+			return err
+		}
+		return app.editMessage(index)
 	}
 	repr := plainTextRepresentation(app.context, false)
 	newData, err := presentTextEditor(repr)
@@ -264,7 +1206,102 @@ func editCommand(app *App, args string) error {
 	if err != nil {
 		return err
 	}
-	app.context = newContext
+	app.setContext(newContext)
+	return nil
+}
+
+func editLastCommand(app *App, role string) error {
+	if role != "" && !session.IsRoleValid(role) {
+		return fmt.Errorf("invalid role: \"%v\"", role)
+	}
+	for i := len(app.context) - 1; i >= 0; i-- {
+		if role == "" || app.context[i].Role == role {
+			return app.editMessage(i)
+		}
+	}
+	if role == "" {
+		return fmt.Errorf("the context is empty")
+	}
+	return fmt.Errorf("the context has no %v messages", role)
+}
+
+func tabCommand(app *App, args string) error {
+	subcommand, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	switch subcommand {
+	case "", "list":
+		if rest != "" {
+			return fmt.Errorf("/tab list takes no arguments")
+		}
+		app.storeActiveTab()
+		for i, tab := range app.tabs {
+			marker := " "
+			if i == app.activeTab {
+				marker = "*"
+			}
+			app.printer.Print("%v %v (%v) %v messages", marker, i+1, theme.Model.Sprint(tab.model), len(tab.context))
+			if tab.autosaveFilePath != "" {
+				app.printer.Print(", autosaved to %v", tab.autosaveFilePath)
+			}
+			app.printer.Print("\n")
+		}
+		return nil
+	case "new":
+		if rest != "" {
+			return fmt.Errorf("/tab new takes no arguments")
+		}
+		app.newTab()
+		if app.sessions {
+			err := app.startSession()
+			if err != nil {
+				app.printer.PrintWarning("failed to start a new session: %v\n", err)
+			}
+		}
+		if !app.quiet {
+			app.printer.Print("Opened tab %v.\n", app.activeTab+1)
+		}
+		return nil
+	case "close":
+		index := app.activeTab
+		if rest != "" {
+			n, err := strconv.Atoi(rest)
+			if err != nil {
+				return fmt.Errorf("expected a tab number, got '%v'", rest)
+			}
+			index = n - 1
+		}
+		return app.closeTab(index)
+	}
+	if rest != "" {
+		return fmt.Errorf("too many arguments")
+	}
+	n, err := strconv.Atoi(subcommand)
+	if err != nil {
+		return fmt.Errorf("unknown subcommand '%v'. Expected new, list, close or a tab number", subcommand)
+	}
+	return app.switchTab(n - 1)
+}
+
+func keybindingsCommand(app *App, args string) error {
+	if args == "" {
+		if app.quiet {
+			app.printer.PrintWarning("keybindings was run with no arguments in quiet mode.")
+		} else {
+			mapping := map[bool]string{
+				true:  theme.Success.Sprint("vi"),
+				false: theme.Success.Sprint("emacs"),
+			}
+			app.printer.Print("Current keybindings: %v.\n", mapping[app.viMode])
+		}
+		return nil
+	}
+	if args != "vi" && args != "emacs" {
+		return fmt.Errorf("unrecognized argument: '%v'. Expected vi or emacs", args)
+	}
+	app.viMode = args == "vi"
+	if editor, ok := app.reader.(interface{ SetVimMode(bool) }); ok {
+		editor.SetVimMode(app.viMode)
+	}
 	return nil
 }
 
@@ -274,8 +1311,8 @@ func forgetfulCommand(app *App, args string) error {
 			app.printer.PrintWarning("forgetful mode was run with no arguments in quiet mode.")
 		} else {
 			mapping := map[bool]string{
-				true:  color.GreenString("enabled"),
-				false: color.RedString("disabled"),
+				true:  theme.Success.Sprint("enabled"),
+				false: theme.Error.Sprint("disabled"),
 			}
 			app.printer.Print("Forgetful mode is currently %v.\n", mapping[app.forgetful])
 		}
@@ -300,10 +1337,21 @@ func exitCommand(app *App, code string) error {
 	if err != nil {
 		return err
 	}
+	app.beforeExit()
 	os.Exit(int(n))
 	return nil
 }
 
+func cutKeepFlag(args string) (bool, string) {
+	if args == "--keep" {
+		return true, ""
+	}
+	if rest, ok := strings.CutPrefix(args, "--keep "); ok {
+		return true, strings.TrimSpace(rest)
+	}
+	return false, args
+}
+
 func parseSingleIntegerFromArguments(args string, defaultValue int) (int, error) {
 	var n int64
 	var err error
@@ -323,20 +1371,21 @@ func parseSingleMessageFromArguments(args string) (string, string, error) {
 		return "", "", fmt.Errorf("expected two arguments")
 	}
 	role, msg, _ := strings.Cut(args, " ")
-	if !isRoleValid(role) {
+	if !session.IsRoleValid(role) {
 		return "", "", fmt.Errorf("invalid role: \"%v\"", role)
 	}
 	return role, msg, nil
 }
 
-func readContextFileFromArguments(args string) ([]Message, error) {
+func (app *App) readContextFileFromArguments(args string) ([]Message, error) {
 	if args == "" {
 		return nil, fmt.Errorf("exactly one argument required (path to JSON file)")
 	}
-	ctx, err := parseContextFile(args)
+	ctx, metadata, err := parseContextFileWithMetadata(args)
 	if err != nil {
 		return nil, err
 	}
+	app.checkContextModel(ContextOrigin{path: args, model: metadata.Model})
 	return ctx, nil
 }
 
@@ -352,12 +1401,12 @@ func presentTextEditor(initialContent string) (string, error) {
 	temp.Close()
 	defer os.Remove(temp.Name())
 	os.Chmod(temp.Name(), 0777)
-	editorPath := os.Getenv("GPTREPL_TEXT_EDITOR")
-	if editorPath == "" {
-		editorPath = "nano"
+	editorCommand, err := textEditorCommand()
+	if err != nil {
+		return "", err
 	}
 
-	cmd := exec.Command(editorPath, temp.Name())
+	cmd := exec.Command(editorCommand[0], append(editorCommand[1:], temp.Name())...)
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
@@ -372,3 +1421,64 @@ func presentTextEditor(initialContent string) (string, error) {
 	}
 	return string(content), nil
 }
+
+func textEditorCommand() ([]string, error) {
+	for _, variable := range []string{"GPTREPL_TEXT_EDITOR", "VISUAL", "EDITOR"} {
+		value := strings.TrimSpace(os.Getenv(variable))
+		if value == "" {
+			continue
+		}
+		args, err := splitCommandLine(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v: %v", variable, err)
+		}
+		return args, nil
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}, nil
+	}
+	return []string{"nano"}, nil
+}
+
+func splitCommandLine(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'' && runtime.GOOS != "windows":
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const minSideBySideColumnWidth = 30
+
+type Candidate struct {
+	label  string
+	answer Message
+	err    error
+}
+
+func generateWith(capi CompletionAPI, model string, messages []Message, maxRetries uint) (Message, error) {
+	return session.Generate(capi, model, messages, session.Options{MaxRetries: maxRetries, OnRetry: retryWaiter(nil)})
+}
+
+func (app *App) generateFromModels(models []string, messages []Message) []Candidate {
+	candidates := make([]Candidate, len(models))
+	if _, concurrent := cloneCompletionAPI(app.capi); concurrent {
+		var wg sync.WaitGroup
+		for i, model := range models {
+			candidates[i].label = model
+			capi, _ := cloneCompletionAPI(app.capi)
+			capi.SetModel(model)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				candidates[i].answer, candidates[i].err = generateWith(capi, model, messages, app.maxRetries)
+			}()
+		}
+		wg.Wait()
+	} else {
+		previousModel := app.model
+		for i, model := range models {
+			candidates[i].label = model
+			app.capi.SetModel(model)
+			candidates[i].answer, candidates[i].err = generateWith(app.capi, model, messages, app.maxRetries)
+		}
+		app.capi.SetModel(previousModel)
+	}
+	app.metrics.requests += len(models)
+	for _, candidate := range candidates {
+		if candidate.err != nil {
+			app.metrics.errors++
+		}
+	}
+	return candidates
+}
+
+func candidateText(candidate Candidate) string {
+	if candidate.err != nil {
+		return theme.Error.Sprint("Error: ") + candidate.err.Error()
+	}
+	return candidate.answer.Content
+}
+
+func candidateHeading(number int, candidate Candidate) string {
+	heading := theme.Heading.Sprintf("[%v] %v", number, candidate.label)
+	if candidate.err == nil {
+		heading += theme.Dim.Sprintf(" (%.1fs)", float64(candidate.answer.DurationMs)/1000)
+	}
+	return heading
+}
+
+func wrapColumn(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		for _, wrapped := range textWrap(line, width) {
+			for utf8.RuneCountInString(wrapped) > width {
+				runes := []rune(wrapped)
+				lines = append(lines, string(runes[:width]))
+				wrapped = string(runes[width:])
+			}
+			lines = append(lines, wrapped)
+		}
+	}
+	return lines
+}
+
+func padRight(text string, width int) string {
+	visible := utf8.RuneCountInString(ansiEscapePattern.ReplaceAllString(text, ""))
+	if visible >= width {
+		return text
+	}
+	return text + strings.Repeat(" ", width-visible)
+}
+
+func formatCandidates(candidates []Candidate, width int) string {
+	var result strings.Builder
+	columnWidth := 0
+	if len(candidates) > 1 {
+		columnWidth = (width - 3*(len(candidates)-1)) / len(candidates)
+	}
+	if columnWidth < minSideBySideColumnWidth {
+		for i, candidate := range candidates {
+			fmt.Fprintf(&result, "%v\n%v\n\n", candidateHeading(i+1, candidate), candidateText(candidate))
+		}
+		return result.String()
+	}
+	columns := make([][]string, len(candidates))
+	rows := 0
+	for i, candidate := range candidates {
+		columns[i] = append([]string{candidateHeading(i+1, candidate), ""}, wrapColumn(ansiEscapePattern.ReplaceAllString(candidateText(candidate), ""), columnWidth)...)
+		rows = max(rows, len(columns[i]))
+	}
+	separator := theme.Dim.Sprint(" │ ")
+	for row := 0; row < rows; row++ {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			if row < len(column) {
+				cells[i] = column[row]
+			}
+			if i < len(columns)-1 {
+				cells[i] = padRight(cells[i], columnWidth)
+			}
+		}
+		fmt.Fprintf(&result, "%v\n", strings.TrimRight(strings.Join(cells, separator), " "))
+	}
+	result.WriteString("\n")
+	return result.String()
+}
+
+func (app *App) pickCandidate(candidates []Candidate, question string) (int, error) {
+	if app.reader == nil || app.quiet {
+		return -1, nil
+	}
+	for {
+		answer, err := app.readUserInput(question)
+		if err != nil || answer == "" {
+			return -1, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 1 && n <= len(candidates) && candidates[n-1].err == nil {
+			return n - 1, nil
+		}
+		app.printer.PrintWarning("enter a number from 1 to %v of an answer without errors\n", len(candidates))
+	}
+}
+
+func (app *App) looksLikeModel(word string) bool {
+	if _, ok := app.modelAliases()[word]; ok || word == app.model {
+		return true
+	}
+	if slices.Contains(app.modelListCache, word) {
+		return true
+	}
+	_, known := modelContextWindow(word)
+	_, priced := modelPrices(word)
+	return known || priced
+}
+
+func (app *App) parseCompareArguments(args string) ([]string, string, error) {
+	var models []string
+	rest := strings.TrimSpace(args)
+	for rest != "" {
+		word, remaining, _ := strings.Cut(rest, " ")
+		if word == "--" {
+			rest = strings.TrimSpace(remaining)
+			break
+		}
+		if !app.looksLikeModel(word) && !strings.Contains(args, " -- ") {
+			break
+		}
+		models = append(models, app.resolveModel(word))
+		rest = strings.TrimSpace(remaining)
+	}
+	if len(models) < 2 {
+		return nil, "", fmt.Errorf("expected at least two models followed by the prompt (put -- between them if a model isn't recognized)")
+	}
+	if rest == "" {
+		return nil, "", fmt.Errorf("expected a prompt after the models")
+	}
+	return models, rest, nil
+}
+
+func (app *App) compareModels(args string) error {
+	models, prompt, err := app.parseCompareArguments(args)
+	if err != nil {
+		return err
+	}
+	question := session.NewMessage("user", prompt)
+	messages := app.withRetrievedChunks(append(slices.Clone(app.context), question), []Message{question})
+	if !app.quiet {
+		app.printer.Print("%v\n", theme.Dim.Sprintf("Waiting for %v models...", len(models)))
+	}
+	candidates := app.generateFromModels(models, messages)
+	width, _, ok := terminalSize()
+	if !ok || app.wrapDisabled {
+		width = 0
+	}
+	app.printPaged(formatCandidates(candidates, width))
+	if !slices.ContainsFunc(candidates, func(c Candidate) bool { return c.err == nil }) {
+		return fmt.Errorf("no model answered")
+	}
+	chosen, err := app.pickCandidate(candidates, "Enter the number of the answer to keep in the context, or nothing to keep none: ")
+	if err != nil || chosen < 0 {
+		return err
+	}
+	if !app.forgetful {
+		app.appendToContext(question, candidates[chosen].answer)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+var compressionStrategies = []string{"head-tail", "skeleton", "summarize", "none"}
+
+var compressionDescriptions = map[string]string{
+	"head-tail": "keep the beginning and the end, dropping the middle",
+	"skeleton":  "keep only declarations and signatures (for source code)",
+	"summarize": "ask the model to summarize it (costs extra requests)",
+	"none":      "attach it as-is",
+}
+
+var skeletonKeywords = []string{
+	"package ", "import ", "from ", "func ", "type ", "class ", "def ", "async def ", "interface ", "struct ", "enum ",
+	"fn ", "pub ", "impl ", "trait ", "mod ", "export ", "function ", "async function ", "const ", "var ", "let ",
+	"public ", "private ", "protected ", "static ", "abstract ", "module ", "#include", "#define", "@",
+}
+
+const summarizeChunkPrompt = "Summarize the following content in at most %v tokens. Keep names, numbers, identifiers and any details needed to answer questions about it. Reply with the summary only.\n\n"
+
+func (app *App) attachmentBudget() (int, bool) {
+	window, ok := modelContextWindow(app.model)
+	if !ok {
+		return 0, false
+	}
+	used := 0
+	for _, msg := range app.context {
+		used += session.EstimateTokens(msg.Content)
+	}
+	return max(window*3/4-used, 0), true
+}
+
+func (app *App) confirmLargeRequest(messages []Message) error {
+	if app.confirmOverTokens == 0 {
+		return nil
+	}
+	tokens := 0
+	for _, msg := range messages {
+		tokens += session.EstimateTokens(msg.Content)
+	}
+	if tokens <= int(app.confirmOverTokens) {
+		return nil
+	}
+	estimate := fmt.Sprintf("about %v tokens", formatTokenCount(tokens))
+	if prices, ok := modelPrices(app.model); ok {
+		estimate += fmt.Sprintf(", $%.2f of input with %v", float64(tokens)*prices[0]/1000000, app.model)
+	}
+	if app.reader == nil {
+		return fmt.Errorf("the request is %v, more than the %v allowed by -confirm-over-tokens without confirmation", estimate, app.confirmOverTokens)
+	}
+	if !app.confirm(fmt.Sprintf("The request is %v. Send it?", estimate)) {
+		return fmt.Errorf("request cancelled")
+	}
+	return nil
+}
+
+func (app *App) fitAttachment(name string, content string) (string, error) {
+	budget, ok := app.attachmentBudget()
+	tokens := session.EstimateTokens(content)
+	if !ok || tokens <= budget {
+		return content, nil
+	}
+	strategy := app.compression
+	if strategy == "" || strategy == "ask" {
+		if app.reader == nil {
+			return "", fmt.Errorf("%v is about %v tokens, but only about %v are left in the context window of %v. Use -compress to pick one of: %v", name, tokens, budget, app.model, strings.Join(compressionStrategies, ", "))
+		}
+		var err error
+		strategy, err = app.askCompressionStrategy(name, tokens, budget)
+		if err != nil {
+			return "", err
+		}
+	}
+	if strategy == "none" {
+		return content, nil
+	}
+	if budget == 0 {
+		return "", fmt.Errorf("no room is left in the context window of %v for %v", app.model, name)
+	}
+	compressed, err := app.compressContent(content, strategy, budget)
+	if err != nil {
+		return "", err
+	}
+	if !app.quiet {
+		app.printer.PrintWarning("%v was compressed from about %v to about %v tokens (%v)\n", name, tokens, session.EstimateTokens(compressed), strategy)
+	}
+	return compressed, nil
+}
+
+func (app *App) askCompressionStrategy(name string, tokens int, budget int) (string, error) {
+	app.printer.PrintWarning("%v is about %v tokens, but only about %v are left in the context window of %v.\n", name, tokens, budget, app.model)
+	for i, strategy := range compressionStrategies {
+		app.printer.Print("  %v) %v: %v\n", i+1, strategy, compressionDescriptions[strategy])
+	}
+	for {
+		answer, err := app.readUserInput("Strategy (empty to cancel): ")
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			return "", fmt.Errorf("attachment cancelled")
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(compressionStrategies) {
+			return compressionStrategies[n-1], nil
+		}
+		if slices.Contains(compressionStrategies, answer) {
+			return answer, nil
+		}
+		app.printer.PrintError("unknown strategy '%v'\n", answer)
+	}
+}
+
+func (app *App) compressContent(content string, strategy string, budget int) (string, error) {
+	switch strategy {
+	case "head-tail":
+		return headTail(content, budget*4), nil
+	case "skeleton":
+		return headTail(codeSkeleton(content), budget*4), nil
+	case "summarize":
+		return app.summarizeContent(content, budget)
+	}
+	return "", fmt.Errorf("unknown compression strategy '%v'. Expected one of: %v", strategy, strings.Join(compressionStrategies, ", "))
+}
+
+func headTail(content string, limit int) string {
+	if len(content) <= limit {
+		return content
+	}
+	marker := "\n\n[... %v characters omitted ...]\n\n"
+	keep := max(limit-len(marker)-8, 0) / 2
+	head := strings.ToValidUTF8(content[:keep], "")
+	tail := strings.ToValidUTF8(content[len(content)-keep:], "")
+	return head + fmt.Sprintf(marker, len(content)-2*keep) + tail
+}
+
+func codeSkeleton(content string) string {
+	var kept []string
+	omitted := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		keep := false
+		for _, keyword := range skeletonKeywords {
+			if strings.HasPrefix(trimmed, keyword) {
+				keep = true
+				break
+			}
+		}
+		if trimmed != "" && line[0] != ' ' && line[0] != '\t' && !strings.ContainsAny(trimmed[:1], "})]") {
+			keep = true
+		}
+		if keep {
+			if omitted {
+				kept = append(kept, line[:len(line)-len(strings.TrimLeft(line, " \t"))]+"    ...")
+				omitted = false
+			}
+			kept = append(kept, line)
+		} else if trimmed != "" {
+			omitted = true
+		}
+	}
+	if omitted {
+		kept = append(kept, "    ...")
+	}
+	return strings.Join(kept, "\n")
+}
+
+func (app *App) summarizeContent(content string, budget int) (string, error) {
+	chunkSize := budget * 4
+	var chunks []string
+	for len(content) > chunkSize {
+		cut := strings.LastIndex(content[:chunkSize], "\n")
+		if cut <= 0 {
+			cut = chunkSize
+		}
+		chunks = append(chunks, content[:cut])
+		content = content[cut:]
+	}
+	chunks = append(chunks, content)
+	target := max(budget/len(chunks), 1)
+	summaries := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		if !app.quiet {
+			app.printer.PrintWarning("summarizing part %v of %v...\n", i+1, len(chunks))
+		}
+		messages := []Message{{Role: "user", Content: fmt.Sprintf(summarizeChunkPrompt, target) + chunk}}
+		stream, err := sendWithRetries(app.capi, messages, app.maxRetries, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to summarize: %v", err)
+		}
+		summaries[i], err = session.Collect(stream, func(string) {})
+		if err != nil {
+			return "", fmt.Errorf("failed to summarize: %v", err)
+		}
+		summaries[i] = strings.TrimSpace(summaries[i])
+	}
+	return strings.Join(summaries, "\n\n"), nil
+}
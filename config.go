@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type Config struct {
+	Commands  CommandsConfig    `json:"commands"`
+	Theme     string            `json:"theme"`
+	Colors    map[string]string `json:"colors"`
+	Aliases   map[string]string `json:"aliases"`
+	Redaction RedactionConfig   `json:"redaction"`
+	Hook      HookConfig        `json:"hook"`
+	Bot       BotConfig         `json:"bot"`
+	Serve     ServeConfig       `json:"serve"`
+}
+
+type RedactionConfig struct {
+	Patterns []string `json:"patterns"`
+}
+
+type CommandsConfig struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+var ErrCommandDisabled = fmt.Errorf("command disabled by configuration")
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gptrepl", "config.json")
+}
+
+func loadConfig(path string, mustExist bool) (Config, error) {
+	var config Config
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !mustExist {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("%v: %v", path, err)
+	}
+	return config, nil
+}
+
+func (config *Config) isCommandEnabled(name string) bool {
+	if len(config.Commands.Allow) > 0 && !slices.Contains(config.Commands.Allow, name) {
+		return false
+	}
+	return !slices.Contains(config.Commands.Deny, name)
+}
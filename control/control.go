@@ -0,0 +1,85 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Request struct {
+	Line string `json:"line"`
+}
+
+type Response struct {
+	Error string `json:"error,omitempty"`
+}
+
+func DefaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "gptrepl.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gptrepl-%v.sock", os.Getuid()))
+}
+
+func Listen(path string, handle func(line string) error) (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%v is already used by another gptrepl", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, handle)
+		}
+	}()
+	return listener, nil
+}
+
+func serve(conn net.Conn, handle func(line string) error) {
+	defer conn.Close()
+	var request Request
+	var response Response
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		response.Error = fmt.Sprintf("invalid request: %v", err)
+	} else if err := handle(request.Line); err != nil {
+		response.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+func Send(path string, line string) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("no gptrepl is listening on %v (start it with -control): %w", path, err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(Request{Line: line}); err != nil {
+		return err
+	}
+	var response Response
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package control
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSendAndListen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gptrepl.sock")
+	received := make(chan string, 1)
+	listener, err := Listen(path, func(line string) error {
+		if line == "fail" {
+			return fmt.Errorf("not now")
+		}
+		received <- line
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if err := Send(path, "hello\nworld"); err != nil {
+		t.Fatalf("expected no errors, got %v", err)
+	}
+	if line := <-received; line != "hello\nworld" {
+		t.Fatalf("unexpected line %q", line)
+	}
+	if err := Send(path, "fail"); err == nil || err.Error() != "not now" {
+		t.Fatalf("expected the error of the handler, got %v", err)
+	}
+	if _, err := Listen(path, nil); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected the socket to be in use, got %v", err)
+	}
+	listener.Close()
+	if err := Send(path, "hello"); err == nil || !strings.Contains(err.Error(), "-control") {
+		t.Fatalf("expected an error without a listener, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/providers"
+)
+
+func formatExchange(request string, status string, events []string, total int) string {
+	if request == "" {
+		return ""
+	}
+	var result strings.Builder
+	fmt.Fprintf(&result, "%v\n", theme.Heading.Sprint("Request:"))
+	fmt.Fprintf(&result, "%v\n\n", request)
+	if status == "" {
+		fmt.Fprintf(&result, "%v\nno response was received.\n", theme.Heading.Sprint("Response:"))
+		return result.String()
+	}
+	heading := "Response:"
+	if total > len(events) {
+		heading = fmt.Sprintf("Response (the last %v of %v events):", len(events), total)
+	}
+	fmt.Fprintf(&result, "%v\n%v\n", theme.Heading.Sprint(heading), status)
+	for _, event := range events {
+		fmt.Fprintf(&result, "%v\n", event)
+	}
+	return result.String()
+}
+
+func (app *App) debugLast() error {
+	dump := formatExchange(providers.LastExchange.Snapshot())
+	if dump == "" {
+		return fmt.Errorf("no request has been sent to the model yet")
+	}
+	if len(app.apiKey) > 8 {
+		dump = strings.ReplaceAll(dump, app.apiKey, providers.RedactSecret(app.apiKey))
+	}
+	app.printPaged(dump)
+	return nil
+}
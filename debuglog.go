@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/Sa-RSt/gptrepl/providers"
+)
+
+var debugLog = slog.New(slog.DiscardHandler)
+
+func configureDebugLog(enabled bool, path string) error {
+	if !enabled && path == "" {
+		return nil
+	}
+	var out io.Writer = os.Stderr
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+		if err != nil {
+			return err
+		}
+		out = file
+	}
+	debugLog = slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	providers.Logger = debugLog
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+	gitignore "github.com/monochromegane/go-gitignore"
+)
+
+const binarySniffSize = 8000
+
+type DirOptions struct {
+	path    string
+	include []string
+	exclude []string
+}
+
+type DirDigest struct {
+	tree     []string
+	files    []string
+	contents []string
+}
+
+type gitignoreMatcher struct {
+	dir     string
+	matcher gitignore.IgnoreMatcher
+}
+
+func parseDirArguments(args string) (DirOptions, error) {
+	var options DirOptions
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "-include", "-exclude":
+			if i+1 == len(fields) {
+				return options, fmt.Errorf("%v requires a glob pattern", fields[i])
+			}
+			_, err := filepath.Match(fields[i+1], "")
+			if err != nil {
+				return options, fmt.Errorf("invalid pattern '%v': %w", fields[i+1], err)
+			}
+			if fields[i] == "-include" {
+				options.include = append(options.include, fields[i+1])
+			} else {
+				options.exclude = append(options.exclude, fields[i+1])
+			}
+			i++
+		default:
+			if options.path != "" {
+				return options, fmt.Errorf("unexpected argument: '%v'", fields[i])
+			}
+			options.path = fields[i]
+		}
+	}
+	if options.path == "" {
+		options.path = "."
+	}
+	return options, nil
+}
+
+func matchesAnyGlob(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.ToSlash(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isBinaryFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	head := make([]byte, binarySniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return bytes.IndexByte(head[:n], 0) >= 0, nil
+}
+
+func isGitignored(matchers []gitignoreMatcher, path string, isDir bool) bool {
+	for _, m := range matchers {
+		if strings.HasPrefix(path, m.dir+string(filepath.Separator)) && m.matcher.Match(path, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+func walkDirectory(path string, visit func(path string, relative string, entry fs.DirEntry) error) error {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", path)
+	}
+	var matchers []gitignoreMatcher
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, _ := filepath.Rel(root, path)
+		if entry.IsDir() {
+			if path != root && (entry.Name() == ".git" || isGitignored(matchers, path, true)) {
+				return filepath.SkipDir
+			}
+			matcher, err := gitignore.NewGitIgnore(filepath.Join(path, ".gitignore"), path)
+			if err == nil {
+				matchers = append(matchers, gitignoreMatcher{dir: path, matcher: matcher})
+			}
+			if path == root {
+				return nil
+			}
+			return visit(path, relative, entry)
+		}
+		if !entry.Type().IsRegular() || isGitignored(matchers, path, false) {
+			return nil
+		}
+		return visit(path, relative, entry)
+	})
+}
+
+func digestDirectory(options DirOptions) (DirDigest, error) {
+	var digest DirDigest
+	err := walkDirectory(options.path, func(path string, relative string, entry fs.DirEntry) error {
+		indent := strings.Repeat("  ", strings.Count(relative, string(filepath.Separator)))
+		if entry.IsDir() {
+			digest.tree = append(digest.tree, indent+entry.Name()+"/")
+			return nil
+		}
+		line := indent + entry.Name()
+		binary, err := isBinaryFile(path)
+		if err != nil {
+			return err
+		}
+		selected := (len(options.include) == 0 || matchesAnyGlob(options.include, relative)) && !matchesAnyGlob(options.exclude, relative)
+		switch {
+		case binary:
+			line += " (binary)"
+		case selected:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			digest.files = append(digest.files, filepath.Join(options.path, relative))
+			digest.contents = append(digest.contents, string(data))
+		}
+		digest.tree = append(digest.tree, line)
+		return nil
+	})
+	return digest, err
+}
+
+func (digest *DirDigest) content(path string) string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "Directory %v:\n```\n%v\n```", path, strings.Join(digest.tree, "\n"))
+	for i, file := range digest.files {
+		result.WriteString("\n\n")
+		result.WriteString(fencedFile(file, digest.contents[i]))
+	}
+	return result.String()
+}
+
+func (app *App) attachDirectory(options DirOptions) error {
+	digest, err := digestDirectory(options)
+	if err != nil {
+		return err
+	}
+	if len(digest.tree) == 0 {
+		return fmt.Errorf("%v has no files to add", options.path)
+	}
+	content := digest.content(options.path)
+	tokens := session.EstimateTokens(content)
+	if app.reader != nil && !app.confirm(fmt.Sprintf("Add %v files from %v (about %v tokens) to the context?", len(digest.files), options.path, formatTokenCount(tokens))) {
+		return nil
+	}
+	app.appendToContext(session.NewMessage("user", content))
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const maxIndexedFileSize = 1024 * 1024
+
+type IndexStats struct {
+	files   int
+	chunks  int
+	cached  int
+	skipped int
+}
+
+func embeddingCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gptrepl", "embeddings"), nil
+}
+
+func embeddingCachePath(dir string, model string, data []byte) string {
+	hash := sha256.Sum256(data)
+	return filepath.Join(dir, model+"-"+hex.EncodeToString(hash[:])+".json")
+}
+
+func readIndexedFile(path string) (string, bool, error) {
+	if extract, ok := documentExtractors[strings.ToLower(filepath.Ext(path))]; ok {
+		text, err := extract(path)
+		return text, err == nil, nil
+	}
+	binary, err := isBinaryFile(path)
+	if err != nil || binary {
+		return "", false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
+
+func indexFile(eapi EmbeddingAPI, cacheDir string, source string, text string) ([]StoredChunk, bool, error) {
+	cachePath := embeddingCachePath(cacheDir, eapi.Model(), []byte(text))
+	var chunks []StoredChunk
+	data, err := os.ReadFile(cachePath)
+	if err == nil && json.Unmarshal(data, &chunks) == nil {
+		for i := range chunks {
+			chunks[i].Source = source
+		}
+		return chunks, true, nil
+	}
+	store := VectorStore{}
+	_, err = store.add(eapi, source, text)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err = json.Marshal(store.Chunks)
+	if err == nil && os.MkdirAll(cacheDir, 0770) == nil {
+		session.WriteFileAtomically(cachePath, data, 0)
+	}
+	return store.Chunks, false, nil
+}
+
+func (app *App) indexDocuments(dir string) (IndexStats, error) {
+	var stats IndexStats
+	eapi, err := app.embeddingAPI()
+	if err != nil {
+		return stats, err
+	}
+	cacheDir, err := embeddingCacheDir()
+	if err != nil {
+		return stats, err
+	}
+	store := &VectorStore{Model: eapi.Model()}
+	err = walkDirectory(dir, func(path string, relative string, entry fs.DirEntry) error {
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() > maxIndexedFileSize {
+			stats.skipped++
+			return nil
+		}
+		text, ok, err := readIndexedFile(path)
+		if err != nil {
+			return err
+		}
+		if !ok || strings.TrimSpace(text) == "" {
+			stats.skipped++
+			return nil
+		}
+		chunks, cached, err := indexFile(eapi, cacheDir, filepath.ToSlash(relative), text)
+		if err != nil {
+			return err
+		}
+		store.Chunks = append(store.Chunks, chunks...)
+		stats.files++
+		stats.chunks += len(chunks)
+		if cached {
+			stats.cached++
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	app.docs = store
+	return stats, nil
+}
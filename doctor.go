@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/providers"
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type doctorStatus int
+
+const (
+	doctorPass doctorStatus = iota
+	doctorWarn
+	doctorFail
+)
+
+type DoctorCheck struct {
+	name   string
+	status doctorStatus
+	detail string
+	hint   string
+}
+
+func (check DoctorCheck) String() string {
+	var label string
+	switch check.status {
+	case doctorPass:
+		label = theme.Command.Sprint("PASS")
+	case doctorWarn:
+		label = theme.Warning.Sprint("WARN")
+	default:
+		label = theme.Error.Sprint("FAIL")
+	}
+	result := fmt.Sprintf("%v %v: %v\n", label, check.name, check.detail)
+	if check.hint != "" {
+		result += theme.Dim.Sprintf("     %v", check.hint) + "\n"
+	}
+	return result
+}
+
+func runDoctor(args []string) int {
+	app := App{printer: &ConsoleUserPrinter{}, capi: providers.NewOpenAI(), quiet: true}
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gptrepl doctor [flags]\n\nChecks the API key, the connection to the provider, the model, the text editor, the configuration\nfile and the terminal, and suggests how to fix what doesn't work.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&app.provider, "provider", "auto", providerFlagUsage)
+	model := flags.String("model", "", modelFlagUsage)
+	apiKey := flags.String("apikey", "", apiKeyFlagUsage)
+	configPath := flags.String("config", "", fmt.Sprintf("Path to a JSON configuration file (defaults to %v).", defaultConfigPath()))
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	configureColor("auto")
+	app.model = *model
+	app.apiKey = *apiKey
+	failed := 0
+	for _, check := range app.doctorChecks(*configPath) {
+		app.printer.Print("%v", check)
+		if check.status == doctorFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		app.printer.Print("\n%v of the checks failed.\n", failed)
+		return 1
+	}
+	app.printer.Print("\nEverything looks fine.\n")
+	return 0
+}
+
+func (app *App) doctorChecks(configPath string) []DoctorCheck {
+	checks := []DoctorCheck{doctorConfig(configPath)}
+	provider := app.doctorProvider()
+	checks = append(checks, provider)
+	if provider.status != doctorFail {
+		checks = append(checks, app.doctorNetwork())
+		checks = append(checks, app.doctorModel())
+	}
+	return append(checks, doctorEditor(), doctorTerminal())
+}
+
+func doctorConfig(configPath string) DoctorCheck {
+	check := DoctorCheck{name: "Configuration file"}
+	mustExist := configPath != ""
+	if !mustExist {
+		configPath = defaultConfigPath()
+	}
+	config, err := loadConfig(configPath, mustExist)
+	if err == nil {
+		_, err = loadTheme(config.Theme, config.Colors)
+	}
+	if err == nil {
+		_, err = newRedactingCompletionAPI(nil, config.Redaction.Patterns, nil)
+	}
+	if err != nil {
+		check.status = doctorFail
+		check.detail = err.Error()
+		check.hint = fmt.Sprintf("Fix %v or pass another file with -config.", configPath)
+		return check
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		check.detail = fmt.Sprintf("%v doesn't exist, so the defaults are used", configPath)
+		return check
+	}
+	check.detail = fmt.Sprintf("%v is valid", configPath)
+	return check
+}
+
+func apiKeySource(provider string, fromFlag bool) string {
+	switch {
+	case fromFlag:
+		return "-apikey"
+	case provider == "anthropic":
+		return "$ANTHROPIC_API_KEY"
+	case os.Getenv("OPENAI_API_KEY") != "":
+		return "$OPENAI_API_KEY"
+	}
+	return "~/.gptrepl-key"
+}
+
+func (app *App) doctorProvider() DoctorCheck {
+	check := DoctorCheck{name: "API key"}
+	fromFlag := app.apiKey != ""
+	err := app.selectProvider()
+	if errors.Is(err, ErrNoProvider) {
+		check.status = doctorFail
+		check.detail = "no API key was found and Ollama isn't running"
+		check.hint = "Set OPENAI_API_KEY, save the key to ~/.gptrepl-key, set ANTHROPIC_API_KEY, pass -apikey or start Ollama."
+		return check
+	}
+	if err != nil {
+		check.status = doctorFail
+		check.detail = err.Error()
+		check.hint = "Check the -provider flag and the environment variables of the provider."
+		return check
+	}
+	switch app.provider {
+	case "ollama":
+		check.detail = fmt.Sprintf("not needed, using Ollama at %v", ollamaHost())
+	case "mock":
+		check.detail = "not needed, using the mock provider"
+	default:
+		check.detail = fmt.Sprintf("using %v with the key from %v", app.provider, apiKeySource(app.provider, fromFlag))
+	}
+	return check
+}
+
+func (app *App) providerBaseURL() string {
+	withBaseURL, ok := app.capi.(interface{ BaseURL() string })
+	if !ok {
+		return ""
+	}
+	if baseURL := withBaseURL.BaseURL(); baseURL != "" {
+		return baseURL
+	}
+	return openai.DefaultConfig("").BaseURL
+}
+
+func (app *App) doctorNetwork() DoctorCheck {
+	check := DoctorCheck{name: "Network"}
+	baseURL := app.providerBaseURL()
+	if baseURL == "" {
+		check.detail = fmt.Sprintf("not needed by the %v provider", app.provider)
+		return check
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	start := time.Now()
+	resp, err := client.Get(baseURL)
+	if err != nil {
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("%v is unreachable: %v", baseURL, err)
+		check.hint = "Check the internet connection, the proxy settings ($HTTPS_PROXY) and the firewall."
+		return check
+	}
+	resp.Body.Close()
+	check.detail = fmt.Sprintf("%v answered in %v", baseURL, time.Since(start).Round(time.Millisecond))
+	return check
+}
+
+func (app *App) doctorModel() DoctorCheck {
+	check := DoctorCheck{name: "Model"}
+	models, err := app.capi.ListModels()
+	if err != nil {
+		report := newErrorReport(err, app.provider)
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("couldn't list the models: %v", report.Message)
+		check.hint = "Check that the API key is valid and that the account has access to the API."
+		if report.Code == "network_error" {
+			check.hint = "Check the internet connection, the proxy settings ($HTTPS_PROXY) and the firewall."
+		}
+		return check
+	}
+	if !slices.Contains(models, app.model) {
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("%v isn't available (%v models were found)", app.model, len(models))
+		check.hint = "Pass another model with -model, or run /model without arguments to pick one."
+		return check
+	}
+	check.detail = fmt.Sprintf("%v is available", app.model)
+	return check
+}
+
+func doctorEditor() DoctorCheck {
+	check := DoctorCheck{name: "Text editor"}
+	args, err := textEditorCommand()
+	if err == nil {
+		_, err = exec.LookPath(args[0])
+	}
+	if err != nil {
+		check.status = doctorFail
+		check.detail = err.Error()
+		check.hint = "Install it, or set GPTREPL_TEXT_EDITOR, VISUAL or EDITOR to another editor (e.g. \"code --wait\")."
+		return check
+	}
+	check.detail = fmt.Sprintf("%v will be used by /edit", strings.Join(args, " "))
+	return check
+}
+
+func doctorTerminal() DoctorCheck {
+	check := DoctorCheck{name: "Terminal"}
+	var problems []string
+	if !stdinIsTerminal() {
+		problems = append(problems, "stdin isn't a terminal, so lines are read without editing or history")
+	}
+	if !stdoutIsTerminal() {
+		problems = append(problems, "stdout isn't a terminal")
+	}
+	if os.Getenv("TERM") == "dumb" {
+		problems = append(problems, "TERM is \"dumb\"")
+	}
+	if color.NoColor {
+		problems = append(problems, "colors are disabled")
+	}
+	if len(problems) > 0 {
+		check.status = doctorWarn
+		check.detail = strings.Join(problems, ", ")
+		check.hint = "Run gptrepl directly in a terminal for colors, the status line and line editing. Use -color always to force colors."
+		return check
+	}
+	width, height, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		check.detail = "colors are enabled"
+		return check
+	}
+	check.detail = fmt.Sprintf("%vx%v with colors enabled", width, height)
+	return check
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+	"github.com/ledongthuc/pdf"
+)
+
+const largeDocumentTokens = 20000
+
+var documentExtractors = map[string]func(string) (string, error){
+	".pdf": func(path string) (string, error) {
+		return extractPDFText(path, nil)
+	},
+	".docx": extractDocxText,
+}
+
+type PageRange struct {
+	first int
+	last  int
+}
+
+func parsePageRanges(spec string) ([]PageRange, error) {
+	var ranges []PageRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		r := PageRange{}
+		var err error
+		if first != "" {
+			r.first, err = strconv.Atoi(first)
+		} else {
+			r.first = 1
+		}
+		if err == nil && last != "" {
+			r.last, err = strconv.Atoi(last)
+		} else if !isRange {
+			r.last = r.first
+		}
+		if err != nil || part == "" || r.first < 1 || r.last != 0 && r.last < r.first {
+			return nil, fmt.Errorf("invalid page range: '%v'. Use e.g. 3, 2-5, 7- or 1-3,8", part)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func pageSelected(ranges []PageRange, page int) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if page >= r.first && (r.last == 0 || page <= r.last) {
+			return true
+		}
+	}
+	return false
+}
+
+func extractPDFText(path string, ranges []PageRange) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read %v: %v", path, r)
+		}
+	}()
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %v: %w", path, err)
+	}
+	defer file.Close()
+	var pages []string
+	for i := 1; i <= reader.NumPage(); i++ {
+		if !pageSelected(ranges, i) {
+			continue
+		}
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		content, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to read page %v of %v: %w", i, path, err)
+		}
+		pages = append(pages, fmt.Sprintf("[Page %v]\n%v", i, strings.TrimSpace(content)))
+	}
+	if len(pages) == 0 {
+		return "", fmt.Errorf("no pages of %v were selected (it has %v pages)", path, reader.NumPage())
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+func extractDocxText(path string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %v: %w", path, err)
+	}
+	defer archive.Close()
+	document, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("%v is not a Word document: %w", path, err)
+	}
+	defer document.Close()
+	var paragraphs []string
+	var paragraph strings.Builder
+	decoder := xml.NewDecoder(document)
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read %v: %w", path, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				paragraphs = append(paragraphs, paragraph.String())
+				paragraph.Reset()
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(strings.Join(paragraphs, "\n")), nil
+}
+
+func (app *App) attachPDF(path string, ranges []PageRange) error {
+	text, err := extractPDFText(path, ranges)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("no text could be extracted from %v", path)
+	}
+	tokens := session.EstimateTokens(text)
+	if tokens > largeDocumentTokens {
+		app.printer.PrintWarning("the text of %v is about %v tokens long\n", path, formatTokenCount(tokens))
+		if app.reader != nil && !app.confirm("Add it to the context anyway?") {
+			return nil
+		}
+	}
+	app.appendToContext(session.NewMessage("user", fmt.Sprintf("%v:\n\n%v", path, text)))
+	return nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/providers"
+	"github.com/Sa-RSt/gptrepl/session"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultEmbeddingModel = "text-embedding-3-small"
+
+const chunkSize = 1500
+
+const embeddingBatchSize = 64
+
+type EmbeddingAPI interface {
+	Embed([]string) ([][]float32, error)
+	Model() string
+}
+
+type OpenAIEmbeddingAPI struct {
+	model  string
+	client *openai.Client
+}
+
+func newOpenAIEmbeddingAPI(key string) *OpenAIEmbeddingAPI {
+	config := openai.DefaultConfig(key)
+	config.HTTPClient = providers.NewHTTPClient()
+	return &OpenAIEmbeddingAPI{model: defaultEmbeddingModel, client: openai.NewClientWithConfig(config)}
+}
+
+func (eapi *OpenAIEmbeddingAPI) Embed(texts []string) ([][]float32, error) {
+	request := openai.EmbeddingRequestStrings{Input: texts, Model: openai.EmbeddingModel(eapi.model)}
+	response, err := eapi.client.CreateEmbeddings(context.Background(), request)
+	if err != nil {
+		return nil, fmt.Errorf("CreateEmbeddings: %w", err)
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("CreateEmbeddings: expected %v embeddings, got %v", len(texts), len(response.Data))
+	}
+	embeddings := make([][]float32, len(texts))
+	for _, data := range response.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("CreateEmbeddings: unexpected index %v", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
+
+func (eapi *OpenAIEmbeddingAPI) Model() string {
+	return eapi.model
+}
+
+func (app *App) embeddingAPI() (EmbeddingAPI, error) {
+	if app.embedder != nil {
+		return app.embedder, nil
+	}
+	key := openAIKeyFromEnvironment()
+	if app.provider == "openai" && app.apiKey != "" {
+		key = app.apiKey
+	}
+	if key == "" {
+		return nil, fmt.Errorf("embeddings require an OpenAI API key (set OPENAI_API_KEY)")
+	}
+	app.embedder = newOpenAIEmbeddingAPI(key)
+	return app.embedder, nil
+}
+
+func embedAll(eapi EmbeddingAPI, texts []string) ([][]float32, error) {
+	var embeddings [][]float32
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		batch, err := eapi.Embed(texts[start:min(start+embeddingBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		for _, embedding := range batch {
+			embeddings = append(embeddings, normalizeVector(embedding))
+		}
+	}
+	return embeddings, nil
+}
+
+func normalizeVector(vector []float32) []float32 {
+	var sum float64
+	for _, x := range vector {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return vector
+	}
+	norm := float32(math.Sqrt(sum))
+	normalized := make([]float32, len(vector))
+	for i, x := range vector {
+		normalized[i] = x / norm
+	}
+	return normalized
+}
+
+func dotProduct(a []float32, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func chunkText(text string) []string {
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			chunks = append(chunks, strings.TrimSpace(current.String()))
+		}
+		current.Reset()
+	}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if current.Len() > 0 && current.Len()+len(paragraph) > chunkSize {
+			flush()
+		}
+		for len(paragraph) > chunkSize {
+			cut := strings.LastIndexAny(paragraph[:chunkSize], "\n ")
+			if cut <= 0 {
+				cut = chunkSize
+			}
+			current.WriteString(paragraph[:cut])
+			flush()
+			paragraph = paragraph[cut:]
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(paragraph)
+	}
+	flush()
+	return chunks
+}
+
+type StoredChunk struct {
+	Source    string    `json:"source"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type ScoredChunk struct {
+	StoredChunk
+	score float32
+}
+
+type VectorStore struct {
+	path   string
+	Model  string        `json:"model"`
+	Chunks []StoredChunk `json:"chunks"`
+}
+
+func memoryStorePath() (string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(dir), "memory.json"), nil
+}
+
+func loadVectorStore(path string) (*VectorStore, error) {
+	store := &VectorStore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, store)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return store, nil
+}
+
+func (store *VectorStore) save() error {
+	data, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(store.path), 0770)
+	if err != nil {
+		return err
+	}
+	return session.WriteFileAtomically(store.path, data, 0)
+}
+
+func (store *VectorStore) add(eapi EmbeddingAPI, source string, text string) (int, error) {
+	if store.Model != "" && store.Model != eapi.Model() {
+		return 0, fmt.Errorf("%v was indexed with %v, but %v is in use", store.path, store.Model, eapi.Model())
+	}
+	chunks := chunkText(text)
+	if len(chunks) == 0 {
+		return 0, fmt.Errorf("nothing to index")
+	}
+	embeddings, err := embedAll(eapi, chunks)
+	if err != nil {
+		return 0, err
+	}
+	store.Model = eapi.Model()
+	for i, chunk := range chunks {
+		store.Chunks = append(store.Chunks, StoredChunk{Source: source, Text: chunk, Embedding: embeddings[i]})
+	}
+	return len(chunks), nil
+}
+
+func sortByScore(scored []ScoredChunk) {
+	slices.SortStableFunc(scored, func(a ScoredChunk, b ScoredChunk) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+}
+
+func (store *VectorStore) search(query []float32, k int) []ScoredChunk {
+	scored := make([]ScoredChunk, len(store.Chunks))
+	for i, chunk := range store.Chunks {
+		scored[i] = ScoredChunk{StoredChunk: chunk, score: dotProduct(query, chunk.Embedding)}
+	}
+	sortByScore(scored)
+	return scored[:min(k, len(scored))]
+}
+
+func (app *App) memoryStore() (*VectorStore, error) {
+	if app.memory != nil {
+		return app.memory, nil
+	}
+	path, err := memoryStorePath()
+	if err != nil {
+		return nil, err
+	}
+	app.memory, err = loadVectorStore(path)
+	return app.memory, err
+}
+
+func (app *App) remember(source string, text string) (int, error) {
+	store, err := app.memoryStore()
+	if err != nil {
+		return 0, err
+	}
+	eapi, err := app.embeddingAPI()
+	if err != nil {
+		return 0, err
+	}
+	count, err := store.add(eapi, source, text)
+	if err != nil {
+		return 0, err
+	}
+	return count, store.save()
+}
+
+func (app *App) recall(query string, k int) ([]ScoredChunk, error) {
+	memory, err := app.memoryStore()
+	if err != nil {
+		return nil, err
+	}
+	var stores []*VectorStore
+	for _, store := range []*VectorStore{memory, app.docs} {
+		if store != nil && len(store.Chunks) > 0 {
+			stores = append(stores, store)
+		}
+	}
+	if len(stores) == 0 {
+		return nil, nil
+	}
+	eapi, err := app.embeddingAPI()
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err := embedAll(eapi, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	var results []ScoredChunk
+	for _, store := range stores {
+		results = append(results, store.search(embeddings[0], k)...)
+	}
+	sortByScore(results)
+	return results[:min(k, len(results))], nil
+}
+
+func retrievedChunksMessage(chunks []ScoredChunk) Message {
+	var content strings.Builder
+	content.WriteString("The following excerpts were retrieved from stored notes and documents because they may be relevant to the conversation. Use them if they help answer the next question.")
+	for _, chunk := range chunks {
+		fmt.Fprintf(&content, "\n\n[%v]\n%v", chunk.Source, chunk.Text)
+	}
+	return Message{Role: "system", Content: content.String()}
+}
+
+func (app *App) withRetrievedChunks(messages []Message, pending []Message) []Message {
+	if app.ragChunks == 0 || len(pending) == 0 || pending[len(pending)-1].Role != "user" {
+		return messages
+	}
+	chunks, err := app.recall(pending[len(pending)-1].Content, int(app.ragChunks))
+	if err != nil {
+		app.printer.PrintWarning("failed to retrieve from memory: %v\n", err)
+		return messages
+	}
+	if len(chunks) == 0 {
+		return messages
+	}
+	return slices.Insert(messages, 0, retrievedChunksMessage(chunks))
+}
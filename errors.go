@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/providers"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+const (
+	exitFailure     = 1
+	exitAuth        = 3
+	exitRateLimited = 4
+	exitNetwork     = 5
+	exitStream      = 6
+	exitInterrupted = 130
+)
+
+type StreamError struct {
+	err error
+}
+
+func (e *StreamError) Error() string {
+	return e.err.Error()
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.err
+}
+
+type ErrorReport struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Provider  string `json:"provider,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+type JSONErrorPrinter struct {
+	UserPrinter
+	out io.Writer
+}
+
+func newErrorReport(err error, provider string) ErrorReport {
+	report := ErrorReport{Code: "error", Message: err.Error(), Provider: provider}
+	var requestErr *providers.APIRequestError
+	if errors.As(err, &requestErr) {
+		report.RequestID = requestErr.RequestID
+	}
+	var openaiErr *openai.APIError
+	var openaiRequestErr *openai.RequestError
+	var anthropicErr *providers.AnthropicAPIError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &openaiErr):
+		report.Code = providers.OpenAIErrorCode(openaiErr)
+		report.Retryable = providers.IsRetryableStatus(openaiErr.HTTPStatusCode)
+	case errors.As(err, &openaiRequestErr):
+		report.Code = fmt.Sprintf("http_%v", openaiRequestErr.HTTPStatusCode)
+		report.Retryable = providers.IsRetryableStatus(openaiRequestErr.HTTPStatusCode)
+	case errors.As(err, &anthropicErr):
+		report.Code = anthropicErr.Type
+		report.Retryable = providers.IsRetryableStatus(anthropicErr.StatusCode) || anthropicErr.Type == "overloaded_error"
+		if report.RequestID == "" {
+			report.RequestID = anthropicErr.RequestID
+		}
+	case errors.As(err, &netErr):
+		report.Code = "network_error"
+		report.Retryable = true
+	case errors.Is(err, ErrUnknownCommand):
+		report.Code = "unknown_command"
+	case errors.Is(err, ErrCommandDisabled):
+		report.Code = "command_disabled"
+	}
+	return report
+}
+
+func exitStatus(err error) int {
+	var streamErr *StreamError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrRetriesCanceled):
+		return exitInterrupted
+	case errors.Is(err, ErrNoProvider):
+		return exitAuth
+	case errors.As(err, &streamErr):
+		return exitStream
+	}
+	if providerErr, ok := providers.NewProviderError(err); ok {
+		switch {
+		case providerErr.Status == http.StatusUnauthorized || providerErr.Status == http.StatusForbidden || providerErr.Type == "authentication_error" || providerErr.Type == "permission_error" || providerErr.Code == "invalid_api_key":
+			return exitAuth
+		case providerErr.Status == http.StatusTooManyRequests || providerErr.Type == "rate_limit_error":
+			return exitRateLimited
+		}
+	}
+	if errors.As(err, &netErr) {
+		return exitNetwork
+	}
+	return exitFailure
+}
+
+func retryReason(err error) string {
+	var netErr net.Error
+	if providerErr, ok := providers.NewProviderError(err); ok {
+		switch {
+		case providerErr.Status == http.StatusTooManyRequests:
+			return "rate limited"
+		case providerErr.Type == "overloaded_error" || providerErr.Status == 529:
+			return "overloaded"
+		case providerErr.Status == http.StatusRequestTimeout:
+			return "timed out"
+		case providerErr.Status >= 500:
+			return fmt.Sprintf("server error %v", providerErr.Status)
+		case providerErr.Status > 0:
+			return fmt.Sprintf("status %v", providerErr.Status)
+		}
+	} else if errors.As(err, &netErr) {
+		return "network error"
+	}
+	return err.Error()
+}
+
+func (printer *JSONErrorPrinter) PrintError(format string, a ...interface{}) {
+	printer.printReport(ErrorReport{Code: "error", Message: strings.TrimSpace(fmt.Sprintf(format, a...))})
+}
+
+func (printer *JSONErrorPrinter) printReport(report ErrorReport) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(printer.out, "%s\n", data)
+}
+
+func (app *App) reportError(err error) {
+	if printer, ok := app.printer.(*JSONErrorPrinter); ok {
+		printer.printReport(newErrorReport(err, app.provider))
+		return
+	}
+	if printer, ok := app.printer.(*JSONLPrinter); ok {
+		report := newErrorReport(err, app.provider)
+		printer.emit(OutputEvent{Type: "error", Error: &report})
+		return
+	}
+	app.printer.PrintError("%v\n", err)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+var exportFormats = []string{"md", "html", "sharegpt"}
+
+var exportFormatExtensions = map[string]string{
+	".md":       "md",
+	".markdown": "md",
+	".html":     "html",
+	".htm":      "html",
+}
+
+var exportFlags = []string{"--stats", "--timestamps"}
+
+var roleTitles = map[string]string{
+	"user":      "User",
+	"assistant": "Assistant",
+	"system":    "System",
+}
+
+type ExportOptions struct {
+	title      string
+	created    time.Time
+	exported   time.Time
+	timestamps bool
+	stats      *ConversationStats
+}
+
+type ConversationStats struct {
+	Turns     int
+	Tokens    int
+	Cost      float64
+	CostKnown bool
+	Models    []string
+	Duration  time.Duration
+}
+
+func exportFormatFromPath(path string) (string, error) {
+	format, ok := exportFormatExtensions[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", fmt.Errorf("can't tell the export format of \"%v\" from its extension. Use one of: %v", path, strings.Join(exportFormats, ", "))
+	}
+	return format, nil
+}
+
+func cutExportFlags(args string) (string, []string) {
+	var flags []string
+	for {
+		i := strings.LastIndex(args, " ")
+		if i < 0 || !slices.Contains(exportFlags, args[i+1:]) {
+			return args, flags
+		}
+		flags = append(flags, args[i+1:])
+		args = strings.TrimSpace(args[:i])
+	}
+}
+
+func (app *App) exportOptions(ctx []Message, flags []string) ExportOptions {
+	options := ExportOptions{title: app.title, created: app.created, exported: time.Now()}
+	if options.title == "" {
+		options.title = "Conversation"
+	}
+	options.timestamps = slices.Contains(flags, "--timestamps")
+	if slices.Contains(flags, "--stats") {
+		stats := app.conversationStats(ctx)
+		options.stats = &stats
+	}
+	return options
+}
+
+func (app *App) conversationStats(ctx []Message) ConversationStats {
+	stats := ConversationStats{CostKnown: true}
+	var first, last time.Time
+	input := 0
+	for _, msg := range ctx {
+		tokens := session.EstimateTokens(msg.Content)
+		if msg.OutputTokens > 0 {
+			tokens = msg.OutputTokens
+		}
+		stats.Tokens += tokens
+		switch msg.Role {
+		case "user":
+			stats.Turns++
+		case "assistant":
+			model := msg.Model
+			if model == "" {
+				model = app.model
+			}
+			if !slices.Contains(stats.Models, model) {
+				stats.Models = append(stats.Models, model)
+			}
+			prompt := input
+			if msg.InputTokens > 0 {
+				prompt = msg.InputTokens
+			}
+			prices, known := modelPrices(model)
+			stats.CostKnown = stats.CostKnown && known
+			stats.Cost += (float64(prompt)*prices[0] + float64(tokens)*prices[1]) / 1000000
+		}
+		input += tokens
+		if msg.Time != nil {
+			if first.IsZero() || msg.Time.Before(first) {
+				first = *msg.Time
+			}
+			if end := msg.Time.Add(time.Duration(msg.DurationMs) * time.Millisecond); end.After(last) {
+				last = end
+			}
+		}
+	}
+	if len(stats.Models) == 0 {
+		stats.Models = []string{app.model}
+		_, stats.CostKnown = modelPrices(app.model)
+	}
+	stats.Duration = last.Sub(first).Round(time.Second)
+	return stats
+}
+
+func (app *App) exportContext(format string, path string, ctx []Message, options ExportOptions) error {
+	var data string
+	switch format {
+	case "md":
+		data = markdownRepresentation(ctx, options)
+	case "html":
+		data = htmlRepresentation(ctx, options)
+	case "sharegpt":
+		marshaled, err := shareGPTRepresentation(ctx, options.title)
+		if err != nil {
+			return err
+		}
+		data = string(marshaled)
+	default:
+		return fmt.Errorf("unknown export format '%v'. Use one of: %v", format, strings.Join(exportFormats, ", "))
+	}
+	return os.WriteFile(path, []byte(data), 0660)
+}
+
+func markdownRepresentation(ctx []Message, options ExportOptions) string {
+	var result bytes.Buffer
+	fmt.Fprintf(&result, "# %v\n\n", options.title)
+	if options.timestamps {
+		if !options.created.IsZero() {
+			fmt.Fprintf(&result, "*Started on %v.* ", options.created.Local().Format(time.DateTime))
+		}
+		fmt.Fprintf(&result, "*Exported on %v.*\n\n", options.exported.Local().Format(time.DateTime))
+	}
+	for _, msg := range ctx {
+		fmt.Fprintf(&result, "## %v\n\n", roleTitles[msg.Role])
+		if options.timestamps && msg.Time != nil {
+			fmt.Fprintf(&result, "*%v*\n\n", msg.Time.Local().Format(time.DateTime))
+		}
+		content := strings.TrimSpace(msg.Content)
+		result.WriteString(content)
+		result.WriteString("\n")
+		if hasUnclosedFence(content) {
+			result.WriteString("```\n")
+		}
+		result.WriteString("\n")
+	}
+	if options.stats != nil {
+		result.WriteString("---\n\n")
+		result.WriteString("| Turns | Tokens (estimated) | Cost (estimated) | Models | Duration |\n")
+		result.WriteString("| --- | --- | --- | --- | --- |\n")
+		fmt.Fprintf(&result, "| %v | %v | %v | %v | %v |\n", options.stats.Turns, formatTokenCount(options.stats.Tokens), options.stats.formatCost(), strings.Join(options.stats.Models, ", "), options.stats.formatDuration())
+	}
+	return result.String()
+}
+
+func hasUnclosedFence(content string) bool {
+	open := false
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			open = !open
+		}
+	}
+	return open
+}
+
+func (stats *ConversationStats) formatCost() string {
+	if !stats.CostKnown {
+		return "unknown"
+	}
+	return fmt.Sprintf("$%.4f", stats.Cost)
+}
+
+func (stats *ConversationStats) formatDuration() string {
+	if stats.Duration == 0 {
+		return "unknown"
+	}
+	return stats.Duration.String()
+}
+
+type contentBlock struct {
+	code     bool
+	language string
+	text     string
+}
+
+func splitCodeBlocks(content string) []contentBlock {
+	var blocks []contentBlock
+	current := contentBlock{}
+	var lines []string
+	flush := func() {
+		if current.code || len(lines) > 0 {
+			current.text = strings.Join(lines, "\n")
+			blocks = append(blocks, current)
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(content, "\n") {
+		fence, isFence := strings.CutPrefix(strings.TrimSpace(line), "```")
+		switch {
+		case isFence && current.code:
+			flush()
+			current = contentBlock{}
+		case isFence:
+			flush()
+			current = contentBlock{code: true, language: strings.TrimSpace(fence)}
+		default:
+			lines = append(lines, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+const htmlExportStyle = `body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; color: #222; line-height: 1.5; }
+.message { margin: 1.5em 0; }
+.badge { display: inline-block; padding: 0.1em 0.6em; border-radius: 0.8em; font-size: 0.8em; font-weight: bold; color: #fff; }
+.badge.user { background: #2a6fdb; }
+.badge.assistant { background: #2e8b57; }
+.badge.system { background: #777; }
+pre { background: #f5f5f5; padding: 0.8em; overflow-x: auto; border-radius: 0.3em; }
+code { font-family: monospace; }
+.kw { color: #a626a4; font-weight: bold; }
+.str { color: #50a14f; }
+.com { color: #a0a1a7; font-style: italic; }
+.num { color: #986801; }
+.meta { color: #777; font-size: 0.9em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.8em; }`
+
+var htmlTokenClasses = map[codeTokenKind]string{
+	tokenKeyword: "kw",
+	tokenString:  "str",
+	tokenComment: "com",
+	tokenNumber:  "num",
+}
+
+func htmlRepresentation(ctx []Message, options ExportOptions) string {
+	var result bytes.Buffer
+	title := html.EscapeString(options.title)
+	fmt.Fprintf(&result, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%v</title>\n<style>\n%v\n</style>\n</head>\n<body>\n<h1>%v</h1>\n", title, htmlExportStyle, title)
+	if options.timestamps {
+		result.WriteString("<p class=\"meta\">")
+		if !options.created.IsZero() {
+			fmt.Fprintf(&result, "Started on %v. ", options.created.Local().Format(time.DateTime))
+		}
+		fmt.Fprintf(&result, "Exported on %v.</p>\n", options.exported.Local().Format(time.DateTime))
+	}
+	for _, msg := range ctx {
+		badge := fmt.Sprintf("<span class=\"badge %v\">%v</span>", msg.Role, roleTitles[msg.Role])
+		if msg.Role == "system" {
+			fmt.Fprintf(&result, "<details class=\"message\">\n<summary>%v</summary>\n", badge)
+		} else {
+			fmt.Fprintf(&result, "<div class=\"message\">\n%v\n", badge)
+		}
+		if options.timestamps && msg.Time != nil {
+			fmt.Fprintf(&result, "<span class=\"meta\">%v</span>\n", msg.Time.Local().Format(time.DateTime))
+		}
+		for _, block := range splitCodeBlocks(strings.TrimSpace(msg.Content)) {
+			result.WriteString(htmlBlock(block))
+		}
+		if msg.Role == "system" {
+			result.WriteString("</details>\n")
+		} else {
+			result.WriteString("</div>\n")
+		}
+	}
+	if options.stats != nil {
+		stats := options.stats
+		result.WriteString("<hr>\n<table>\n<tr><th>Turns</th><th>Tokens (estimated)</th><th>Cost (estimated)</th><th>Models</th><th>Duration</th></tr>\n")
+		fmt.Fprintf(&result, "<tr><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>\n</table>\n", stats.Turns, formatTokenCount(stats.Tokens), stats.formatCost(), html.EscapeString(strings.Join(stats.Models, ", ")), stats.formatDuration())
+	}
+	result.WriteString("</body>\n</html>\n")
+	return result.String()
+}
+
+func htmlBlock(block contentBlock) string {
+	if block.code {
+		var code bytes.Buffer
+		for _, token := range tokenizeCode(block.text, block.language) {
+			if class, ok := htmlTokenClasses[token.kind]; ok {
+				fmt.Fprintf(&code, "<span class=\"%v\">%v</span>", class, html.EscapeString(token.text))
+			} else {
+				code.WriteString(html.EscapeString(token.text))
+			}
+		}
+		return fmt.Sprintf("<pre><code>%v</code></pre>\n", code.String())
+	}
+	var result bytes.Buffer
+	for _, paragraph := range strings.Split(block.text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		fmt.Fprintf(&result, "<p>%v</p>\n", htmlInline(paragraph))
+	}
+	return result.String()
+}
+
+func htmlInline(text string) string {
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		if i%2 == 1 && i < len(parts)-1 {
+			parts[i] = "<code>" + html.EscapeString(part) + "</code>"
+		} else if i%2 == 1 {
+			parts[i] = "`" + strings.ReplaceAll(html.EscapeString(part), "\n", "<br>\n")
+		} else {
+			parts[i] = strings.ReplaceAll(html.EscapeString(part), "\n", "<br>\n")
+		}
+	}
+	return strings.Join(parts, "")
+}
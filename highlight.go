@@ -0,0 +1,217 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+type codeTokenKind int
+
+const (
+	tokenPlain codeTokenKind = iota
+	tokenKeyword
+	tokenString
+	tokenComment
+	tokenNumber
+)
+
+type codeToken struct {
+	kind codeTokenKind
+	text string
+}
+
+var codeKeywords = []string{
+	"and", "as", "async", "await", "break", "case", "catch", "class", "const", "continue", "def", "default", "defer", "del", "do",
+	"elif", "else", "enum", "except", "export", "extends", "false", "False", "finally", "fn", "for", "from", "func", "function", "go",
+	"if", "impl", "import", "in", "interface", "is", "lambda", "let", "loop", "map", "match", "mut", "new", "nil", "None", "not",
+	"null", "or", "package", "pass", "pub", "raise", "range", "return", "select", "self", "static", "struct", "super", "switch",
+	"then", "this", "throw", "trait", "true", "True", "try", "type", "typeof", "use", "var", "void", "while", "with", "yield",
+	"fi", "done", "esac", "echo", "local",
+}
+
+var hashCommentLanguages = []string{"python", "py", "sh", "bash", "shell", "zsh", "ruby", "rb", "yaml", "yml", "perl", "r", "toml", "dockerfile", "makefile", "conf"}
+
+var dashCommentLanguages = []string{"sql", "lua", "haskell", "hs"}
+
+func tokenizeCode(code string, language string) []codeToken {
+	language = strings.ToLower(language)
+	hashComments := slices.Contains(hashCommentLanguages, language)
+	dashComments := slices.Contains(dashCommentLanguages, language)
+	var tokens []codeToken
+	emit := func(kind codeTokenKind, text string) {
+		if len(tokens) > 0 && tokens[len(tokens)-1].kind == kind && kind == tokenPlain {
+			tokens[len(tokens)-1].text += text
+			return
+		}
+		tokens = append(tokens, codeToken{kind, text})
+	}
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		switch {
+		case strings.HasPrefix(rest, "//") || (hashComments && rest[0] == '#') || (dashComments && strings.HasPrefix(rest, "--")):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			emit(tokenComment, rest[:end])
+			i += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += 4
+			}
+			emit(tokenComment, rest[:end])
+			i += end
+		case rest[0] == '"' || rest[0] == '\'' || rest[0] == '`':
+			end := stringLiteralEnd(rest)
+			emit(tokenString, rest[:end])
+			i += end
+		case isIdentifierStart(rest[0]):
+			end := 1
+			for end < len(rest) && (isIdentifierStart(rest[end]) || unicode.IsDigit(rune(rest[end]))) {
+				end++
+			}
+			if slices.Contains(codeKeywords, rest[:end]) {
+				emit(tokenKeyword, rest[:end])
+			} else {
+				emit(tokenPlain, rest[:end])
+			}
+			i += end
+		case unicode.IsDigit(rune(rest[0])):
+			end := 1
+			for end < len(rest) && (unicode.IsDigit(rune(rest[end])) || rest[end] == '.' || rest[end] == '_' || unicode.IsLetter(rune(rest[end]))) {
+				end++
+			}
+			emit(tokenNumber, rest[:end])
+			i += end
+		default:
+			emit(tokenPlain, rest[:1])
+			i++
+		}
+	}
+	return tokens
+}
+
+func stringLiteralEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote != '`':
+			i++
+		case s[i] == quote:
+			return i + 1
+		case s[i] == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(s)
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func terminalTokenColors() map[codeTokenKind]*color.Color {
+	return map[codeTokenKind]*color.Color{
+		tokenKeyword: theme.Keyword,
+		tokenString:  theme.String,
+		tokenComment: theme.Dim,
+		tokenNumber:  theme.Number,
+	}
+}
+
+type CodeHighlighter struct {
+	pending     string
+	lineStarted bool
+	inCode      bool
+	language    string
+	code        strings.Builder
+	shown       int
+}
+
+func highlightCodeBlocks(content string) string {
+	var h CodeHighlighter
+	return h.write(content) + h.flush()
+}
+
+func couldBeFence(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	return strings.HasPrefix("```", trimmed) || strings.HasPrefix(trimmed, "```")
+}
+
+func (h *CodeHighlighter) write(text string) string {
+	var out strings.Builder
+	for {
+		before, after, complete := strings.Cut(text, "\n")
+		h.pending += before
+		if !complete {
+			if !h.inCode && h.pending != "" && (h.lineStarted || !couldBeFence(h.pending)) {
+				out.WriteString(h.pending)
+				h.pending = ""
+				h.lineStarted = true
+			}
+			return out.String()
+		}
+		out.WriteString(h.endLine(true))
+		text = after
+	}
+}
+
+func (h *CodeHighlighter) flush() string {
+	var out string
+	if h.pending != "" {
+		out = h.endLine(false)
+	}
+	*h = CodeHighlighter{}
+	return out
+}
+
+func (h *CodeHighlighter) endLine(newline bool) string {
+	line := h.pending
+	if newline {
+		line += "\n"
+	}
+	started := h.lineStarted
+	h.pending = ""
+	h.lineStarted = false
+	if started {
+		return line
+	}
+	if fence, isFence := strings.CutPrefix(strings.TrimSpace(line), "```"); isFence {
+		h.inCode = !h.inCode
+		h.language = strings.TrimSpace(fence)
+		h.code.Reset()
+		h.shown = 0
+		return line
+	}
+	if !h.inCode {
+		return line
+	}
+	h.code.WriteString(line)
+	return h.highlightNewCode()
+}
+
+func (h *CodeHighlighter) highlightNewCode() string {
+	var out strings.Builder
+	colors := terminalTokenColors()
+	start := 0
+	for _, token := range tokenizeCode(h.code.String(), h.language) {
+		end := start + len(token.text)
+		if end > h.shown {
+			text := token.text[max(h.shown-start, 0):]
+			if c, ok := colors[token.kind]; ok {
+				out.WriteString(c.Sprint(text))
+			} else {
+				out.WriteString(text)
+			}
+		}
+		start = end
+	}
+	h.shown = h.code.Len()
+	return out.String()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type HookConfig struct {
+	BeforeSend    string `json:"before_send"`
+	AfterResponse string `json:"after_response"`
+}
+
+func (app *App) runHook(name string, command string, input []byte) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := shellExec(command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "GPTREPL_MODEL="+app.model, "GPTREPL_HOOK="+name)
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("the %v hook failed: %w: %v", name, err, message)
+		}
+		return "", fmt.Errorf("the %v hook failed: %w", name, err)
+	}
+	return stdout.String(), nil
+}
+
+func (app *App) runBeforeSendHook(messages []Message) ([]Message, error) {
+	if app.config.Hook.BeforeSend == "" {
+		return messages, nil
+	}
+	input, err := json.Marshal(contextFileEnvelope{Version: contextFileVersion, Metadata: app.contextMetadata(), Messages: messages})
+	if err != nil {
+		return nil, err
+	}
+	output, err := app.runHook("before_send", app.config.Hook.BeforeSend, input)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(output) == "" {
+		return messages, nil
+	}
+	modified, ok := parsePluginContext([]byte(output))
+	if !ok || len(modified) == 0 {
+		return nil, fmt.Errorf("the before_send hook printed something that isn't a context")
+	}
+	return modified, nil
+}
+
+func (app *App) runAfterResponseHook(response string) (string, error) {
+	if app.config.Hook.AfterResponse == "" {
+		return response, nil
+	}
+	output, err := app.runHook("after_response", app.config.Hook.AfterResponse, []byte(response))
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(output) == "" {
+		return response, nil
+	}
+	output = strings.TrimRight(output, "\r\n")
+	if output != response && !app.quiet {
+		app.printer.Print("%v\n%v\n", theme.Dim.Sprint("The answer was changed by the after_response hook to:"), output)
+	}
+	return output, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+var importFormats = []string{"chatgpt", "sharegpt"}
+
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CurrentNode string                 `json:"current_node"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Parent  string          `json:"parent"`
+	Message *chatGPTMessage `json:"message"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	Content struct {
+		ContentType string `json:"content_type"`
+		Parts       []any  `json:"parts"`
+	} `json:"content"`
+}
+
+type shareGPTConversation struct {
+	ID            string            `json:"id,omitempty"`
+	Conversations []shareGPTMessage `json:"conversations"`
+}
+
+type shareGPTMessage struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+var shareGPTRoles = map[string]string{
+	"human":     "user",
+	"user":      "user",
+	"gpt":       "assistant",
+	"chatgpt":   "assistant",
+	"assistant": "assistant",
+	"bing":      "assistant",
+	"bard":      "assistant",
+	"system":    "system",
+}
+
+type importedConversation struct {
+	title    string
+	messages []Message
+}
+
+func readImportFile(format string, path string) ([]importedConversation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "chatgpt":
+		var conversations []chatGPTConversation
+		err = json.Unmarshal(data, &conversations)
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a ChatGPT export (conversations.json): %w", path, err)
+		}
+		imported := make([]importedConversation, len(conversations))
+		for i, conversation := range conversations {
+			imported[i] = importedConversation{title: conversation.Title, messages: conversation.messages()}
+		}
+		return imported, nil
+	case "sharegpt":
+		var conversations []shareGPTConversation
+		err = json.Unmarshal(data, &conversations)
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a ShareGPT dataset: %w", path, err)
+		}
+		imported := make([]importedConversation, len(conversations))
+		for i, conversation := range conversations {
+			messages, err := conversation.messages()
+			if err != nil {
+				return nil, fmt.Errorf("conversation #%v: %w", i+1, err)
+			}
+			imported[i] = importedConversation{title: conversation.ID, messages: messages}
+		}
+		return imported, nil
+	}
+	return nil, fmt.Errorf("unknown import format '%v'. Use one of: %v", format, strings.Join(importFormats, ", "))
+}
+
+func (conversation *chatGPTConversation) messages() []Message {
+	var messages []Message
+	for id := conversation.CurrentNode; id != ""; id = conversation.Mapping[id].Parent {
+		node, ok := conversation.Mapping[id]
+		if !ok {
+			break
+		}
+		if node.Message == nil || !session.IsRoleValid(node.Message.Author.Role) {
+			continue
+		}
+		var parts []string
+		for _, part := range node.Message.Content.Parts {
+			if text, ok := part.(string); ok && text != "" {
+				parts = append(parts, text)
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		messages = append(messages, Message{Role: node.Message.Author.Role, Content: strings.Join(parts, "\n")})
+	}
+	slices.Reverse(messages)
+	return messages
+}
+
+func (conversation *shareGPTConversation) messages() ([]Message, error) {
+	messages := make([]Message, len(conversation.Conversations))
+	for i, msg := range conversation.Conversations {
+		role, ok := shareGPTRoles[msg.From]
+		if !ok {
+			return nil, fmt.Errorf("message #%v has an unknown \"from\" attribute: %v", i+1, msg.From)
+		}
+		messages[i] = Message{Role: role, Content: msg.Value}
+	}
+	return messages, nil
+}
+
+func shareGPTRepresentation(ctx []Message, id string) ([]byte, error) {
+	conversation := shareGPTConversation{ID: id, Conversations: make([]shareGPTMessage, len(ctx))}
+	for i, msg := range ctx {
+		from := map[string]string{"user": "human", "assistant": "gpt", "system": "system"}[msg.Role]
+		conversation.Conversations[i] = shareGPTMessage{From: from, Value: msg.Content}
+	}
+	return json.MarshalIndent([]shareGPTConversation{conversation}, "", "\t")
+}
+
+func cutConversationNumber(args string) (string, int) {
+	i := strings.LastIndex(args, " ")
+	if i < 0 {
+		return args, 0
+	}
+	n, err := strconv.Atoi(args[i+1:])
+	if err != nil || n < 1 {
+		return args, 0
+	}
+	return strings.TrimSpace(args[:i]), n
+}
+
+func (app *App) importConversation(format string, path string, number int) error {
+	conversations, err := readImportFile(format, path)
+	if err != nil {
+		return err
+	}
+	if len(conversations) == 0 {
+		return fmt.Errorf("%v has no conversations", path)
+	}
+	if number == 0 && len(conversations) > 1 {
+		for i, conversation := range conversations {
+			app.printer.Print("%v. %v (%v messages)\n", i+1, conversation.title, len(conversation.messages))
+		}
+		return fmt.Errorf("%v has %v conversations. Choose one by adding its number (e.g. /import %v %v 2)", path, len(conversations), format, path)
+	}
+	if number == 0 {
+		number = 1
+	}
+	if number > len(conversations) {
+		return fmt.Errorf("%v has only %v conversations", path, len(conversations))
+	}
+	app.setContext(conversations[number-1].messages)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"slices"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+func (app *App) appendToJournal() error {
+	common := 0
+	for common < len(app.journaled) && common < len(app.context) && app.journaled[common] == app.context[common] {
+		common++
+	}
+	var events []session.JournalEvent
+	if common < len(app.journaled) {
+		events = append(events, session.JournalEvent{Op: "truncate", Length: &common})
+	}
+	for i := common; i < len(app.context); i++ {
+		events = append(events, session.JournalEvent{Op: "append", Message: &app.context[i]})
+	}
+	metadata := app.contextMetadata()
+	if !sameMetadata(metadata, app.journaledMetadata) {
+		events = append(events, session.JournalEvent{Op: "metadata", Metadata: &metadata})
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	data, err := session.MarshalJournalEvents(events)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(app.autosaveFilePath, os.O_WRONLY|os.O_APPEND, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	app.journaled = app.context
+	app.journaledMetadata = metadata
+	return nil
+}
+
+func sameMetadata(a ContextMetadata, b ContextMetadata) bool {
+	a.Updated, b.Updated = nil, nil
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return bytes.Equal(aJSON, bJSON)
+}
+
+func (app *App) compactJournal() error {
+	if app.journalPath == "" || app.journalPath != app.autosaveFilePath {
+		return nil
+	}
+	unlock, err := lockFile(app.autosaveFilePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if app.autosaveChangedExternally() {
+		return nil
+	}
+	return app.rewriteAutosaveFile()
+}
+
+func (app *App) rewriteAutosaveFile() error {
+	metadata := app.contextMetadata()
+	err := writeContextFileWithBackups(app.autosaveFilePath, app.context, metadata, int(app.autosaveBackups))
+	if err != nil {
+		return err
+	}
+	app.resumeJournal(metadata)
+	return nil
+}
+
+func (app *App) resumeJournal(metadata ContextMetadata) {
+	app.journalPath = ""
+	if contextFileFormat(app.autosaveFilePath) == "jsonl" {
+		app.journalPath = app.autosaveFilePath
+		app.journaled = slices.Clip(app.context)
+		app.journaledMetadata = metadata
+	}
+}
+
+func (app *App) compactJournals() {
+	app.storeActiveTab()
+	active := app.activeTab
+	for i := range app.tabs {
+		app.Conversation = app.tabs[i]
+		err := app.compactJournal()
+		if err != nil {
+			app.printer.PrintError("failed to compact \"%v\": %v\n", app.autosaveFilePath, err)
+		}
+		app.tabs[i] = app.Conversation
+	}
+	app.Conversation = app.tabs[active]
+}
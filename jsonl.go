@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+var outputFormats = []string{"text", "jsonl"}
+
+type OutputEvent struct {
+	Type    string       `json:"type"`
+	Text    string       `json:"text,omitempty"`
+	Content string       `json:"content,omitempty"`
+	Model   string       `json:"model,omitempty"`
+	Command string       `json:"command,omitempty"`
+	OK      *bool        `json:"ok,omitempty"`
+	Error   *ErrorReport `json:"error,omitempty"`
+	Usage   *UsageEvent  `json:"usage,omitempty"`
+}
+
+type UsageEvent struct {
+	PromptTokens     int   `json:"prompt_tokens"`
+	CompletionTokens int   `json:"completion_tokens"`
+	FirstTokenMs     int64 `json:"first_token_ms"`
+	DurationMs       int64 `json:"duration_ms"`
+}
+
+type JSONLPrinter struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func (printer *JSONLPrinter) emit(event OutputEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	printer.mu.Lock()
+	defer printer.mu.Unlock()
+	fmt.Fprintf(printer.out, "%s\n", data)
+}
+
+func (printer *JSONLPrinter) Print(format string, a ...interface{}) {
+	printer.emit(OutputEvent{Type: "output", Text: fmt.Sprintf(format, a...)})
+}
+
+func (printer *JSONLPrinter) PrintWarning(format string, a ...interface{}) {
+	printer.emit(OutputEvent{Type: "warning", Text: fmt.Sprintf(format, a...)})
+}
+
+func (printer *JSONLPrinter) PrintError(format string, a ...interface{}) {
+	printer.emit(OutputEvent{Type: "error", Error: &ErrorReport{Code: "error", Message: fmt.Sprintf(format, a...)}})
+}
+
+func (app *App) emitEvent(event OutputEvent) {
+	if printer, ok := app.printer.(*JSONLPrinter); ok {
+		printer.emit(event)
+	}
+}
+
+func (app *App) emitCommandResult(command string, err error) {
+	ok := err == nil
+	app.emitEvent(OutputEvent{Type: "command", Command: command, OK: &ok})
+}
+
+func (app *App) emitCompletion(messages []Message, content string, observer *ProgressObserver) {
+	if _, ok := app.printer.(*JSONLPrinter); !ok {
+		return
+	}
+	usage := UsageEvent{CompletionTokens: session.EstimateTokens(content)}
+	for _, msg := range messages {
+		usage.PromptTokens += session.EstimateTokens(msg.Content)
+	}
+	if !observer.first.IsZero() {
+		usage.FirstTokenMs = observer.first.Sub(observer.start).Milliseconds()
+	}
+	usage.DurationMs = observer.elapsed().Milliseconds()
+	app.emitEvent(OutputEvent{Type: "completion", Content: content, Model: app.model})
+	app.emitEvent(OutputEvent{Type: "usage", Usage: &usage})
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+)
+
+type CommandHintPainter struct {
+	app *App
+}
+
+type CommandCompleter struct {
+	app *App
+}
+
+type LineEditor struct {
+	*readline.Instance
+	printer       UserPrinter
+	editText      func(string) (string, error)
+	prompt        string
+	normalMode    bool
+	ctrlXPending  bool
+	editRequested bool
+	stdin         *InjectableStdin
+	queue         chan string
+	draft         string
+	injected      bool
+	mu            sync.Mutex
+	status        string
+	shownStatus   string
+}
+
+const charCtrlX = 24
+
+func (app *App) newLineEditor() (*LineEditor, error) {
+	editor := &LineEditor{printer: app.printer, editText: presentTextEditor}
+	config := &readline.Config{
+		Painter:             &CommandHintPainter{app},
+		AutoComplete:        &CommandCompleter{app},
+		VimMode:             app.viMode,
+		FuncFilterInputRune: editor.filterInputRune,
+		FuncOnWidthChanged: func(onWidthChanged func()) {
+			readline.DefaultOnWidthChanged(func() {
+				onWidthChanged()
+				editor.redraw()
+			})
+		},
+	}
+	if app.controlEnabled {
+		editor.stdin = newInjectableStdin(readline.Stdin)
+		editor.queue = make(chan string, maxQueuedControlLines)
+		config.Stdin = editor.stdin
+	}
+	instance, err := readline.NewEx(config)
+	if err != nil {
+		return nil, err
+	}
+	editor.Instance = instance
+	return editor, nil
+}
+
+func (editor *LineEditor) printStatus(status string) {
+	width, _, _ := terminalSize()
+	editor.mu.Lock()
+	defer editor.mu.Unlock()
+	editor.status = status
+	editor.shownStatus = fitStatusLine(status, width)
+	editor.printer.Print("%v\n", theme.Dim.Sprint(editor.shownStatus))
+}
+
+func (editor *LineEditor) forgetStatus() {
+	editor.mu.Lock()
+	defer editor.mu.Unlock()
+	editor.status = ""
+	editor.shownStatus = ""
+}
+
+func (editor *LineEditor) redraw() {
+	editor.mu.Lock()
+	defer editor.mu.Unlock()
+	width, _, ok := terminalSize()
+	if !ok || !editor.Terminal.IsReading() || !editor.Operation.IsNormalMode() {
+		return
+	}
+	editor.Clean()
+	if editor.shownStatus != "" {
+		rows := max((utf8.RuneCountInString(editor.shownStatus)+width-1)/width, 1)
+		editor.shownStatus = fitStatusLine(editor.status, width)
+		fmt.Fprintf(editor.Config.Stdout, "\x1b[%vA\r\x1b[J%v\r\n", rows, theme.Dim.Sprint(editor.shownStatus))
+	}
+	editor.Refresh()
+}
+
+func (editor *LineEditor) Readline() (string, error) {
+	defer editor.forgetStatus()
+	line, err := editor.Instance.ReadlineWithDefault(editor.draft)
+	editor.draft = ""
+	if err == nil && editor.injected {
+		editor.injected = false
+		editor.draft = line
+		line = <-editor.queue
+		editor.printer.Print("%v %v\n", theme.Dim.Sprint("gptreplctl:"), line)
+		return line, nil
+	}
+	for err == nil && editor.editRequested {
+		editor.editRequested = false
+		var submit bool
+		line, submit = editor.editLine(line)
+		if submit {
+			return line, nil
+		}
+		line, err = editor.Instance.ReadlineWithDefault(line)
+	}
+	return line, err
+}
+
+func (editor *LineEditor) editLine(line string) (string, bool) {
+	edited, err := editor.editText(line)
+	if err != nil {
+		editor.printer.PrintError("%v\n", err)
+		return line, false
+	}
+	edited = strings.TrimRight(edited, "\r\n")
+	return edited, strings.Contains(edited, "\n")
+}
+
+func (editor *LineEditor) filterInputRune(r rune) (rune, bool) {
+	if r == controlRune {
+		editor.injected = true
+		return readline.CharEnter, true
+	}
+	if editor.ctrlXPending {
+		editor.ctrlXPending = false
+		if r == readline.CharLineEnd {
+			editor.editRequested = true
+			r = readline.CharEnter
+		}
+	} else if r == charCtrlX {
+		editor.ctrlXPending = true
+		return r, false
+	} else if r == 'v' && editor.Instance != nil && editor.IsVimMode() && editor.normalMode {
+		editor.editRequested = true
+		r = readline.CharEnter
+	}
+	return editor.trackVimMode(r)
+}
+
+func (editor *LineEditor) SetPrompt(prompt string) {
+	editor.prompt = prompt
+	editor.Instance.SetPrompt(editor.modeIndicator() + prompt)
+}
+
+func (editor *LineEditor) SetVimMode(on bool) {
+	editor.Instance.SetVimMode(on)
+	editor.normalMode = false
+	editor.SetPrompt(editor.prompt)
+}
+
+func (editor *LineEditor) modeIndicator() string {
+	if !editor.IsVimMode() {
+		return ""
+	}
+	if editor.normalMode {
+		return theme.NormalMode.Sprint("[N]") + " "
+	}
+	return theme.InsertMode.Sprint("[I]") + " "
+}
+
+func (editor *LineEditor) trackVimMode(r rune) (rune, bool) {
+	if editor.Instance == nil || !editor.IsVimMode() {
+		return r, true
+	}
+	normalMode := editor.normalMode
+	if !normalMode {
+		normalMode = r == readline.CharEsc
+	} else {
+		switch r {
+		case 'i', 'I', 'a', 'A', 's', 'S', 'c', readline.CharEnter, readline.CharInterrupt:
+			normalMode = false
+		}
+	}
+	if normalMode != editor.normalMode {
+		editor.normalMode = normalMode
+		editor.SetPrompt(editor.prompt)
+		editor.Refresh()
+	}
+	return r, true
+}
+
+func (painter *CommandHintPainter) Paint(line []rune, pos int) []rune {
+	if pos != len(line) {
+		return line
+	}
+	hint := painter.app.commandHint(string(line))
+	if hint == "" {
+		return line
+	}
+	painted := make([]rune, 0, len(line)+len(hint)+16)
+	painted = append(painted, line...)
+	painted = append(painted, []rune(theme.Dim.Sprint(hint))...)
+	painted = append(painted, []rune(fmt.Sprintf("\033[%vD", len([]rune(hint))))...)
+	return painted
+}
+
+func (app *App) commandHint(line string) string {
+	if app.slashCommandsDisabled || !strings.HasPrefix(line, "/") {
+		return ""
+	}
+	name, arguments, hasArguments := strings.Cut(line[1:], " ")
+	if !hasArguments {
+		var matches []string
+		for candidate := range app.commandHandlers {
+			if strings.HasPrefix(candidate, name) && app.config.isCommandEnabled(candidate) {
+				matches = append(matches, candidate)
+			}
+		}
+		if len(matches) != 1 {
+			return ""
+		}
+		name = matches[0]
+		signature := formatCommandArgs(app.commandHandlers[name].args, fmt.Sprint)
+		if signature == "" {
+			return name[len(line)-1:]
+		}
+		return name[len(line)-1:] + " " + signature
+	}
+	command, ok := app.commandHandlers[name]
+	if !ok || !app.config.isCommandEnabled(name) {
+		return ""
+	}
+	typed := len(strings.Fields(arguments))
+	if typed > 0 && !strings.HasSuffix(arguments, " ") {
+		return ""
+	}
+	if typed >= len(command.args) {
+		return ""
+	}
+	return formatCommandArgs(command.args[typed:], fmt.Sprint)
+}
+
+func formatCommandArgs(args [][]string, colorize func(...interface{}) string) string {
+	formatted := make([]string, len(args))
+	for i, choices := range args {
+		colored := make([]string, len(choices))
+		for j, choice := range choices {
+			colored[j] = colorize(choice)
+		}
+		formatted[i] = fmt.Sprintf("<%v>", strings.Join(colored, "|"))
+	}
+	return strings.Join(formatted, " ")
+}
+
+func (completer *CommandCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	candidates, word := completer.app.completionCandidates(string(line[:pos]))
+	var suffixes [][]rune
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) && candidate != word {
+			suffixes = append(suffixes, []rune(candidate[len(word):]))
+		}
+	}
+	return suffixes, len([]rune(word))
+}
+
+func (app *App) completionCandidates(typed string) ([]string, string) {
+	if app.slashCommandsDisabled || !strings.HasPrefix(typed, "/") {
+		return nil, ""
+	}
+	name, arguments, hasArguments := strings.Cut(typed[1:], " ")
+	if !hasArguments {
+		var names []string
+		for candidate := range app.commandHandlers {
+			if app.config.isCommandEnabled(candidate) {
+				names = append(names, candidate+" ")
+			}
+		}
+		slices.Sort(names)
+		return names, name
+	}
+	command, ok := app.commandHandlers[name]
+	if !ok || !app.config.isCommandEnabled(name) {
+		return nil, ""
+	}
+	fields := strings.Fields(arguments)
+	word := ""
+	if len(fields) > 0 && !strings.HasSuffix(arguments, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+	argIndex := 0
+	for _, field := range fields {
+		if argIndex < len(command.args) && isOptionalArg(command.args[argIndex]) && !slices.Contains(argChoices(command.args[argIndex]), field) {
+			argIndex++
+		}
+		argIndex++
+	}
+	if argIndex >= len(command.args) {
+		return nil, word
+	}
+	candidates := app.argCandidates(command.args[argIndex], word)
+	if isOptionalArg(command.args[argIndex]) && argIndex+1 < len(command.args) {
+		candidates = append(candidates, app.argCandidates(command.args[argIndex+1], word)...)
+	}
+	return candidates, word
+}
+
+func (app *App) argCandidates(choices []string, word string) []string {
+	names := argChoices(choices)
+	if len(names) > 1 || strings.HasPrefix(names[0], "-") {
+		return names
+	}
+	switch names[0] {
+	case "path":
+		return pathCandidates(word)
+	case "model-name":
+		models := slices.Clone(app.modelListCache)
+		if !slices.Contains(models, app.model) {
+			models = append(models, app.model)
+		}
+		for alias := range app.modelAliases() {
+			if !slices.Contains(models, alias) {
+				models = append(models, alias)
+			}
+		}
+		slices.Sort(models)
+		return models
+	case "branch-name":
+		return app.branchNames()
+	case "persona":
+		names, _ := listPersonas()
+		return append([]string{"list"}, names...)
+	case "session":
+		sessions, _ := listSessions()
+		ids := make([]string, len(sessions))
+		for i, session := range sessions {
+			ids[i] = session.id
+		}
+		return ids
+	}
+	return nil
+}
+
+func argChoices(choices []string) []string {
+	names := make([]string, len(choices))
+	for i, choice := range choices {
+		names[i] = strings.TrimSuffix(choice, "?")
+	}
+	return names
+}
+
+func isOptionalArg(choices []string) bool {
+	for _, choice := range choices {
+		if !strings.HasSuffix(choice, "?") {
+			return false
+		}
+	}
+	return true
+}
+
+func pathCandidates(word string) []string {
+	dir, prefix := filepath.Split(word)
+	listDir := dir
+	if listDir == "" {
+		listDir = "."
+	}
+	entries, err := os.ReadDir(listDir)
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		candidate := dir + entry.Name()
+		if entry.IsDir() {
+			candidate += string(filepath.Separator)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
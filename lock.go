@@ -0,0 +1,29 @@
+package main
+
+import "os"
+
+func lockFile(path string) (func(), error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0660)
+		if err != nil {
+			return nil, err
+		}
+		err = lockOpenFile(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		locked, err := file.Stat()
+		if err != nil {
+			unlockOpenFile(file)
+			file.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(locked, current) {
+			return func() { releaseLockFile(file, path) }, nil
+		}
+		unlockOpenFile(file)
+		file.Close()
+	}
+}
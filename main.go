@@ -1,74 +1,319 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"math/rand"
+	"net"
 	"os"
-	"path"
+	"os/signal"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/chzyer/readline"
-	"github.com/fatih/color"
+	"github.com/Sa-RSt/gptrepl/control"
+	"github.com/Sa-RSt/gptrepl/providers"
+	"github.com/Sa-RSt/gptrepl/session"
 )
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
+type Message = session.Message
+
+type CompletionAPI = session.CompletionAPI
+
+type CompletionDelta = session.Delta
 
 type App struct {
-	context               []Message
-	model                 string
+	Conversation
+	tabs                  []Conversation
+	activeTab             int
 	slashCommandsDisabled bool
 	quiet                 bool
 	forgetful             bool
 	maxRetries            uint
 	apiKey                string
+	temperature           float32
+	provider              string
 	commandHandlers       map[string]Command
-	autosaveFilePath      string
+	config                Config
+	exitSummary           bool
+	oneShotPrompt         string
+	stdinLineMode         bool
+	scriptMode            bool
+	scriptPath            string
+	arena                 *Arena
+	serving               bool
+	listenAddress         string
+	serveToken            string
+	fileRefsDisabled      bool
+	builtinVarsDisabled   bool
+	botMode               bool
+	botPlatform           string
+	router                string
+	cheapModel            string
+	routerThreshold       uint
+	confirmOverTokens     uint
+	controlEnabled        bool
+	controlSocket         string
+	controlListener       net.Listener
 	printer               UserPrinter
 	capi                  CompletionAPI
+	reader                Readliner
+	modelListCache        []string
+	loadedContexts        []ContextOrigin
+	viMode                bool
+	compression           string
+	sessionsDisabled      bool
+	redactionDisabled     bool
+	sessions              bool
+	exportOnExit          string
+	autosaveBackups       uint
+	watch                 bool
+	watcher               *FileWatcher
+	vars                  map[string]string
+	embedder              EmbeddingAPI
+	memory                *VectorStore
+	docs                  *VectorStore
+	docsDir               string
+	ragChunks             uint
+	pagerDisabled         bool
+	wrapDisabled          bool
+	streamFlush           time.Duration
+	streamRate            float64
+	tui                   bool
+	statusLineDisabled    bool
+	metrics               SessionMetrics
+	statsOnExit           bool
+	notify                string
+	outputFormat          string
+	transcript            *Transcript
+	transcriptPath        string
+	recordPath            string
+	replayPath            string
+	mockFixtures          string
+	mockDelay             time.Duration
+	mockErrorRate         float64
+	cacheEnabled          bool
+	responseCache         *CachingCompletionAPI
+	otelEndpoint          string
+	telemetry             *Telemetry
+	traceDestination      string
+	traceTags             string
+	failureStatus         int
+}
+
+type Conversation struct {
+	context           []Message
+	model             string
+	autosaveFilePath  string
+	sessionSummary    string
+	undoStack         [][]Message
+	redoStack         [][]Message
+	failedRequest     *FailedRequest
+	branch            string
+	branches          map[string][]Message
+	title             string
+	created           time.Time
+	journalPath       string
+	journaled         []Message
+	journaledMetadata ContextMetadata
+	autosaveFileInfo  os.FileInfo
+}
+
+type FailedRequest struct {
+	pending []Message
+	keep    bool
+}
+
+type ContextOrigin struct {
+	path  string
+	model string
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		os.Exit(runBatch(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:]))
+	}
 	var app App
-	app.configure()
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "run" {
+		app.scriptMode = true
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "arena" {
+		app.arena = &Arena{}
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "serve" {
+		app.serving = true
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "bot" {
+		app.botMode = true
+		args = args[1:]
+	}
+	app.configure(args)
 	app.registerCommandHandlers()
-	app.mainLoop()
+	if dir, err := pluginsDir(); err == nil {
+		if err := app.loadPlugins(dir); err != nil {
+			app.printer.PrintWarning("failed to load plugins: %v\n", err)
+		}
+	}
+	if app.serving {
+		os.Exit(app.runServer())
+	}
+	if app.botMode {
+		os.Exit(app.runBot())
+	}
+	if app.scriptMode || app.oneShotPrompt != "" {
+		app.checkLoadedContextModels()
+	}
+	if app.scriptMode {
+		status := app.runScript(app.scriptPath)
+		app.beforeExit()
+		os.Exit(status)
+	}
+	if app.oneShotPrompt != "" {
+		status := app.runOneShot()
+		app.beforeExit()
+		os.Exit(status)
+	}
+	if !app.sessionsDisabled && app.autosaveFilePath == "" && stdinIsTerminal() {
+		err := app.startSession()
+		if err != nil {
+			app.printer.PrintWarning("failed to start a new session: %v\n", err)
+		}
+	}
+	if app.watch {
+		err := app.startWatching()
+		if err != nil {
+			app.printer.PrintError("failed to watch the autosave file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if app.tui {
+		err := app.runTUI()
+		if err != nil {
+			app.printer.PrintError("%v\n", err)
+		}
+	} else {
+		if app.arena != nil && !app.quiet {
+			app.printer.Print("Arena: every prompt is sent to two anonymized models. Vote for the better answer to reveal them.\n")
+		}
+		app.mainLoop()
+	}
+	if app.arena != nil {
+		app.printer.Print("%v\n", app.arena.scoreboard())
+	}
+	app.beforeExit()
+	if app.stdinLineMode {
+		os.Exit(app.failureStatus)
+	}
 }
 
-func (app *App) configure() {
+func (app *App) configure(args []string) {
 	app.printer = &ConsoleUserPrinter{}
-	app.capi = &OpenAICompletionAPI{}
-	app.parseFlags()
-	if !app.fillApiKeyIfNotPresent() {
+	app.capi = providers.NewOpenAI()
+	app.temperature = session.DefaultTemperature
+	app.parseFlags(args)
+	app.configureProvider()
+	if app.docsDir != "" {
+		stats, err := app.indexDocuments(app.docsDir)
+		if err != nil {
+			app.printer.PrintError("failed to index %v: %v\n", app.docsDir, err)
+			os.Exit(1)
+		}
+		if !app.quiet {
+			app.printer.Print("Indexed %v files from %v (%v excerpts, %v files cached, %v skipped).\n", stats.files, app.docsDir, stats.chunks, stats.cached, stats.skipped)
+		}
+	}
+	if !stdinIsTerminal() && !app.stdinLineMode && !app.scriptMode && app.arena == nil && !app.serving && !app.botMode {
+		err := app.readPromptFromPipe(os.Stdin)
+		if err != nil {
+			app.printer.PrintError("%v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func (app *App) configureProvider() {
+	var err error
+	if app.replayPath != "" {
+		err = app.useReplay(app.replayPath)
+	} else {
+		err = app.selectProvider()
+	}
+	if errors.Is(err, ErrNoProvider) {
 		printApiKeyHelpMessage(app.printer)
+		os.Exit(exitAuth)
+	}
+	if err == nil && app.recordPath != "" {
+		err = app.startRecording(app.recordPath)
+	}
+	if err == nil && (app.serving || app.otelEndpoint != "" || app.traceDestination != "") {
+		err = app.startTelemetry()
+	}
+	if err == nil && app.cacheEnabled {
+		err = app.startCaching()
+	}
+	if err == nil && !app.redactionDisabled {
+		err = app.startRedacting()
+	}
+	if err == nil {
+		err = app.configureRouter()
+	}
+	if err != nil {
+		app.printer.PrintError("%v\n", err)
 		os.Exit(1)
 	}
 }
 
 func (app *App) mainLoop() {
 	if !app.quiet && !app.slashCommandsDisabled {
-		app.printer.Print("Enter \"%v\" for a list of commands.\n", color.GreenString("/help"))
+		app.printer.Print("Enter \"%v\" for a list of commands.\n", theme.Command.Sprint("/help"))
+	}
+	if !stdinIsTerminal() {
+		if app.controlEnabled {
+			app.printer.PrintWarning("-control is ignored because stdin isn't a terminal\n")
+		}
+		app.checkLoadedContextModels()
+		reader := newScannerReadliner(os.Stdin)
+		for app.appMain(reader) {
+		}
+		return
 	}
-	reader, err := readline.New("")
+	reader, err := app.newLineEditor()
 	if err != nil {
 		app.printer.PrintError("failed to initialize readline: %v\n", err)
 		return
 	}
 	defer reader.Close()
+	app.reader = reader
+	if app.controlEnabled {
+		listener, err := app.startControl(reader)
+		if err != nil {
+			app.printer.PrintWarning("failed to listen on the control socket: %v\n", err)
+		} else {
+			app.controlListener = listener
+		}
+	}
+	app.checkLoadedContextModels()
 	running := true
+	lastStatus := ""
 	for running {
 		var prompt string
 		if app.quiet {
 			prompt = ""
 		} else {
-			prompt = fmt.Sprintf("%v%v%v%v", color.BlueString("("), color.YellowString(app.model), color.BlueString(")"), color.CyanString("> "))
+			if !app.statusLineDisabled && app.statusLine() != lastStatus {
+				lastStatus = app.statusLine()
+				reader.printStatus(lastStatus)
+			}
+			prompt = fmt.Sprintf("%v%v%v%v", theme.Prompt.Sprint("("), theme.Model.Sprint(app.model), theme.Prompt.Sprint(")"), theme.Prompt.Sprint("> "))
+			if app.tabCount() > 1 {
+				prompt = theme.Index.Sprintf("[%v/%v]", app.activeTab+1, app.tabCount()) + prompt
+			}
 		}
 		reader.SetPrompt(prompt)
 		running = app.appMain(reader)
@@ -79,102 +324,368 @@ type Readliner interface {
 	Readline() (string, error)
 }
 
+type ScannerReadliner struct {
+	scanner *bufio.Scanner
+}
+
+func newScannerReadliner(r io.Reader) *ScannerReadliner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &ScannerReadliner{scanner: scanner}
+}
+
+func (sr *ScannerReadliner) Readline() (string, error) {
+	if sr.scanner.Scan() {
+		return sr.scanner.Text(), nil
+	}
+	if err := sr.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
 func (app *App) appMain(reader Readliner) bool {
+	app.reader = reader
 	line, err := reader.Readline()
 	if err != nil {
 		return false
 	}
+	if err := app.executeLine(line); err != nil && app.failureStatus == 0 {
+		app.failureStatus = exitStatus(err)
+	}
+	return true
+}
+
+func (app *App) executeLine(line string) error {
 	line = strings.TrimSpace(line)
 	if line == "" {
-		return true
+		return nil
 	}
+	app.transcript.write("> " + line + "\n")
+	app.applyExternalChanges()
+	failedRequest := app.failedRequest
+	defer func() {
+		if app.failedRequest != nil && app.failedRequest != failedRequest && !app.quiet && !app.slashCommandsDisabled && app.config.isCommandEnabled("retry") {
+			app.printer.PrintWarning("Use %v to send it again.\n", theme.Command.Sprint("/retry"))
+		}
+	}()
 	if line[0] == '/' && !app.slashCommandsDisabled {
 		commandName, arguments, _ := strings.Cut(line, " ")
 		commandName = strings.TrimSpace(commandName[1:])
 		command, ok := app.commandHandlers[commandName]
 		if !ok {
-			app.printer.PrintError("unknown command: %v\n", commandName)
-			return true
+			err := fmt.Errorf("%w: %v", ErrUnknownCommand, commandName)
+			app.reportError(err)
+			return err
+		}
+		if !app.config.isCommandEnabled(commandName) {
+			app.reportError(fmt.Errorf("%v: %w", commandName, ErrCommandDisabled))
+			return ErrCommandDisabled
 		}
-		err = command.fn(app, strings.TrimSpace(arguments))
+		err := command.fn(app, strings.TrimSpace(arguments))
 		if err != nil {
-			app.printer.PrintError("%v: %v\n", commandName, err)
+			app.reportError(fmt.Errorf("%v: %w", commandName, err))
+		}
+		app.emitCommandResult(commandName, err)
+		return err
+	}
+	line, err := app.expandVars(line)
+	if err == nil && !app.fileRefsDisabled {
+		line, err = app.expandFileReferences(line)
+	}
+	if err == nil {
+		if app.arena != nil {
+			err = app.arenaRound(line)
+		} else if app.router != "" {
+			err = app.askRouted(line)
+		} else {
+			err = app.askQuestion(line)
 		}
-		return true
 	}
-	app.appendToContext(Message{Role: "user", Content: line})
-	responseContent, err := app.sendContextAndProcessResponse()
 	if err != nil {
-		app.printer.PrintError("%v (no changes done to context)\n", err)
-		app.popFromContext(1)
-		return true
+		app.reportError(fmt.Errorf("%w (no changes done to context)", err))
+		if providers.IsContextLengthError(err) && !app.quiet && !app.slashCommandsDisabled && app.config.isCommandEnabled("pop") {
+			app.printer.PrintWarning("The conversation doesn't fit in the context window of %v. Use %v to remove the last messages or %v to remove older ones.\n", app.model, theme.Command.Sprint("/pop"), theme.Command.Sprint("/delete"))
+		}
+	}
+	return err
+}
+
+func (app *App) readUserInput(prompt string) (string, error) {
+	if app.reader == nil {
+		return "", fmt.Errorf("no input available")
 	}
-	if app.forgetful {
-		app.popFromContext(1)
+	if setter, ok := app.reader.(interface{ SetPrompt(string) }); ok {
+		setter.SetPrompt(prompt)
+		app.transcript.write(prompt)
 	} else {
-		app.appendToContext(Message{Role: "assistant", Content: responseContent})
+		app.printer.Print("%v", prompt)
 	}
-	return true
+	line, err := app.reader.Readline()
+	line = strings.TrimSpace(line)
+	if err == nil {
+		app.transcript.write(line + "\n")
+	}
+	return line, err
+}
+
+func (app *App) askQuestion(content string) error {
+	return app.sendAndStore([]Message{session.NewMessage("user", content)}, false)
+}
+
+func (app *App) sendAndStore(pending []Message, keep bool) error {
+	messages := make([]Message, 0, len(app.context)+len(pending))
+	messages = append(messages, app.context...)
+	messages = append(messages, pending...)
+	messages = app.withRetrievedChunks(messages, pending)
+	answer, err := app.generateAnswer(messages)
+	if err != nil {
+		app.failedRequest = &FailedRequest{pending: pending, keep: keep}
+		return err
+	}
+	app.failedRequest = nil
+	if app.forgetful && !keep {
+		return nil
+	}
+	app.appendToContext(append(slices.Clone(pending), answer)...)
+	return nil
+}
+
+func (app *App) readPromptFromPipe(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read from stdin: %v", err)
+	}
+	piped := strings.TrimSpace(string(data))
+	if piped == "" && app.oneShotPrompt == "" {
+		return fmt.Errorf("no input received from stdin")
+	}
+	piped, err = app.fitAttachment("stdin", piped)
+	if err != nil {
+		return err
+	}
+	if app.oneShotPrompt != "" && piped != "" {
+		app.oneShotPrompt += "\n\n" + piped
+	} else if piped != "" {
+		app.oneShotPrompt = piped
+	}
+	return nil
 }
 
-func (app *App) sendContextAndProcessResponse() (string, error) {
-	retries := int64(app.maxRetries)
-	var stream <-chan CompletionDelta
+func (app *App) runOneShot() int {
 	var err error
-	const waitTimeMultiplier = 2.0
-	waitTime := 1.0
-	for retries >= 0 {
-		stream, err = app.capi.SendContext(app.context)
-		if err != nil && retries > 0 {
-			retries--
-			time.Sleep(time.Duration(waitTime) * time.Second)
-			waitTime *= waitTimeMultiplier
-			waitTime += rand.Float64() / 3
-		} else {
-			break
-		}
+	if app.router != "" {
+		err = app.askRouted(app.oneShotPrompt)
+	} else {
+		err = app.askQuestion(app.oneShotPrompt)
+	}
+	if err != nil {
+		app.reportError(err)
+	}
+	return exitStatus(err)
+}
+
+func (app *App) sendMessagesAndProcessResponse(messages []Message) (string, error) {
+	answer, err := app.generateAnswer(messages)
+	return answer.Content, err
+}
+
+func (app *App) generateAnswer(messages []Message) (Message, error) {
+	messages, err := app.runBeforeSendHook(messages)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := app.confirmLargeRequest(messages); err != nil {
+		return Message{}, err
 	}
+	observer := app.newProgressObserver()
+	if len(messages) > 0 && messages[len(messages)-1].Role == "user" {
+		app.emitEvent(OutputEvent{Type: "user", Content: messages[len(messages)-1].Content})
+	}
+	app.metrics.requests++
+	answer, err := session.Generate(app.capi, app.model, messages, session.Options{
+		MaxRetries: app.maxRetries,
+		OnRetry: retryWaiter(func(err error, wait time.Duration, attempt int, attempts int) {
+			app.metrics.retries++
+			if !app.quiet {
+				observer.interrupt(func() {
+					app.printer.PrintWarning("request failed (%v), retrying in %v (attempt %v/%v, Ctrl+C to stop retrying)…\n", retryReason(err), wait, attempt, attempts)
+				})
+			}
+		}),
+		Collect: func(stream <-chan CompletionDelta) (string, error) {
+			content, err := printAndCollectStream(app.printer, stream, app.outputWidth(), app.streamFlush, app.streamRate, observer)
+			if err == nil {
+				return content, nil
+			}
+			if providerErr, ok := providers.NewProviderError(err); ok {
+				return "", &StreamError{providerErr}
+			}
+			return "", &StreamError{fmt.Errorf("stream error: %w", err)}
+		},
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to send context: %v", err)
+		app.metrics.errors++
+		var streamErr *StreamError
+		if errors.As(err, &streamErr) {
+			return Message{}, err
+		}
+		observer.Finished("", err)
+		if errors.Is(err, ErrRetriesCanceled) {
+			return Message{}, err
+		}
+		if providerErr, ok := providers.NewProviderError(err); ok {
+			return Message{}, providerErr
+		}
+		return Message{}, fmt.Errorf("failed to send context: %w", err)
 	}
-	responseContent, err := printAndCollectStream(app.printer, stream)
+	app.metrics.recordAnswer(messages, answer.Content, observer)
+	app.emitCompletion(messages, answer.Content, observer)
+	app.notifyCompletion(answer.Content)
+	answer.Content, err = app.runAfterResponseHook(answer.Content)
 	if err != nil {
-		return "", fmt.Errorf("stream error: %v", err)
+		return Message{}, err
+	}
+	answer.OutputTokens = session.EstimateTokens(answer.Content)
+	return answer, nil
+}
+
+var ErrRetriesCanceled = session.ErrRetriesCanceled
+
+func sendWithRetries(capi CompletionAPI, messages []Message, maxRetries uint, onRetry func(err error, wait time.Duration, attempt int, attempts int)) (<-chan CompletionDelta, error) {
+	return session.SendWithRetries(capi, messages, maxRetries, retryWaiter(onRetry))
+}
+
+func retryWaiter(onRetry func(err error, wait time.Duration, attempt int, attempts int)) func(err error, wait time.Duration, attempt int, attempts int) bool {
+	return func(err error, wait time.Duration, attempt int, attempts int) bool {
+		debugLog.Debug("retry", "attempt", attempt-1, "wait_ms", wait.Milliseconds(), "error", err.Error())
+		if onRetry == nil {
+			time.Sleep(wait)
+			return true
+		}
+		onRetry(err, wait, attempt, attempts)
+		return waitUnlessInterrupted(wait)
+	}
+}
+
+func waitUnlessInterrupted(wait time.Duration) bool {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	select {
+	case <-time.After(wait):
+		return true
+	case <-interrupt:
+		return false
 	}
-	return responseContent, nil
 }
 
 func (app *App) SetModel(model string) {
+	model = app.resolveModel(model)
 	app.model = model
 	app.capi.SetModel(model)
 }
 
+func (app *App) SetTemperature(temperature float32) {
+	app.temperature = temperature
+	app.capi.SetTemperature(temperature)
+}
+
 func (app *App) SetApiKey(key string) {
 	app.apiKey = key
 	app.capi.SetApiKey(key)
 }
 
-func printAndCollectStream(printer UserPrinter, stream <-chan CompletionDelta) (string, error) {
-	var collect bytes.Buffer
-	for {
-		response, ok := <-stream
-		if !ok || errors.Is(response.err, io.EOF) {
-			printer.Print("\n")
-			return collect.String(), nil
-		}
+func (app *App) outputWidth() int {
+	width, _, ok := terminalSize()
+	if !ok || app.wrapDisabled {
+		return 0
+	}
+	return width
+}
 
-		if response.err != nil {
-			return "", response.err
+func printAndCollectStream(printer UserPrinter, stream <-chan CompletionDelta, width int, flushInterval time.Duration, rate float64, observer StreamObserver) (string, error) {
+	var highlighter CodeHighlighter
+	buffer := newStreamBuffer(printer, flushInterval)
+	typewriter := newTypewriter(rate)
+	wrapper := newSoftWrapper(width)
+	if width > 0 {
+		watchResize()
+	}
+	resizes := terminalResizes.Load()
+	started := false
+	jsonl, isJSONL := printer.(*JSONLPrinter)
+	content, err := session.Collect(stream, func(delta string) {
+		if !started && delta != "" && observer != nil {
+			observer.FirstDelta()
+		}
+		started = started || delta != ""
+		if isJSONL {
+			jsonl.emit(OutputEvent{Type: "delta", Text: delta})
+			return
+		}
+		typewriter.pace(delta, func(text string) {
+			if width > 0 && terminalResizes.Load() != resizes {
+				resizes = terminalResizes.Load()
+				if newWidth, _, ok := terminalSize(); ok {
+					buffer.write(wrapper.resize(newWidth))
+				}
+			}
+			buffer.write(highlighter.write(wrapper.write(text)))
+		})
+	})
+	buffer.flush()
+	if err != nil {
+		if observer != nil {
+			observer.Finished("", err)
 		}
+		return "", err
+	}
+	if !isJSONL {
+		printer.Print("%v\n", highlighter.write(wrapper.flush())+highlighter.flush())
+	}
+	if observer != nil {
+		observer.Finished(content, nil)
+	}
+	return content, nil
+}
+
+const maxUndoSteps = 100
+
+func (app *App) setContext(ctx []Message) {
+	app.undoStack = append(app.undoStack, app.context)
+	if len(app.undoStack) > maxUndoSteps {
+		app.undoStack = app.undoStack[1:]
+	}
+	app.redoStack = nil
+	app.context = slices.Clip(ctx)
+	app.tryUpdateAutosaveFile()
+}
 
-		collect.WriteString(response.delta)
-		printer.Print("%v", response.delta)
+func (app *App) undo() bool {
+	if len(app.undoStack) == 0 {
+		return false
 	}
+	app.redoStack = append(app.redoStack, app.context)
+	app.context = app.undoStack[len(app.undoStack)-1]
+	app.undoStack = app.undoStack[:len(app.undoStack)-1]
+	app.tryUpdateAutosaveFile()
+	return true
 }
 
-func (app *App) appendToContext(msg Message) {
-	app.context = append(app.context, msg)
+func (app *App) redo() bool {
+	if len(app.redoStack) == 0 {
+		return false
+	}
+	app.undoStack = append(app.undoStack, app.context)
+	app.context = app.redoStack[len(app.redoStack)-1]
+	app.redoStack = app.redoStack[:len(app.redoStack)-1]
 	app.tryUpdateAutosaveFile()
+	return true
+}
+
+func (app *App) appendToContext(messages ...Message) {
+	app.setContext(append(slices.Clip(app.context), messages...))
 }
 
 func (app *App) popFromContext(n int) error {
@@ -184,8 +695,60 @@ func (app *App) popFromContext(n int) error {
 	if n > len(app.context) {
 		return fmt.Errorf("can't pop %v elements from the context because it only contains %v elements", n, len(app.context))
 	}
-	app.context = app.context[:len(app.context)-n]
-	app.tryUpdateAutosaveFile()
+	app.setContext(app.context[:len(app.context)-n])
+	return nil
+}
+
+func (app *App) deleteMessages(start int, end int) {
+	app.setContext(slices.Delete(slices.Clone(app.context), start, end))
+}
+
+func (app *App) insertMessage(index int, msg Message) {
+	app.setContext(slices.Insert(slices.Clone(app.context), index, msg))
+}
+
+func (app *App) moveMessage(from int, to int) {
+	msg := app.context[from]
+	app.setContext(slices.Insert(slices.Delete(slices.Clone(app.context), from, from+1), to, msg))
+}
+
+func (app *App) replaceMessage(index int, msg Message) {
+	ctx := slices.Clone(app.context)
+	ctx[index] = msg
+	app.setContext(ctx)
+}
+
+func withSystemPrompt(ctx []Message, prompt string) []Message {
+	if len(ctx) > 0 && ctx[0].Role == "system" {
+		ctx = slices.Clone(ctx)
+		ctx[0] = session.NewMessage("system", prompt)
+		return ctx
+	}
+	return slices.Insert(slices.Clone(ctx), 0, session.NewMessage("system", prompt))
+}
+
+func systemPrompt(ctx []Message) (string, bool) {
+	if len(ctx) == 0 || ctx[0].Role != "system" {
+		return "", false
+	}
+	return ctx[0].Content, true
+}
+
+func (app *App) editMessage(index int) error {
+	msg := app.context[index]
+	content, err := presentTextEditor(msg.Content)
+	if err != nil {
+		return err
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return fmt.Errorf("no content in file. Use /pop to remove messages")
+	}
+	if content == msg.Content {
+		return nil
+	}
+	msg.Content = content
+	app.replaceMessage(index, msg)
 	return nil
 }
 
@@ -193,15 +756,164 @@ func (app *App) tryUpdateAutosaveFile() {
 	if app.autosaveFilePath == "" {
 		return
 	}
-	err := writeContextFile(app.autosaveFilePath, app.context)
+	if app.autosaveChangedExternally() && app.offerAutosaveReload() {
+		return
+	}
+	unlock, err := lockFile(app.autosaveFilePath + ".lock")
+	if err != nil {
+		app.printer.PrintError("failed to write to file \"%v\": failed to lock it: %v\n", app.autosaveFilePath, err)
+		return
+	}
+	defer unlock()
+	if app.journalPath != "" && app.journalPath == app.autosaveFilePath {
+		err = app.appendToJournal()
+	} else {
+		err = app.rewriteAutosaveFile()
+	}
 	if err != nil {
 		app.printer.PrintError("failed to write to file \"%v\": %v\n", app.autosaveFilePath, err)
+		return
 	}
+	app.recordAutosaveFileInfo()
+}
+
+func (app *App) recordAutosaveFileInfo() {
+	app.autosaveFileInfo, _ = os.Stat(app.autosaveFilePath)
 }
 
-func (app *App) parseFlags() {
+func (app *App) autosaveChangedExternally() bool {
+	if app.autosaveFileInfo == nil {
+		return false
+	}
+	info, err := os.Stat(app.autosaveFilePath)
+	if err != nil {
+		return !errors.Is(err, os.ErrNotExist)
+	}
+	return !os.SameFile(info, app.autosaveFileInfo) || !info.ModTime().Equal(app.autosaveFileInfo.ModTime()) || info.Size() != app.autosaveFileInfo.Size()
+}
+
+func (app *App) offerAutosaveReload() bool {
+	app.printer.PrintWarning("\"%v\" was changed by another program since it was last saved by this one\n", app.autosaveFilePath)
+	if app.reader == nil || app.quiet {
+		app.printer.PrintWarning("overwriting it with the current context\n")
+		return false
+	}
+	if !app.confirm("Reload it, discarding the last change made here?") {
+		return false
+	}
+	messages, metadata, err := parseContextFileWithMetadata(app.autosaveFilePath)
+	if err != nil {
+		app.printer.PrintError("failed to reload \"%v\": %v\n", app.autosaveFilePath, err)
+		return false
+	}
+	app.undoStack = append(app.undoStack, app.context)
+	app.context = messages
+	app.resumeJournal(metadata)
+	app.recordAutosaveFileInfo()
+	app.printer.Print("Reloaded. The context now has %v messages.\n", len(app.context))
+	return true
+}
+
+func (app *App) contextMetadata() ContextMetadata {
+	updated := time.Now()
+	metadata := ContextMetadata{Summary: app.sessionSummary, Model: app.model, Title: app.title, Updated: &updated}
+	if !app.created.IsZero() {
+		created := app.created
+		metadata.Created = &created
+	}
+	if app.provider != "" {
+		metadata.Parameters = &ContextParameters{Provider: app.provider}
+	}
+	if app.currentBranch() != defaultBranch {
+		metadata.Branch = app.currentBranch()
+	}
+	return metadata
+}
+
+func (app *App) checkLoadedContextModels() {
+	for _, origin := range app.loadedContexts {
+		app.checkContextModel(origin)
+	}
+	app.loadedContexts = nil
+}
+
+func (app *App) checkContextModel(origin ContextOrigin) {
+	if origin.model == "" || origin.model == app.model || app.quiet {
+		return
+	}
+	app.printer.PrintWarning("context loaded from \"%v\" was generated by %v, but the active model is %v\n", origin.path, origin.model, app.model)
+	if app.reader == nil {
+		return
+	}
+	if !app.confirm(fmt.Sprintf("Switch to %v?", origin.model)) {
+		return
+	}
+	app.SetModel(origin.model)
+	app.printer.Print("Switched to %v.\n", origin.model)
+}
+
+const sessionSummaryPrompt = "Summarize our conversation so far in exactly 3 short bullet points, so that it can be resumed later. Reply with the bullet points only."
+
+func (app *App) summarizeSession() error {
+	if len(app.context) == 0 {
+		return nil
+	}
+	messages := make([]Message, 0, len(app.context)+1)
+	messages = append(messages, app.context...)
+	messages = append(messages, Message{Role: "user", Content: sessionSummaryPrompt})
+	if !app.quiet {
+		app.printer.Print("%v\n", theme.Heading.Sprint("Session summary:"))
+	}
+	summary, err := app.sendMessagesAndProcessResponse(messages)
+	if err != nil {
+		return err
+	}
+	app.sessionSummary = strings.TrimSpace(summary)
+	app.tryUpdateAutosaveFile()
+	return nil
+}
+
+func (app *App) beforeExit() {
+	if app.telemetry != nil {
+		defer app.telemetry.shutdown()
+	}
+	if app.controlListener != nil {
+		defer app.controlListener.Close()
+	}
+	defer app.compactJournals()
+	defer app.stopTranscript()
+	if app.statsOnExit {
+		defer func() {
+			app.printer.Print("%v\n", theme.Dim.Sprint(app.metrics.summary()))
+		}()
+	}
+	if app.exitSummary {
+		err := app.summarizeSession()
+		if err != nil {
+			app.printer.PrintError("failed to summarize session: %v\n", err)
+		}
+	}
+	if app.exportOnExit != "" {
+		format, _ := exportFormatFromPath(app.exportOnExit)
+		err := app.exportContext(format, app.exportOnExit, app.context, app.exportOptions(app.context, nil))
+		if err != nil {
+			app.printer.PrintError("failed to export the conversation: %v\n", err)
+		}
+	}
+}
+
+func (app *App) parseFlags(args []string) {
 	addJsonCtx := func(path string) error {
-		messages, err := parseContextFile(path)
+		messages, metadata, err := parseContextFileWithMetadata(path)
+		if err != nil {
+			return err
+		}
+		app.context = append(app.context, messages...)
+		app.loadedContexts = append(app.loadedContexts, ContextOrigin{path: path, model: metadata.Model})
+		return nil
+	}
+	addMarkdownCtx := func(path string) error {
+		messages, err := parsePlainTextContextFile(path)
 		if err != nil {
 			return err
 		}
@@ -210,51 +922,253 @@ func (app *App) parseFlags() {
 	}
 	model := ""
 	apiKey := ""
+	configPath := ""
+	system := ""
 	flag.Func("ctx", "Load and append a JSON context file (such as one created by the /save interactive command). Can be used multiple times.", addJsonCtx)
-	flag.StringVar(&model, "model", "gpt-4", "The OpenAI model ID string (e.g. gpt-3.5-turbo).")
-	flag.StringVar(&apiKey, "apikey", "", "The OpenAI API key to use. Overrides $OPENAI_API_KEY and ~/.gptrepl-key.")
-	flag.BoolVar(&app.slashCommandsDisabled, "nocommands", false, "Disable slash (\"/\") commands.")
+	flag.Func("ctx-md", "Load and append a plain text context file in the [role] format (such as one created by the /savemd interactive command). Can be used multiple times, together with -ctx.", addMarkdownCtx)
+	flag.StringVar(&session.DefaultFileFormat, "format", "json", fmt.Sprintf("Format of context files whose extension is not .json, .yaml/.yml or .jsonl: %v.", strings.Join(contextFileFormats, ", ")))
+	flag.StringVar(&system, "system", "", "Set the system prompt, replacing the first message of the loaded context if it is a system message or adding one to the beginning of the context otherwise (see /system).")
+	flag.StringVar(&app.provider, "provider", "auto", providerFlagUsage)
+	flag.StringVar(&model, "model", "", modelFlagUsage)
+	flag.StringVar(&apiKey, "apikey", "", apiKeyFlagUsage)
+	flag.BoolVar(&app.slashCommandsDisabled, "nocommands", false, "Disable slash (\"/\") commands. To disable only some of them, use the \"allow\" and \"deny\" lists in the \"commands\" section of the configuration file.")
 	flag.BoolVar(&app.quiet, "quiet", false, "Only print the model's output (errors will still be printed to stderr).")
-	flag.BoolVar(&app.forgetful, "forgetful", false, "Don't update the conversation context after asking questions and receiving answers from the model. Does not affect commands (such as /escape)")
+	flag.BoolVar(&app.forgetful, "forgetful", false, "Don't update the conversation context after asking questions and receiving answers from the model. Also applies to /send, /escape and /ns, unless they are run with --keep.")
 	flag.UintVar(&app.maxRetries, "maxretries", 5, "The maximum amount of attempts at retrying requests. If set to zero, no retries will be made.")
 	flag.StringVar(&app.autosaveFilePath, "autosave", "", `Load the path as a JSON context (if it exists) and sets it as the autosave file path. The context is automatically saved to this file after every update. This file is always the last one loaded, regardless of its ordering relative to the -ctx flags.`)
+	flag.BoolVar(&app.watch, "watch", false, "Watch the autosave file and reload the context whenever it is changed by another program (e.g. a text editor), before the next line typed in the interactive shell is run.")
+	flag.UintVar(&app.autosaveBackups, "autosave-backups", 1, "How many previous versions of the autosave file to keep, as FILE.bak.1 (the most recent) to FILE.bak.N. Set to zero to keep none.")
 	autosavePreventLoad := flag.Bool("autosave-prevent-load", false, "Prevent the file specified in the -autosave flag from being loaded. Ignored if -autosave isn't set.")
-	flag.Parse()
+	flag.StringVar(&configPath, "config", "", fmt.Sprintf("Path to a JSON configuration file (defaults to %v).", defaultConfigPath()))
+	flag.StringVar(&app.oneShotPrompt, "e", "", "Send a single message to the model, print its answer and exit without starting the interactive shell. Positional arguments and data piped into stdin are appended to this message (e.g. gptrepl \"What is 2+2?\"). The exit status is non-zero if the request fails.")
+	flag.BoolVar(&app.stdinLineMode, "lines", false, "When stdin is not a terminal, read it line by line as if each line had been typed in the interactive shell, instead of sending all of it as a single message.")
+	flag.BoolVar(&app.viMode, "vi", false, "Use vi-style modal editing in the interactive shell instead of emacs-style keybindings. The prompt shows [N] in normal mode and [I] in insert mode. Can be changed later with /keybindings.")
+	flag.StringVar(&app.compression, "compress", "ask", fmt.Sprintf("What to do with attached content that doesn't fit in the context window of the model: ask, %v. \"ask\" shows a menu in the interactive shell and fails otherwise.", strings.Join(compressionStrategies, ", ")))
+	jsonErrors := flag.Bool("json-errors", false, "Print errors to stderr as single-line JSON objects with \"code\", \"message\", \"provider\", \"request_id\" and \"retryable\" fields, so that scripts can handle failures. Meant for quiet mode and single questions.")
+	flag.StringVar(&app.exportOnExit, "export-on-exit", "", "Export the conversation to the given path when the program exits. The format is taken from the extension (.md for Markdown, .html for HTML).")
+	resume := flag.Bool("resume", false, "Continue the most recently updated session. Can't be used together with -autosave.")
+	flag.BoolVar(&app.redactionDisabled, "noredact", false, "Don't mask text that looks like a secret (API keys, AWS credentials, private keys and the patterns in the \"redaction\" section of the configuration file) in the messages sent to the model.")
+	flag.BoolVar(&app.sessionsDisabled, "nosessions", false, "Don't save the conversations of the interactive shell as sessions (see /sessions) unless -autosave or -resume is used.")
+	flag.UintVar(&app.ragChunks, "rag", 3, "How many of the excerpts stored with /remember or indexed with -docs that are most relevant to each question are sent along with it, in a system message that isn't stored in the context. Set to zero to disable retrieval.")
+	flag.StringVar(&app.docsDir, "docs", "", "Index the files in a directory (skipping the ones ignored by .gitignore) with OpenAI embeddings on startup, so that the excerpts most relevant to each question are sent along with it (see -rag). Embeddings are cached by file contents.")
+	flag.BoolVar(&app.pagerDisabled, "nopager", false, "Print the output of /print directly instead of piping it through $PAGER (or less -R) when it doesn't fit in the terminal.")
+	flag.BoolVar(&app.wrapDisabled, "nowrap", false, "Don't wrap the answers of the model at word boundaries to fit the width of the terminal, leaving long lines to the terminal.")
+	flag.DurationVar(&app.streamFlush, "stream-flush", defaultStreamFlushInterval, "How long streamed text is buffered before being printed, to reduce flicker with fast models. Text is also printed at the end of each line. Use 0 to print every piece as soon as it arrives.")
+	flag.Float64Var(&app.streamRate, "stream-rate", 0, "The maximum amount of characters of the answers printed per second, e.g. 40 to follow the text in screencasts and demos. 0 prints the answers as fast as they arrive.")
+	flag.BoolVar(&app.tui, "tui", false, "Use a full-screen interface with a scrollable conversation pane, an input box and a status bar, instead of the line-based shell.")
+	flag.BoolVar(&app.statusLineDisabled, "nostatus", false, "Don't show the status line with the model, the estimated tokens and cost of the context and whether autosave is on above the prompt of the interactive shell.")
+	flag.BoolVar(&app.statsOnExit, "stats-on-exit", false, "Print a summary of the metrics of the session (see /stats) when the program exits.")
+	flag.StringVar(&app.notify, "notify", "", fmt.Sprintf("Notify when an answer is complete, e.g. when a slow generation is running in another window: %v. \"desktop\" falls back to the bell if desktop notifications are unavailable.", strings.Join(notifyMethods, ", ")))
+	colorMode := flag.String("color", "auto", "When to use colors: auto, always or never. \"auto\" disables them when stdout isn't a terminal or the NO_COLOR environment variable is set.")
+	noColor := flag.Bool("nocolor", false, "Don't use colors. The same as -color never.")
+	flag.StringVar(&app.outputFormat, "output", "text", "Output format: text or jsonl. With jsonl, every event (user messages, deltas of answers, completions, usage, command results, output of commands, warnings and errors) is printed to stdout as a JSON object on its own line, so that other programs can drive gptrepl.")
+	flag.StringVar(&app.mockFixtures, "mock-fixtures", "", "A JSON file with canned answers for -provider mock, as a list of objects with \"match\" (a text contained in the last user message), \"response\" and optionally \"error\" fields. The first matching answer is used, and the last user message is repeated if none matches.")
+	flag.DurationVar(&app.mockDelay, "mock-delay", 30*time.Millisecond, "How long -provider mock waits before streaming each word of its answers.")
+	flag.Float64Var(&app.mockErrorRate, "mock-errors", 0, "The probability (from 0 to 1) that a request to -provider mock fails, to try out how errors and retries are handled.")
+	flag.BoolVar(&app.cacheEnabled, "cache", false, cacheFlagUsage+" See /cache.")
+	flag.StringVar(&app.recordPath, "record", "", "Append every request sent to the model and its response to the given file, so that it can be served back later with -replay.")
+	flag.StringVar(&app.replayPath, "replay", "", "Answer with the responses recorded with -record in the given file instead of sending requests to a provider, e.g. for demos, tests and offline development. No API key is needed.")
+	flag.StringVar(&app.router, "router", "", "Choose the model of each prompt automatically. \"cheap-first\" sends prompts to -cheap-model and only uses -model for prompts longer than -router-threshold or starting with !strong.")
+	flag.StringVar(&app.cheapModel, "cheap-model", "", "The model used by -router for short prompts. Defaults to gpt-4o-mini for OpenAI and claude-3-5-haiku-latest for Anthropic.")
+	flag.UintVar(&app.routerThreshold, "router-threshold", defaultRouterThreshold, "The estimated amount of tokens above which -router sends a prompt to -model.")
+	flag.UintVar(&app.confirmOverTokens, "confirm-over-tokens", 0, "Show the estimated size and cost of requests larger than the given amount of tokens and ask for confirmation before sending them. Without an interactive shell, such requests fail. 0 disables the confirmation.")
+	flag.StringVar(&app.otelEndpoint, "otel-endpoint", "", "Send a trace of every request to the model (model, estimated tokens, duration and errors) to the given OpenTelemetry collector, using OTLP over HTTP, e.g. http://localhost:4318.")
+	flag.StringVar(&app.traceDestination, "trace", "", "Record every request to the model (inputs, output, model, duration, estimated tokens and cost) as a line of JSON appended to the given file. If an http:// or https:// URL is given, each record is sent to it in a POST request instead.")
+	flag.StringVar(&app.traceTags, "trace-tags", "", "Tags added to every record of -trace, as key=value pairs separated by commas, e.g. experiment=short-prompt,version=2.")
+	flag.BoolVar(&app.controlEnabled, "control", false, "Accept prompts and commands sent with gptreplctl (e.g. from an editor) through a Unix socket, and run them as if they had been typed in the interactive shell.")
+	flag.StringVar(&app.controlSocket, "control-socket", control.DefaultSocketPath(), "The Unix socket used by -control.")
+	debug := flag.Bool("debug", false, "Log every request sent to the model (model, parameters, amount of messages and estimated tokens), the metadata of its response (id, finish reason and token usage) and retries to stderr as JSON objects, one per line.")
+	logPath := flag.String("log", "", "Append the log of -debug to the given file instead of stderr. Implies -debug.")
+	transcriptPath := flag.String("transcript", "", "Append a plain text record of everything shown on the screen (typed lines, answers, output of commands, warnings and errors) to the given file, independently of -autosave. A .md extension makes it readable as Markdown. Can be changed later with /transcript.")
+	flag.BoolVar(&app.exitSummary, "exit-summary", false, "On exit, ask the model for a 3-bullet summary of the session, print it and store it in the autosave file. The summary is shown again the next time the autosave file is loaded.")
+	if app.scriptMode {
+		flag.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: gptrepl run [flags] script.gptrepl\n\nRuns every line of the script as if it had been typed in the interactive shell. Lines starting with # are comments\nand lines ending with a backslash continue on the next line. The script stops at the first failing line.\n\n")
+			flag.PrintDefaults()
+		}
+	} else if app.arena != nil {
+		flag.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: gptrepl arena [flags] modelA modelB\n\nSends every prompt to both models and shows the answers anonymized as A and B, in a random order. After voting\nfor the better answer (or a tie, or both bad), the models are revealed and a running scoreboard is printed.\n\n")
+			flag.PrintDefaults()
+		}
+	} else if app.serving {
+		flag.StringVar(&app.listenAddress, "listen", defaultListenAddress, "The address where the HTTP API listens. Use :8080 to accept connections from other hosts.")
+		flag.StringVar(&app.serveToken, "token", "", "The bearer token that clients must send in the Authorization header. Defaults to the \"token\" of the \"serve\" section of the configuration file.")
+		flag.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: gptrepl serve [flags]\n\nServes the saved sessions over HTTP, so that other programs (e.g. a web interface or an editor plugin) can drive gptrepl.\nMessages posted to a session are handled like lines typed in the interactive shell, and the events of -output jsonl\nare streamed back as server-sent events.\n\n")
+			flag.PrintDefaults()
+		}
+	} else if app.botMode {
+		flag.StringVar(&app.botPlatform, "platform", "", fmt.Sprintf("The chat platform to connect to: %v. Its tokens are read from the \"bot\" section of the configuration file.", strings.Join(botPlatforms, ", ")))
+		flag.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: gptrepl bot -platform slack|discord [flags]\n\nAnswers the messages of a Slack or Discord bot. Every channel (and Slack thread) has its own context, saved as a\nsession. Messages starting with ! run the command of the same name, e.g. !clear or !model gpt-4o.\n\n")
+			flag.PrintDefaults()
+		}
+	}
+	flag.CommandLine.Parse(args)
+	app.printer = &TranscriptPrinter{UserPrinter: app.printer, app: app}
+	if *jsonErrors {
+		app.printer = &JSONErrorPrinter{UserPrinter: app.printer, out: os.Stderr}
+	}
+	if app.serving || app.botMode {
+		*noColor = true
+		app.statusLineDisabled = true
+		app.pagerDisabled = true
+		app.wrapDisabled = true
+	}
+	switch app.outputFormat {
+	case "text":
+	case "jsonl":
+		app.printer = &JSONLPrinter{out: os.Stdout}
+		*noColor = true
+		app.statusLineDisabled = true
+		app.pagerDisabled = true
+		app.wrapDisabled = true
+	default:
+		app.printer.PrintError("invalid value for -output: '%v'. Use one of: %v\n", app.outputFormat, strings.Join(outputFormats, ", "))
+		os.Exit(2)
+	}
+	if *noColor {
+		*colorMode = "never"
+	}
+	if err := configureColor(*colorMode); err != nil {
+		app.printer.PrintError("%v\n", err)
+		os.Exit(2)
+	}
+	if err := configureDebugLog(*debug, *logPath); err != nil {
+		app.printer.PrintError("failed to open the log: %v\n", err)
+		os.Exit(1)
+	}
+	if *transcriptPath != "" {
+		if err := app.startTranscript(*transcriptPath); err != nil {
+			app.printer.PrintError("failed to open the transcript: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var err error
+	if configPath != "" {
+		app.config, err = loadConfig(configPath, true)
+	} else {
+		app.config, err = loadConfig(defaultConfigPath(), false)
+	}
+	if err != nil {
+		app.printer.PrintError("failed to load configuration file: %v\n", err)
+		os.Exit(1)
+	}
+	theme, err = loadTheme(app.config.Theme, app.config.Colors)
+	if err != nil {
+		app.printer.PrintError("invalid theme in configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !slices.Contains(contextFileFormats, session.DefaultFileFormat) {
+		app.printer.PrintError("invalid value for -format: '%v'\n", session.DefaultFileFormat)
+		os.Exit(2)
+	}
+
+	if app.exportOnExit != "" {
+		_, err = exportFormatFromPath(app.exportOnExit)
+		if err != nil {
+			app.printer.PrintError("invalid value for -export-on-exit: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if app.streamRate < 0 {
+		app.printer.PrintError("invalid value for -stream-rate: '%v'. Use a positive number, or 0 for no limit\n", app.streamRate)
+		os.Exit(2)
+	}
+	if app.compression != "ask" && !slices.Contains(compressionStrategies, app.compression) {
+		app.printer.PrintError("invalid value for -compress: '%v'\n", app.compression)
+		os.Exit(2)
+	}
+	if app.notify != "" && !slices.Contains(notifyMethods, app.notify) {
+		app.printer.PrintError("invalid value for -notify: '%v'. Use one of: %v\n", app.notify, strings.Join(notifyMethods, ", "))
+		os.Exit(2)
+	}
+
+	if app.scriptMode {
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		app.scriptPath = flag.Arg(0)
+	} else if app.serving || app.botMode {
+		if flag.NArg() != 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+	} else if app.arena != nil {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		app.arena.models = [2]string{flag.Arg(0), flag.Arg(1)}
+	} else if flag.NArg() > 0 {
+		positional := strings.Join(flag.Args(), " ")
+		if app.oneShotPrompt == "" {
+			app.oneShotPrompt = positional
+		} else {
+			app.oneShotPrompt += "\n" + positional
+		}
+	}
 
 	app.SetModel(model)
 	app.SetApiKey(apiKey)
+	if app.arena != nil {
+		app.arena.models = [2]string{app.resolveModel(app.arena.models[0]), app.resolveModel(app.arena.models[1])}
+	}
 
-	_, err := os.Stat(app.autosaveFilePath)
-	if !*autosavePreventLoad && app.autosaveFilePath != "" && !errors.Is(err, os.ErrNotExist) {
-		err = addJsonCtx(app.autosaveFilePath)
+	if *resume {
+		if app.autosaveFilePath != "" {
+			app.printer.PrintError("-resume can't be used together with -autosave\n")
+			os.Exit(2)
+		}
+		session, err := mostRecentSession()
 		if err != nil {
-			app.printer.PrintError("failed to load autosave file: %v", err)
+			app.printer.PrintError("failed to resume session: %v\n", err)
 			os.Exit(1)
 		}
+		app.autosaveFilePath = session.path
 	}
-}
 
-func (app *App) fillApiKeyIfNotPresent() bool {
-	if app.apiKey != "" {
-		return true
+	app.created = time.Now()
+	_, err = os.Stat(app.autosaveFilePath)
+	if !*autosavePreventLoad && app.autosaveFilePath != "" && !errors.Is(err, os.ErrNotExist) {
+		err = app.loadAutosaveFile()
+		if err != nil {
+			app.printer.PrintError("failed to load autosave file: %v\n", err)
+			os.Exit(1)
+		}
 	}
-
-	key := os.Getenv("OPENAI_API_KEY")
-	if key != "" {
-		app.SetApiKey(key)
-		return true
+	if system != "" {
+		app.context = withSystemPrompt(app.context, system)
 	}
+}
 
-	home, err := os.UserHomeDir()
+func (app *App) loadAutosaveFile() error {
+	messages, metadata, err := parseContextFileWithMetadata(app.autosaveFilePath)
 	if err != nil {
-		return false
+		return err
 	}
-	keyBytes, err := os.ReadFile(path.Join(home, ".gptrepl-key"))
+	app.recordAutosaveFileInfo()
+	app.context = append(app.context, messages...)
+	app.loadedContexts = append(app.loadedContexts, ContextOrigin{path: app.autosaveFilePath, model: metadata.Model})
+	app.sessionSummary = metadata.Summary
+	app.branch = metadata.Branch
+	app.title = metadata.Title
+	if metadata.Created != nil {
+		app.created = *metadata.Created
+	}
+	if app.sessionSummary != "" && !app.quiet {
+		app.printer.Print("%v\n%v\n\n", theme.Heading.Sprint("Summary of the previous session:"), app.sessionSummary)
+	}
+	err = app.loadBranches()
 	if err != nil {
-		return false
+		return fmt.Errorf("failed to load branches: %w", err)
 	}
-	app.SetApiKey(strings.TrimSpace(string(keyBytes)))
-	return true
+	return nil
 }
 
 func printApiKeyHelpMessage(printer UserPrinter) {
@@ -266,9 +1180,10 @@ func printApiKeyHelpMessage(printer UserPrinter) {
 		comp = ""
 	}
 
-	printer.PrintError("An %v was not provided.\n", color.RedString("OpenAI API key"))
+	printer.PrintError("An %v was not provided.\n", theme.Error.Sprint("OpenAI API key"))
 	printer.PrintError("gptrepl searches for the key in three places until one is found, in the following order:\n")
 	printer.PrintError(" - The -apikey command-line flag\n")
 	printer.PrintError(" - OPENAI_API_KEY environment variable\n")
 	printer.PrintError(" - A file named \".gptrepl-key\" located in the home directory %vcontaining only a plaintext key in UTF-8 encoding.\n", comp)
+	printer.PrintError("To use Anthropic models instead, set the ANTHROPIC_API_KEY environment variable. To use local models, start Ollama (set OLLAMA_HOST if it doesn't listen on %v).\n", ollamaDefaultHost)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+type SessionMetrics struct {
+	requests         int
+	retries          int
+	errors           int
+	promptTokens     int
+	completionTokens int
+	latency          time.Duration
+	generation       time.Duration
+	answers          int
+}
+
+func (metrics *SessionMetrics) recordAnswer(messages []Message, content string, observer *ProgressObserver) {
+	for _, msg := range messages {
+		metrics.promptTokens += session.EstimateTokens(msg.Content)
+	}
+	metrics.completionTokens += session.EstimateTokens(content)
+	if observer.first.IsZero() {
+		return
+	}
+	metrics.answers++
+	metrics.latency += observer.first.Sub(observer.start)
+	metrics.generation += time.Since(observer.first)
+}
+
+func (metrics *SessionMetrics) averageLatency() string {
+	if metrics.answers == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.2fs", metrics.latency.Seconds()/float64(metrics.answers))
+}
+
+func (metrics *SessionMetrics) tokensPerSecond() string {
+	if metrics.generation <= 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.1f", float64(metrics.completionTokens)/metrics.generation.Seconds())
+}
+
+func (metrics *SessionMetrics) String() string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "Requests:            %v\n", metrics.requests)
+	fmt.Fprintf(&result, "Retries:             %v\n", metrics.retries)
+	fmt.Fprintf(&result, "Errors:              %v\n", metrics.errors)
+	fmt.Fprintf(&result, "Prompt tokens:       ~%v\n", formatTokenCount(metrics.promptTokens))
+	fmt.Fprintf(&result, "Completion tokens:   ~%v\n", formatTokenCount(metrics.completionTokens))
+	fmt.Fprintf(&result, "Average latency:     %v\n", metrics.averageLatency())
+	fmt.Fprintf(&result, "Tokens per second:   %v\n", metrics.tokensPerSecond())
+	return result.String()
+}
+
+func (metrics *SessionMetrics) summary() string {
+	return fmt.Sprintf("%v requests (%v retries, %v errors), ~%v prompt and ~%v completion tokens, average latency %v, %v tokens/s", metrics.requests, metrics.retries, metrics.errors, formatTokenCount(metrics.promptTokens), formatTokenCount(metrics.completionTokens), metrics.averageLatency(), metrics.tokensPerSecond())
+}
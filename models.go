@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var knownContextWindows = map[string]int{
+	"gpt-4.1":         1047576,
+	"gpt-4o":          128000,
+	"gpt-4-turbo":     128000,
+	"gpt-4-1106":      128000,
+	"gpt-4-0125":      128000,
+	"gpt-4-32k":       32768,
+	"gpt-4":           8192,
+	"gpt-3.5-turbo":   16385,
+	"chatgpt-4o":      128000,
+	"o1":              200000,
+	"o1-mini":         128000,
+	"o1-preview":      128000,
+	"o3":              200000,
+	"o4-mini":         200000,
+	"claude":          200000,
+	"text-embedding-": 8191,
+}
+
+var knownPricesPerMillionTokens = map[string][2]float64{
+	"gpt-4.1":           {2, 8},
+	"gpt-4o":            {2.5, 10},
+	"gpt-4o-mini":       {0.15, 0.6},
+	"gpt-4-turbo":       {10, 30},
+	"gpt-4":             {30, 60},
+	"gpt-4-32k":         {60, 120},
+	"gpt-3.5-turbo":     {0.5, 1.5},
+	"o1":                {15, 60},
+	"o1-mini":           {3, 12},
+	"claude-3-5-sonnet": {3, 15},
+	"claude-3-5-haiku":  {0.8, 4},
+	"claude-3-opus":     {15, 75},
+	"claude-3-haiku":    {0.25, 1.25},
+}
+
+var builtinModelAliases = map[string]string{
+	"4o":      "gpt-4o",
+	"4o-mini": "gpt-4o-mini",
+	"4.1":     "gpt-4.1",
+	"3.5":     "gpt-3.5-turbo",
+	"sonnet":  "claude-3-5-sonnet-latest",
+	"haiku":   "claude-3-5-haiku-latest",
+	"opus":    "claude-3-opus-latest",
+}
+
+const maxAliasDepth = 8
+
+func (app *App) modelAliases() map[string]string {
+	aliases := make(map[string]string, len(builtinModelAliases)+len(app.config.Aliases))
+	for alias, model := range builtinModelAliases {
+		aliases[alias] = model
+	}
+	for alias, model := range app.config.Aliases {
+		aliases[alias] = model
+	}
+	return aliases
+}
+
+func (app *App) resolveModel(model string) string {
+	aliases := app.modelAliases()
+	for i := 0; i < maxAliasDepth; i++ {
+		target, ok := aliases[model]
+		if !ok || target == model {
+			break
+		}
+		model = target
+	}
+	return model
+}
+
+func modelContextWindow(model string) (int, bool) {
+	return lookupByLongestPrefix(knownContextWindows, model)
+}
+
+func modelPrices(model string) ([2]float64, bool) {
+	return lookupByLongestPrefix(knownPricesPerMillionTokens, model)
+}
+
+func lookupByLongestPrefix[V any](table map[string]V, model string) (V, bool) {
+	bestPrefix := ""
+	for prefix := range table {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(bestPrefix) {
+			bestPrefix = prefix
+		}
+	}
+	if bestPrefix == "" {
+		var zero V
+		return zero, false
+	}
+	return table[bestPrefix], true
+}
+
+func modelFamily(model string) string {
+	segments := strings.Split(model, "-")
+	for i, segment := range segments {
+		if strings.ContainsFunc(segment, unicode.IsDigit) {
+			return strings.Join(segments[:i+1], "-")
+		}
+	}
+	return model
+}
+
+func formatTokenCount(n int) string {
+	if n >= 1000000 {
+		return fmt.Sprintf("%.0fM", float64(n)/1000000)
+	}
+	if n >= 1000 {
+		return fmt.Sprintf("%vk", (n+500)/1000)
+	}
+	return fmt.Sprint(n)
+}
+
+func filterModels(models []string, filter string) []string {
+	filter = strings.ToLower(filter)
+	var matches []string
+	for _, model := range models {
+		if strings.Contains(strings.ToLower(model), filter) {
+			matches = append(matches, model)
+		}
+	}
+	return matches
+}
+
+func groupModelsByFamily(models []string) ([]string, map[string][]string) {
+	groups := make(map[string][]string)
+	var families []string
+	for _, model := range models {
+		family := modelFamily(model)
+		if _, ok := groups[family]; !ok {
+			families = append(families, family)
+		}
+		groups[family] = append(groups[family], model)
+	}
+	slices.Sort(families)
+	for _, family := range families {
+		slices.Sort(groups[family])
+	}
+	return families, groups
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gen2brain/beeep"
+)
+
+var notifyMethods = []string{"bell", "desktop"}
+
+var sendDesktopNotification = func(title string, message string) error {
+	return beeep.Notify(title, message, "")
+}
+
+func notificationText(content string) string {
+	text := strings.Join(strings.Fields(content), " ")
+	if len([]rune(text)) > 120 {
+		text = string([]rune(text)[:120]) + "..."
+	}
+	return text
+}
+
+func (app *App) notifyCompletion(content string) {
+	switch app.notify {
+	case "bell":
+		app.printer.Print("\a")
+	case "desktop":
+		err := sendDesktopNotification("gptrepl: answer from "+app.model, notificationText(content))
+		if err != nil {
+			app.printer.PrintWarning("failed to send a desktop notification: %v\n", err)
+			app.printer.Print("\a")
+		}
+	}
+}
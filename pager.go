@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+)
+
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+var terminalSize = func() (int, int, bool) {
+	if !stdoutIsTerminal() {
+		return 0, 0, false
+	}
+	width, height, err := readline.GetSize(int(os.Stdout.Fd()))
+	return width, height, err == nil && width > 0 && height > 0
+}
+
+func screenLineCount(text string, width int) int {
+	count := 0
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		length := utf8.RuneCountInString(ansiEscapePattern.ReplaceAllString(line, ""))
+		count += max((length+width-1)/width, 1)
+	}
+	return count
+}
+
+func pagerCommand() ([]string, error) {
+	if value := strings.TrimSpace(os.Getenv("PAGER")); value != "" {
+		return splitCommandLine(value)
+	}
+	if _, err := exec.LookPath("less"); err == nil {
+		return []string{"less", "-R"}, nil
+	}
+	return nil, nil
+}
+
+func (app *App) printPaged(text string) {
+	width, height, ok := terminalSize()
+	if !ok || app.pagerDisabled || app.reader == nil || screenLineCount(text, width) < height {
+		app.printer.Print("%v", text)
+		return
+	}
+	pager, err := pagerCommand()
+	if err != nil {
+		app.printer.PrintWarning("invalid PAGER: %v\n", err)
+	}
+	if len(pager) > 0 {
+		cmd := exec.Command(pager[0], pager[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+		if err == nil {
+			app.transcript.write(text)
+			return
+		}
+		app.printer.PrintWarning("failed to run the pager: %v\n", err)
+	}
+	app.pageInternally(text, width, height)
+}
+
+func (app *App) pageInternally(text string, width int, height int) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	shown := 0
+	for shown < len(lines) {
+		page := 0
+		for rows := 0; shown+page < len(lines); page++ {
+			rows += screenLineCount(lines[shown+page], width)
+			if rows > height-1 && page > 0 {
+				break
+			}
+		}
+		app.printer.Print("%v\n", strings.Join(lines[shown:shown+page], "\n"))
+		shown += page
+		if shown >= len(lines) {
+			return
+		}
+		answer, err := app.readUserInput("-- More -- (Enter for the next page, q to quit) ")
+		if err != nil || strings.EqualFold(answer, "q") {
+			return
+		}
+	}
+}
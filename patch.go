@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+var diffLanguages = []string{"diff", "patch", "udiff"}
+
+func looksLikeDiff(text string) bool {
+	return strings.Contains(text, "\n@@ ") && (strings.HasPrefix(text, "--- ") || strings.Contains(text, "\n--- ") || strings.HasPrefix(text, "diff --git"))
+}
+
+func extractDiff(content string) (string, error) {
+	var diffs []string
+	for _, block := range codeBlocks(content) {
+		if slices.Contains(diffLanguages, strings.ToLower(block.language)) || looksLikeDiff(block.text) {
+			diffs = append(diffs, strings.TrimRight(block.text, "\n")+"\n")
+		}
+	}
+	if len(diffs) == 0 && looksLikeDiff(content) {
+		diffs = append(diffs, strings.TrimRight(content, "\n")+"\n")
+	}
+	if len(diffs) == 0 {
+		return "", fmt.Errorf("the last answer has no unified diff")
+	}
+	return strings.Join(diffs, ""), nil
+}
+
+func colorizeDiff(diff string) string {
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "diff "):
+			lines[i] = theme.DiffHeader.Sprint(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = theme.DiffHunk.Sprint(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = theme.DiffAdded.Sprint(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = theme.DiffRemoved.Sprint(line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func gitApply(diff string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"apply", "--recount"}, args...)...)
+	cmd.Stdin = strings.NewReader(diff)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", fmt.Errorf("the diff doesn't apply: %v", strings.TrimSpace(output.String()))
+	}
+	if err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+func (app *App) applyDiff(dryRun bool, yes bool) error {
+	index, err := lastMessageWithRole(app.context, "assistant")
+	if err != nil {
+		return err
+	}
+	diff, err := extractDiff(app.context[index].Content)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("%v", colorizeDiff(diff))
+	}
+	stat, err := gitApply(diff, "--check", "--stat")
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		app.printer.Print("%vThe diff applies cleanly (dry run, nothing was changed).\n", stat)
+		return nil
+	}
+	if !yes {
+		if app.reader == nil {
+			return fmt.Errorf("applying a diff requires confirmation, which is only possible in the interactive shell. Use /apply --yes to apply it anyway")
+		}
+		if !app.confirm("Apply these changes?") {
+			return nil
+		}
+	}
+	_, err = gitApply(diff)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("%vApplied.\n", stat)
+	}
+	return nil
+}
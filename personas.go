@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const personaExtension = ".md"
+
+func personasDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gptrepl", "personas"), nil
+}
+
+func listPersonas() ([]string, error) {
+	dir, err := personasDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), personaExtension)
+		if ok && !entry.IsDir() && name != "" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func loadPersona(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid persona name: '%v'", name)
+	}
+	dir, err := personasDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name+personaExtension)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no persona named '%v'. Create %v or run /persona list", name, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	prompt := strings.TrimSpace(strings.ReplaceAll(string(data), "\r\n", "\n"))
+	if prompt == "" {
+		return "", fmt.Errorf("%v is empty", path)
+	}
+	return prompt, nil
+}
+
+func withoutSystemMessages(ctx []Message) []Message {
+	return slices.DeleteFunc(slices.Clone(ctx), func(msg Message) bool {
+		return msg.Role == "system"
+	})
+}
+
+func (app *App) usePersona(name string, clear bool) error {
+	prompt, err := loadPersona(name)
+	if err != nil {
+		return err
+	}
+	ctx := app.context
+	if clear {
+		ctx = withoutSystemMessages(ctx)
+	}
+	app.setContext(withSystemPrompt(ctx, prompt))
+	return nil
+}
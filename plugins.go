@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const pluginCategory = "Plugins"
+
+func pluginsDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gptrepl", "plugins"), nil
+}
+
+func isExecutable(entry os.DirEntry) bool {
+	info, err := entry.Info()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return info.Mode().Perm()&0111 != 0
+}
+
+func (app *App) loadPlugins(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !isExecutable(entry) {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if name == "" || strings.ContainsAny(name, " \t") {
+			continue
+		}
+		if _, exists := app.commandHandlers[name]; exists {
+			app.printer.PrintWarning("ignoring the plugin %v: /%v already exists\n", entry.Name(), name)
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		app.commandHandlers[name] = Command{
+			fn: func(app *App, args string) error {
+				return app.runPlugin(path, args)
+			},
+			description: fmt.Sprintf(`Runs the plugin %v with the given arguments and the context as JSON on stdin. If it prints a context,
+			it replaces the current one. Any other output is appended to the context as a user message.`, path),
+			args:     [][]string{{"arguments?"}},
+			category: pluginCategory,
+		}
+	}
+	return nil
+}
+
+func parsePluginContext(output []byte) ([]Message, bool) {
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) == 0 || (trimmed[0] != '[' && trimmed[0] != '{') {
+		return nil, false
+	}
+	var envelope contextFileEnvelope
+	var err error
+	if trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &envelope.Messages)
+	} else {
+		err = json.Unmarshal(trimmed, &envelope)
+	}
+	if err != nil || envelope.Messages == nil {
+		return nil, false
+	}
+	for _, msg := range envelope.Messages {
+		if !session.IsRoleValid(msg.Role) {
+			return nil, false
+		}
+	}
+	return envelope.Messages, true
+}
+
+func (app *App) runPlugin(path string, args string) error {
+	arguments, err := splitCommandLine(args)
+	if err != nil {
+		return err
+	}
+	input, err := json.Marshal(contextFileEnvelope{Version: contextFileVersion, Metadata: app.contextMetadata(), Messages: app.context})
+	if err != nil {
+		return err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, arguments...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "GPTREPL_MODEL="+app.model)
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%v: %w: %v", filepath.Base(path), err, message)
+		}
+		return fmt.Errorf("%v: %w", filepath.Base(path), err)
+	}
+	if messages, ok := parsePluginContext(stdout.Bytes()); ok {
+		app.setContext(messages)
+		if !app.quiet {
+			app.printer.Print("The context was replaced by %v and now has %v messages.\n", filepath.Base(path), len(app.context))
+		}
+		return nil
+	}
+	output := strings.TrimSpace(stdout.String())
+	if output == "" {
+		return nil
+	}
+	if !app.quiet {
+		app.printer.Print("%v\n", output)
+	}
+	app.appendToContext(session.NewMessage("user", output))
+	return nil
+}
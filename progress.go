@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+type StreamObserver interface {
+	FirstDelta()
+	Finished(content string, err error)
+}
+
+type ProgressObserver struct {
+	printer UserPrinter
+	start   time.Time
+	first   time.Time
+	report  bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func (app *App) newProgressObserver() *ProgressObserver {
+	_, _, terminal := terminalSize()
+	observer := &ProgressObserver{printer: app.printer, start: time.Now(), report: !app.quiet && terminal && app.outputFormat != "jsonl"}
+	if observer.report && !app.tui {
+		observer.startSpinner()
+	}
+	return observer
+}
+
+func (o *ProgressObserver) startSpinner() {
+	o.stop = make(chan struct{})
+	o.stopped = make(chan struct{})
+	go func() {
+		defer close(o.stopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		drawn := false
+		for frame := 0; ; frame++ {
+			select {
+			case <-o.stop:
+				if drawn {
+					o.printer.Print("\r\x1b[K")
+				}
+				return
+			case <-ticker.C:
+				o.printer.Print("\r%v", theme.Dim.Sprintf("%v %.1fs", spinnerFrames[frame%len(spinnerFrames)], time.Since(o.start).Seconds()))
+				drawn = true
+			}
+		}
+	}()
+}
+
+func (o *ProgressObserver) stopSpinner() {
+	if o.stop == nil {
+		return
+	}
+	close(o.stop)
+	<-o.stopped
+	o.stop = nil
+}
+
+func (o *ProgressObserver) interrupt(show func()) {
+	spinning := o.stop != nil
+	o.stopSpinner()
+	show()
+	if spinning {
+		o.startSpinner()
+	}
+}
+
+func (o *ProgressObserver) elapsed() time.Duration {
+	return time.Since(o.start)
+}
+
+func (o *ProgressObserver) FirstDelta() {
+	o.first = time.Now()
+	o.stopSpinner()
+}
+
+func (o *ProgressObserver) Finished(content string, err error) {
+	o.stopSpinner()
+	if err != nil || !o.report || o.first.IsZero() {
+		return
+	}
+	o.printer.Print("%v\n", theme.Dim.Sprint(formatStreamTimings(o.first.Sub(o.start), time.Since(o.first), session.EstimateTokens(content))))
+}
+
+func formatStreamTimings(firstToken time.Duration, generation time.Duration, tokens int) string {
+	timings := fmt.Sprintf("first token after %.1fs, ~%v tokens in %.1fs", firstToken.Seconds(), tokens, (firstToken + generation).Seconds())
+	if generation > 0 {
+		timings += fmt.Sprintf(" (%.1f tokens/s)", float64(tokens)/generation.Seconds())
+	}
+	return timings
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/providers"
+)
+
+var providerNames = []string{"auto", "openai", "anthropic", "ollama", "mock"}
+
+var providerDefaultModels = map[string]string{
+	"openai":    "gpt-4",
+	"anthropic": "claude-3-5-sonnet-latest",
+	"ollama":    "llama3.1",
+	"mock":      providers.EchoDefaultModel,
+}
+
+const ollamaDefaultHost = "http://localhost:11434"
+
+const providerFlagUsage = "The model provider: auto, openai, anthropic, ollama or mock. \"auto\" uses OpenAI if an OpenAI API key is found, then Anthropic if $ANTHROPIC_API_KEY is set, then Ollama if it is running locally ($OLLAMA_HOST, defaults to " + ollamaDefaultHost + "). \"mock\" needs no API key and answers by repeating the last user message (see -mock-fixtures)."
+const modelFlagUsage = "The model ID string (e.g. gpt-3.5-turbo). Defaults to gpt-4 for OpenAI, claude-3-5-sonnet-latest for Anthropic and the first installed model for Ollama."
+const apiKeyFlagUsage = "The API key to use. Overrides $OPENAI_API_KEY and ~/.gptrepl-key (or $ANTHROPIC_API_KEY for Anthropic)."
+
+var ErrNoProvider = errors.New("no API key was provided and no local model server was found")
+
+func (app *App) selectProvider() error {
+	provider := app.provider
+	notice := ""
+	if provider == "" || provider == "auto" {
+		provider, notice = app.detectProvider()
+		if provider == "" {
+			return ErrNoProvider
+		}
+	}
+	switch provider {
+	case "openai":
+		key := app.apiKey
+		if key == "" {
+			key = openAIKeyFromEnvironment()
+		}
+		if key == "" {
+			return ErrNoProvider
+		}
+		app.useProvider("openai", providers.NewOpenAI(), key, providerDefaultModels["openai"])
+	case "anthropic":
+		key := app.apiKey
+		if key == "" {
+			key = os.Getenv("ANTHROPIC_API_KEY")
+		}
+		if key == "" {
+			return fmt.Errorf("an Anthropic API key was not provided (use -apikey or set ANTHROPIC_API_KEY)")
+		}
+		app.useProvider("anthropic", providers.NewAnthropic(), key, providerDefaultModels["anthropic"])
+	case "ollama":
+		host := ollamaHost()
+		models, err := providers.OllamaModels(host, 2*time.Second)
+		if err != nil {
+			return fmt.Errorf("could not reach Ollama at %v: %v", host, err)
+		}
+		defaultModel := providerDefaultModels["ollama"]
+		if len(models) > 0 {
+			defaultModel = models[0]
+		}
+		app.useProvider("ollama", providers.NewOllama(host), "ollama", defaultModel)
+	case "mock":
+		capi, err := providers.NewEcho(app.mockFixtures, app.mockDelay, app.mockErrorRate)
+		if err != nil {
+			return err
+		}
+		app.useProvider("mock", capi, "mock", providerDefaultModels["mock"])
+	default:
+		return fmt.Errorf("unknown provider \"%v\" (expected one of: %v)", provider, strings.Join(providerNames, ", "))
+	}
+	if notice != "" && !app.quiet {
+		app.printer.PrintWarning("%v, using %v with model %v (override with -provider and -model).\n", notice, app.provider, app.model)
+	}
+	return nil
+}
+
+func (app *App) detectProvider() (string, string) {
+	if app.apiKey != "" || openAIKeyFromEnvironment() != "" {
+		return "openai", ""
+	}
+	if os.Getenv("ANTHROPIC_API_KEY") != "" {
+		return "anthropic", "No OpenAI API key found but ANTHROPIC_API_KEY is set"
+	}
+	host := ollamaHost()
+	_, err := providers.OllamaModels(host, 300*time.Millisecond)
+	if err == nil {
+		return "ollama", fmt.Sprintf("No API key found but Ollama is running at %v", host)
+	}
+	return "", ""
+}
+
+func (app *App) useProvider(name string, capi CompletionAPI, key string, defaultModel string) {
+	app.provider = name
+	app.capi = capi
+	if app.model == "" {
+		app.model = defaultModel
+	}
+	app.SetModel(app.model)
+	app.SetApiKey(key)
+}
+
+func cloneCompletionAPI(capi CompletionAPI) (CompletionAPI, bool) {
+	switch c := capi.(type) {
+	case *InstrumentedCompletionAPI:
+		inner, ok := cloneCompletionAPI(c.CompletionAPI)
+		if !ok {
+			return nil, false
+		}
+		clone := *c
+		clone.CompletionAPI = inner
+		return &clone, true
+	case *CachingCompletionAPI:
+		inner, ok := cloneCompletionAPI(c.CompletionAPI)
+		if !ok {
+			return nil, false
+		}
+		clone := *c
+		clone.CompletionAPI = inner
+		return &clone, true
+	case *RedactingCompletionAPI:
+		inner, ok := cloneCompletionAPI(c.CompletionAPI)
+		if !ok {
+			return nil, false
+		}
+		clone := *c
+		clone.CompletionAPI = inner
+		return &clone, true
+	case *RecordingCompletionAPI:
+		inner, ok := cloneCompletionAPI(c.CompletionAPI)
+		if !ok {
+			return nil, false
+		}
+		clone := *c
+		clone.CompletionAPI = inner
+		return &clone, true
+	case interface{ Clone() CompletionAPI }:
+		return c.Clone(), true
+	}
+	return nil, false
+}
+
+func openAIKeyFromEnvironment() string {
+	key := os.Getenv("OPENAI_API_KEY")
+	if key != "" {
+		return key
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	keyBytes, err := os.ReadFile(path.Join(home, ".gptrepl-key"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(keyBytes))
+}
+
+func ollamaHost() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return ollamaDefaultHost
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
@@ -0,0 +1,254 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const anthropicDefaultBaseURL = "https://api.anthropic.com"
+const anthropicVersion = "2023-06-01"
+
+type Anthropic struct {
+	apiKey      string
+	model       string
+	temperature float32
+	baseURL     string
+	maxTokens   int
+	httpClient  *http.Client
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	Stream      bool               `json:"stream"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type AnthropicAPIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+	RequestID  string
+}
+
+func (e *AnthropicAPIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%v: %v", e.Type, e.Message)
+	}
+	return fmt.Sprintf("anthropic API returned status %v: %v: %v", e.StatusCode, e.Type, e.Message)
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		ID    string         `json:"id"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error anthropicError `json:"error"`
+}
+
+func NewAnthropic() *Anthropic {
+	return &Anthropic{temperature: session.DefaultTemperature, baseURL: anthropicDefaultBaseURL, maxTokens: 4096, httpClient: NewHTTPClient()}
+}
+
+func anthropicMessages(ctx []session.Message) (string, []anthropicMessage) {
+	var system []string
+	var messages []anthropicMessage
+	for _, msg := range ctx {
+		if msg.Role == "system" {
+			system = append(system, msg.Content)
+			continue
+		}
+		if len(messages) > 0 && messages[len(messages)-1].Role == msg.Role {
+			messages[len(messages)-1].Content += "\n\n" + msg.Content
+			continue
+		}
+		messages = append(messages, anthropicMessage{Role: msg.Role, Content: msg.Content})
+	}
+	return strings.Join(system, "\n\n"), messages
+}
+
+func (capi *Anthropic) newRequest(method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, capi.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", capi.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	req.Header.Set("content-type", "application/json")
+	return req, nil
+}
+
+func (capi *Anthropic) do(req *http.Request) (*http.Response, error) {
+	resp, err := capi.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body struct {
+			Error anthropicError `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		apiErr := &AnthropicAPIError{StatusCode: resp.StatusCode, Type: fmt.Sprintf("http_%v", resp.StatusCode), Message: strings.TrimSpace(string(data)), RequestID: resp.Header.Get("request-id")}
+		if json.Unmarshal(data, &body) == nil && body.Error.Message != "" {
+			apiErr.Type = body.Error.Type
+			apiErr.Message = body.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+func (capi *Anthropic) SendContext(ctx []session.Message) (<-chan session.Delta, error) {
+	system, messages := anthropicMessages(ctx)
+	request := anthropicRequest{Model: capi.model, MaxTokens: capi.maxTokens, System: system, Messages: messages, Stream: true}
+	if capi.temperature >= 0 {
+		request.Temperature = &capi.temperature
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := capi.newRequest(http.MethodPost, "/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	logRequest("anthropic", capi.baseURL, capi.model, capi.temperature, ctx)
+	start := time.Now()
+	resp, err := capi.do(req)
+	if err != nil {
+		logRequestError("anthropic", err, start)
+		return nil, err
+	}
+	out := make(chan session.Delta, 32)
+	go func() {
+		defer close(out)
+		defer resp.Body.Close()
+		var id, stopReason string
+		var usage anthropicUsage
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			var event anthropicStreamEvent
+			if json.Unmarshal([]byte(strings.TrimSpace(data)), &event) != nil {
+				continue
+			}
+			switch event.Type {
+			case "message_start":
+				id = event.Message.ID
+				usage = event.Message.Usage
+			case "message_delta":
+				stopReason = event.Delta.StopReason
+				usage.OutputTokens = event.Usage.OutputTokens
+			case "content_block_delta":
+				if event.Delta.Type == "text_delta" {
+					out <- session.Delta{Text: event.Delta.Text, Err: nil}
+				}
+			case "error":
+				apiErr := &AnthropicAPIError{Type: event.Error.Type, Message: event.Error.Message, RequestID: resp.Header.Get("request-id")}
+				logRequestError("anthropic", apiErr, start)
+				out <- session.Delta{Text: "", Err: apiErr}
+				return
+			case "message_stop":
+				logResponse("anthropic", id, stopReason, usage.InputTokens, usage.OutputTokens, start)
+				out <- session.Delta{Text: "", Err: io.EOF}
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			logRequestError("anthropic", err, start)
+			out <- session.Delta{Text: "", Err: err}
+			return
+		}
+		logResponse("anthropic", id, stopReason, usage.InputTokens, usage.OutputTokens, start)
+		out <- session.Delta{Text: "", Err: io.EOF}
+	}()
+	return out, nil
+}
+
+func (capi *Anthropic) Clone() session.CompletionAPI {
+	clone := *capi
+	return &clone
+}
+
+func (capi *Anthropic) BaseURL() string {
+	return capi.baseURL
+}
+
+func (capi *Anthropic) SetBaseURL(url string) {
+	capi.baseURL = url
+}
+
+func (capi *Anthropic) SetModel(model string) {
+	capi.model = model
+}
+
+func (capi *Anthropic) SetTemperature(temperature float32) {
+	capi.temperature = temperature
+}
+
+func (capi *Anthropic) SetApiKey(key string) {
+	capi.apiKey = key
+}
+
+func (capi *Anthropic) ListModels() ([]string, error) {
+	req, err := capi.newRequest(http.MethodGet, "/v1/models?limit=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := capi.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	if err != nil {
+		return nil, err
+	}
+	models := make([]string, len(list.Data))
+	for i, model := range list.Data {
+		models[i] = model.ID
+	}
+	return models, nil
+}
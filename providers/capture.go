@@ -0,0 +1,157 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const maxCapturedEvents = 200
+
+var redactedHeaders = []string{"Authorization", "X-Api-Key", "Api-Key"}
+
+type ExchangeCapture struct {
+	mu      sync.Mutex
+	request string
+	status  string
+	events  []string
+	next    int
+	total   int
+}
+
+var LastExchange = &ExchangeCapture{}
+
+func (c *ExchangeCapture) start(request string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.request = request
+	c.status = ""
+	c.events = nil
+	c.next = 0
+	c.total = 0
+}
+
+func (c *ExchangeCapture) setStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+func (c *ExchangeCapture) addEvent(event string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total++
+	if len(c.events) < maxCapturedEvents {
+		c.events = append(c.events, event)
+		return
+	}
+	c.events[c.next] = event
+	c.next = (c.next + 1) % maxCapturedEvents
+}
+
+func (c *ExchangeCapture) Snapshot() (request string, status string, events []string, total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.request, c.status, slices.Concat(c.events[c.next:], c.events[:c.next]), c.total
+}
+
+func isCompletionRequest(req *http.Request) bool {
+	return req.Method == http.MethodPost && (strings.HasSuffix(req.URL.Path, "/chat/completions") || strings.HasSuffix(req.URL.Path, "/messages"))
+}
+
+func RedactSecret(value string) string {
+	scheme, secret, found := strings.Cut(value, " ")
+	if !found {
+		secret, scheme = value, ""
+	} else {
+		scheme += " "
+	}
+	if len(secret) > 8 {
+		return scheme + secret[:3] + "...REDACTED"
+	}
+	return scheme + "REDACTED"
+}
+
+func serializeRequest(req *http.Request, body []byte) string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "%v %v\n", req.Method, req.URL)
+	var names []string
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value := strings.Join(req.Header[name], ", ")
+		if slices.Contains(redactedHeaders, http.CanonicalHeaderKey(name)) {
+			value = RedactSecret(value)
+		}
+		fmt.Fprintf(&result, "%v: %v\n", name, value)
+	}
+	var indented bytes.Buffer
+	if json.Indent(&indented, body, "", "  ") == nil {
+		body = indented.Bytes()
+	}
+	fmt.Fprintf(&result, "\n%s", body)
+	return result.String()
+}
+
+type captureTransport struct {
+	base    http.RoundTripper
+	capture *ExchangeCapture
+}
+
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isCompletionRequest(req) {
+		return t.base.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	t.capture.start(serializeRequest(req, body))
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.capture.setStatus(fmt.Sprintf("error: %v", err))
+		return nil, err
+	}
+	t.capture.setStatus(resp.Status)
+	resp.Body = &capturingBody{ReadCloser: resp.Body, capture: t.capture}
+	return resp, nil
+}
+
+type capturingBody struct {
+	io.ReadCloser
+	capture *ExchangeCapture
+	partial []byte
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.partial = append(b.partial, p[:n]...)
+	for {
+		idx := bytes.IndexByte(b.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(b.partial[:idx])); line != "" {
+			b.capture.addEvent(line)
+		}
+		b.partial = b.partial[idx+1:]
+	}
+	if err != nil && len(bytes.TrimSpace(b.partial)) > 0 {
+		b.capture.addEvent(strings.TrimSpace(string(b.partial)))
+		b.partial = nil
+	}
+	return n, err
+}
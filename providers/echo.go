@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const EchoDefaultModel = "echo"
+
+type EchoFixture struct {
+	Match    string `json:"match"`
+	Response string `json:"response"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Echo struct {
+	model     string
+	fixtures  []EchoFixture
+	delay     time.Duration
+	errorRate float64
+}
+
+func NewEcho(fixturesPath string, delay time.Duration, errorRate float64) (*Echo, error) {
+	if errorRate < 0 || errorRate > 1 {
+		return nil, fmt.Errorf("-mock-errors must be between 0 and 1")
+	}
+	capi := &Echo{delay: delay, errorRate: errorRate}
+	if fixturesPath != "" {
+		data, err := os.ReadFile(fixturesPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &capi.fixtures); err != nil {
+			return nil, fmt.Errorf("%v: %w", fixturesPath, err)
+		}
+	}
+	return capi, nil
+}
+
+func lastUserMessage(messages []session.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+func (capi *Echo) response(question string) (string, error) {
+	for _, fixture := range capi.fixtures {
+		if strings.Contains(question, fixture.Match) {
+			if fixture.Error != "" {
+				return "", errors.New(fixture.Error)
+			}
+			return fixture.Response, nil
+		}
+	}
+	return "You said: " + question, nil
+}
+
+func streamingChunks(text string) []string {
+	var chunks []string
+	start := 0
+	for i, c := range text {
+		if i > start && unicode.IsSpace(c) {
+			chunks = append(chunks, text[start:i])
+			start = i
+		}
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
+
+func (capi *Echo) SendContext(messages []session.Message) (<-chan session.Delta, error) {
+	if capi.errorRate > 0 && rand.Float64() < capi.errorRate {
+		return nil, fmt.Errorf("mock provider: injected error")
+	}
+	response, err := capi.response(lastUserMessage(messages))
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan session.Delta, 32)
+	go func() {
+		defer close(out)
+		for _, chunk := range streamingChunks(response) {
+			time.Sleep(capi.delay)
+			out <- session.Delta{Text: chunk}
+		}
+		out <- session.Delta{Err: io.EOF}
+	}()
+	return out, nil
+}
+
+func (capi *Echo) Clone() session.CompletionAPI {
+	clone := *capi
+	return &clone
+}
+
+func (capi *Echo) SetModel(model string) {
+	capi.model = model
+}
+
+func (capi *Echo) SetApiKey(string) {
+}
+
+func (capi *Echo) SetTemperature(float32) {
+}
+
+func (capi *Echo) ListModels() ([]string, error) {
+	return []string{EchoDefaultModel}, nil
+}
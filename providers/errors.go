@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type APIRequestError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *APIRequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIRequestError) Unwrap() error {
+	return e.Err
+}
+
+type ProviderError struct {
+	Status  int
+	Type    string
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *ProviderError) Error() string {
+	var details []string
+	if e.Status > 0 {
+		details = append(details, fmt.Sprintf("status %v", e.Status))
+	}
+	if e.Type != "" {
+		details = append(details, "type "+e.Type)
+	}
+	if e.Code != "" && e.Code != e.Type {
+		details = append(details, "code "+e.Code)
+	}
+	if len(details) == 0 {
+		return "the API returned an error: " + e.Message
+	}
+	return fmt.Sprintf("the API returned an error (%v): %v", strings.Join(details, ", "), e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+type requestIDTransport struct {
+	base http.RoundTripper
+	last atomic.Value
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		for _, header := range []string{"x-request-id", "request-id"} {
+			if id := resp.Header.Get(header); id != "" {
+				t.last.Store(id)
+				break
+			}
+		}
+	}
+	return resp, err
+}
+
+func lastRequestID(client *http.Client) string {
+	transport, ok := client.Transport.(*requestIDTransport)
+	if !ok {
+		return ""
+	}
+	id, _ := transport.last.Load().(string)
+	return id
+}
+
+func OpenAIErrorCode(err *openai.APIError) string {
+	if code, ok := err.Code.(string); ok && code != "" {
+		return code
+	}
+	if err.Type != "" {
+		return err.Type
+	}
+	return fmt.Sprintf("http_%v", err.HTTPStatusCode)
+}
+
+func NewProviderError(err error) (*ProviderError, bool) {
+	var openaiErr *openai.APIError
+	var anthropicErr *AnthropicAPIError
+	switch {
+	case errors.As(err, &openaiErr):
+		providerErr := &ProviderError{Status: openaiErr.HTTPStatusCode, Type: openaiErr.Type, Message: openaiErr.Message, Err: err}
+		if openaiErr.Code != nil {
+			providerErr.Code = fmt.Sprint(openaiErr.Code)
+		}
+		return providerErr, true
+	case errors.As(err, &anthropicErr):
+		return &ProviderError{Status: anthropicErr.StatusCode, Type: anthropicErr.Type, Message: anthropicErr.Message, Err: err}, true
+	}
+	return nil, false
+}
+
+func IsContextLengthError(err error) bool {
+	providerErr, ok := NewProviderError(err)
+	if !ok {
+		return false
+	}
+	if providerErr.Code == "context_length_exceeded" {
+		return true
+	}
+	message := strings.ToLower(providerErr.Message)
+	for _, phrase := range []string{"maximum context length", "context window", "prompt is too long", "too many tokens"} {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+func IsRetryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
@@ -0,0 +1,38 @@
+package providers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+var Logger = slog.New(slog.DiscardHandler)
+
+func debugLogEnabled() bool {
+	return Logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+func logRequest(api string, endpoint string, model string, temperature float32, messages []session.Message) {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += session.EstimateTokens(msg.Content)
+	}
+	attrs := []any{"api", api, "model", model, "messages", len(messages), "estimated_tokens", tokens}
+	if endpoint != "" {
+		attrs = append(attrs, "endpoint", endpoint)
+	}
+	if temperature >= 0 {
+		attrs = append(attrs, "temperature", temperature)
+	}
+	Logger.Debug("request", attrs...)
+}
+
+func logResponse(api string, id string, finishReason string, promptTokens int, completionTokens int, start time.Time) {
+	Logger.Debug("response", "api", api, "id", id, "finish_reason", finishReason, "prompt_tokens", promptTokens, "completion_tokens", completionTokens, "duration_ms", time.Since(start).Milliseconds())
+}
+
+func logRequestError(api string, err error, start time.Time) {
+	Logger.Debug("request failed", "api", api, "error", err.Error(), "duration_ms", time.Since(start).Milliseconds())
+}
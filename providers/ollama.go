@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func OllamaModels(host string, timeout time.Duration) ([]string, error) {
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Get(host + "/api/tags")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tags)
+	if err != nil {
+		return nil, err
+	}
+	models := make([]string, len(tags.Models))
+	for i, model := range tags.Models {
+		models[i] = model.Name
+	}
+	return models, nil
+}
+
+func NewOllama(host string) *OpenAI {
+	capi := NewOpenAI()
+	capi.SetBaseURL(host + "/v1")
+	return capi
+}
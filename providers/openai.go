@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type OpenAI struct {
+	apiKey      string
+	model       string
+	temperature float32
+	baseURL     string
+	httpClient  *http.Client
+	client      *openai.Client
+}
+
+func NewOpenAI() *OpenAI {
+	return &OpenAI{temperature: session.DefaultTemperature, httpClient: NewHTTPClient()}
+}
+
+func NewHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 32
+	transport.MaxIdleConnsPerHost = 16
+	transport.IdleConnTimeout = 90 * time.Second
+	return &http.Client{Transport: &requestIDTransport{base: &captureTransport{base: transport, capture: LastExchange}}}
+}
+
+func (capi *OpenAI) Client() *openai.Client {
+	if capi.client == nil {
+		capi.rebuildClient()
+	}
+	return capi.client
+}
+
+func (capi *OpenAI) rebuildClient() {
+	if capi.httpClient == nil {
+		capi.httpClient = NewHTTPClient()
+	}
+	config := openai.DefaultConfig(capi.apiKey)
+	if capi.baseURL != "" {
+		config.BaseURL = capi.baseURL
+	}
+	config.HTTPClient = capi.httpClient
+	capi.client = openai.NewClientWithConfig(config)
+}
+
+func (capi *OpenAI) SendContext(ctx []session.Message) (<-chan session.Delta, error) {
+	client := capi.Client()
+	background := context.Background()
+	messages := make([]openai.ChatCompletionMessage, len(ctx))
+	for i, msg := range ctx {
+		messages[i] = openai.ChatCompletionMessage{Role: msg.Role, Content: msg.Content}
+	}
+	req := openai.ChatCompletionRequest{Model: capi.model, Stream: true, Messages: messages}
+	if capi.temperature == 0 {
+		req.Temperature = math.SmallestNonzeroFloat32
+	} else if capi.temperature > 0 {
+		req.Temperature = capi.temperature
+	}
+	if debugLogEnabled() {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	logRequest("openai", capi.baseURL, capi.model, capi.temperature, ctx)
+	start := time.Now()
+	stream, err := client.CreateChatCompletionStream(background, req)
+	if err != nil {
+		logRequestError("openai", err, start)
+		return nil, &APIRequestError{RequestID: lastRequestID(capi.httpClient), Err: fmt.Errorf("CreateChatCompletionStream: %w", err)}
+	}
+	out := make(chan session.Delta, 32)
+	go func() {
+		defer close(out)
+		defer stream.Close()
+		var id string
+		var finishReason openai.FinishReason
+		var usage openai.Usage
+		for {
+			response, err := stream.Recv()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					logResponse("openai", id, string(finishReason), usage.PromptTokens, usage.CompletionTokens, start)
+				} else {
+					logRequestError("openai", err, start)
+					err = &APIRequestError{RequestID: lastRequestID(capi.httpClient), Err: err}
+				}
+				out <- session.Delta{Text: "", Err: err}
+				break
+			}
+			if response.ID != "" {
+				id = response.ID
+			}
+			if response.Usage != nil {
+				usage = *response.Usage
+			}
+			if len(response.Choices) == 0 {
+				continue
+			}
+			if response.Choices[0].FinishReason != "" {
+				finishReason = response.Choices[0].FinishReason
+			}
+			delta := response.Choices[0].Delta.Content
+			out <- session.Delta{Text: delta, Err: nil}
+		}
+	}()
+	return out, nil
+}
+
+func (capi *OpenAI) Clone() session.CompletionAPI {
+	clone := *capi
+	return &clone
+}
+
+func (capi *OpenAI) BaseURL() string {
+	return capi.baseURL
+}
+
+func (capi *OpenAI) SetBaseURL(url string) {
+	capi.baseURL = url
+	capi.client = nil
+}
+
+func (capi *OpenAI) SetModel(model string) {
+	capi.model = model
+}
+
+func (capi *OpenAI) SetTemperature(temperature float32) {
+	capi.temperature = temperature
+}
+
+func (capi *OpenAI) SetApiKey(key string) {
+	capi.apiKey = key
+	capi.rebuildClient()
+}
+
+func (capi *OpenAI) ListModels() ([]string, error) {
+	list, err := capi.Client().ListModels(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("ListModels: %w", err)
+	}
+	models := make([]string, len(list.Models))
+	for i, model := range list.Models {
+		models[i] = model.ID
+	}
+	return models, nil
+}
@@ -0,0 +1,185 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Sa-RSt/gptrepl/session"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestOpenAIReusesClient(t *testing.T) {
+	capi := NewOpenAI()
+	capi.SetApiKey("sk-a")
+	first := capi.Client()
+	if capi.Client() != first {
+		t.Fatalf("expected the client to be reused")
+	}
+	httpClient := capi.httpClient
+	capi.SetApiKey("sk-b")
+	if capi.Client() == first {
+		t.Fatalf("expected a new client after changing the API key")
+	}
+	if capi.httpClient != httpClient {
+		t.Fatalf("expected the HTTP client to be kept after changing the API key")
+	}
+}
+
+func TestAnthropicMessages(t *testing.T) {
+	system, messages := anthropicMessages([]session.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "a"},
+		{Role: "user", Content: "b"},
+		{Role: "assistant", Content: "c"},
+	})
+	if system != "be brief" {
+		t.Fatalf("expected system prompt to be extracted, got %q", system)
+	}
+	expected := []anthropicMessage{{Role: "user", Content: "a\n\nb"}, {Role: "assistant", Content: "c"}}
+	if !slices.Equal(messages, expected) {
+		t.Fatalf("expected %v, got %v", expected, messages)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	var request anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "sk-ant-test" || r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected request to %v", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`event: message_start
+data: {"type": "message_start"}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "delta": {"type": "text_delta", "text": "Hello"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "delta": {"type": "text_delta", "text": " world"}}
+
+event: message_stop
+data: {"type": "message_stop"}
+
+`))
+	}))
+	defer server.Close()
+	capi := NewAnthropic()
+	capi.baseURL = server.URL
+	capi.SetApiKey("sk-ant-test")
+	capi.SetModel("claude-test")
+	stream, err := capi.SendContext([]session.Message{{Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatalf("expected no errors, got %v", err)
+	}
+	content, err := session.Collect(stream, func(string) {})
+	if err != nil || content != "Hello world" {
+		t.Fatalf("expected \"Hello world\", got %q (%v)", content, err)
+	}
+	if request.Model != "claude-test" || !request.Stream || len(request.Messages) != 1 {
+		t.Fatalf("unexpected request %+v", request)
+	}
+}
+
+func TestAnthropicError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+	capi := NewAnthropic()
+	capi.baseURL = server.URL
+	_, err := capi.SendContext([]session.Message{{Role: "user", Content: "hi"}})
+	if err == nil || !strings.Contains(err.Error(), "invalid x-api-key") {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+}
+
+func TestLoggerOpenAI(t *testing.T) {
+	previous := Logger
+	defer func() { Logger = previous }()
+	var log bytes.Buffer
+	Logger = slog.New(slog.NewJSONHandler(&log, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	var request openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"content": "Hi"}}]}
+
+data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {}, "finish_reason": "stop"}]}
+
+data: {"id": "chatcmpl-1", "choices": [], "usage": {"prompt_tokens": 9, "completion_tokens": 1, "total_tokens": 10}}
+
+data: [DONE]
+
+`))
+	}))
+	defer server.Close()
+	capi := NewOpenAI()
+	capi.baseURL = server.URL + "/v1"
+	capi.SetApiKey("sk-test")
+	capi.SetModel("gpt-test")
+	stream, err := capi.SendContext([]session.Message{{Role: "user", Content: "hello there"}})
+	if err != nil {
+		t.Fatalf("expected no errors, got %v", err)
+	}
+	content, err := session.Collect(stream, func(string) {})
+	if err != nil || content != "Hi" {
+		t.Fatalf("expected \"Hi\", got %q (%v)", content, err)
+	}
+	if request.StreamOptions == nil || !request.StreamOptions.IncludeUsage {
+		t.Fatalf("expected the usage to be requested while logging")
+	}
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(log.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 || entries[0]["msg"] != "request" || entries[1]["msg"] != "response" {
+		t.Fatalf("unexpected log %v", log.String())
+	}
+	if entries[0]["model"] != "gpt-test" || entries[0]["messages"] != 1.0 || entries[0]["estimated_tokens"] != float64(session.EstimateTokens("hello there")) {
+		t.Fatalf("unexpected request entry %v", entries[0])
+	}
+	if entries[1]["id"] != "chatcmpl-1" || entries[1]["finish_reason"] != "stop" || entries[1]["prompt_tokens"] != 9.0 || entries[1]["completion_tokens"] != 1.0 {
+		t.Fatalf("unexpected response entry %v", entries[1])
+	}
+}
+
+func TestEchoChunksAndErrors(t *testing.T) {
+	if !slices.Equal(streamingChunks("a bc  d"), []string{"a", " bc", " ", " d"}) {
+		t.Fatalf("unexpected chunks %q", streamingChunks("a bc  d"))
+	}
+	capi, err := NewEcho("", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := capi.SendContext([]session.Message{{Role: "user", Content: "hi"}}); err == nil {
+		t.Fatalf("expected an injected error")
+	}
+}
+
+func TestExchangeCaptureKeepsLastEvents(t *testing.T) {
+	capture := &ExchangeCapture{}
+	capture.start("POST /v1/chat/completions")
+	capture.setStatus("200 OK")
+	for i := 0; i < maxCapturedEvents+5; i++ {
+		capture.addEvent(fmt.Sprintf("event %v", i))
+	}
+	request, status, events, total := capture.Snapshot()
+	if request != "POST /v1/chat/completions" || status != "200 OK" || total != maxCapturedEvents+5 || len(events) != maxCapturedEvents {
+		t.Fatalf("unexpected capture %q %q %v of %v", request, status, len(events), total)
+	}
+	if events[0] != "event 5" || events[len(events)-1] != fmt.Sprintf("event %v", maxCapturedEvents+4) {
+		t.Fatalf("unexpected events %q ... %q", events[0], events[len(events)-1])
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type proxyMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+type proxyChoice struct {
+	Index        int           `json:"index"`
+	Delta        *proxyMessage `json:"delta,omitempty"`
+	Message      *proxyMessage `json:"message,omitempty"`
+	FinishReason *string       `json:"finish_reason"`
+}
+
+type proxyUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type proxyCompletion struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []proxyChoice `json:"choices"`
+	Usage   *proxyUsage   `json:"usage,omitempty"`
+}
+
+type proxyModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func writeProxyError(w http.ResponseWriter, status int, report ErrorReport) {
+	writeJSON(w, status, map[string]any{"error": map[string]any{"message": report.Message, "type": "gptrepl_error", "code": report.Code}})
+}
+
+func proxiedMessages(request openai.ChatCompletionRequest) ([]Message, error) {
+	var messages []Message
+	for idx, msg := range request.Messages {
+		content := msg.Content
+		if content == "" && len(msg.MultiContent) > 0 {
+			var parts []string
+			for _, part := range msg.MultiContent {
+				if part.Type != openai.ChatMessagePartTypeText {
+					return nil, fmt.Errorf("message #%v (starting from zero) contains a %v part, but only text is supported", idx, part.Type)
+				}
+				parts = append(parts, part.Text)
+			}
+			content = strings.Join(parts, "\n")
+		}
+		role := msg.Role
+		if role == "developer" {
+			role = "system"
+		}
+		if !session.IsRoleValid(role) {
+			return nil, fmt.Errorf("message #%v (starting from zero) has the unsupported role %q", idx, msg.Role)
+		}
+		messages = append(messages, Message{Role: role, Content: content})
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages were sent")
+	}
+	return messages, nil
+}
+
+func (s *Server) proxyModel(requested string, messages []Message) string {
+	model := s.app.model
+	if requested != "" {
+		model = s.app.resolveModel(requested)
+	}
+	last := &messages[len(messages)-1]
+	if s.app.router == "" || last.Role != "user" {
+		return model
+	}
+	content, routed, _ := s.app.routeQuestion(last.Content)
+	last.Content = content
+	if routed == s.app.cheapModel {
+		return routed
+	}
+	return model
+}
+
+func (s *Server) completionAPI(model string) (CompletionAPI, func()) {
+	if capi, ok := cloneCompletionAPI(s.app.capi); ok {
+		capi.SetModel(model)
+		s.mu.Unlock()
+		return capi, func() {}
+	}
+	defaultModel := s.app.model
+	s.app.capi.SetModel(model)
+	return s.app.capi, func() {
+		s.app.capi.SetModel(defaultModel)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var request openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeProxyError(w, http.StatusBadRequest, ErrorReport{Code: "invalid_request", Message: err.Error()})
+		return
+	}
+	messages, err := proxiedMessages(request)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, ErrorReport{Code: "invalid_request", Message: err.Error()})
+		return
+	}
+	s.mu.Lock()
+	messages = append(s.injected[:len(s.injected):len(s.injected)], messages...)
+	model := s.proxyModel(request.Model, messages)
+	capi, release := s.completionAPI(model)
+	defer release()
+	stream, err := sendWithRetries(capi, messages, s.app.maxRetries, nil)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, newErrorReport(err, s.app.provider))
+		return
+	}
+	completion := proxyCompletion{ID: fmt.Sprintf("chatcmpl-gptrepl-%v", time.Now().UnixNano()), Created: time.Now().Unix(), Model: model}
+	stop := "stop"
+	if !request.Stream {
+		content, err := session.Collect(stream, func(string) {})
+		if err != nil {
+			writeProxyError(w, http.StatusBadGateway, newErrorReport(err, s.app.provider))
+			return
+		}
+		usage := proxyUsage{CompletionTokens: session.EstimateTokens(content)}
+		for _, msg := range messages {
+			usage.PromptTokens += session.EstimateTokens(msg.Content)
+		}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		completion.Object = "chat.completion"
+		completion.Choices = []proxyChoice{{Message: &proxyMessage{Role: "assistant", Content: content}, FinishReason: &stop}}
+		completion.Usage = &usage
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	sse := &sseWriter{w: w}
+	completion.Object = "chat.completion.chunk"
+	writeChunk := func(choice proxyChoice) {
+		completion.Choices = []proxyChoice{choice}
+		data, _ := json.Marshal(completion)
+		sse.Write(data)
+	}
+	writeChunk(proxyChoice{Delta: &proxyMessage{Role: "assistant"}})
+	_, err = session.Collect(stream, func(delta string) {
+		writeChunk(proxyChoice{Delta: &proxyMessage{Content: delta}})
+	})
+	if err != nil {
+		data, _ := json.Marshal(map[string]any{"error": map[string]any{"message": err.Error(), "type": "gptrepl_error"}})
+		sse.Write(data)
+		return
+	}
+	writeChunk(proxyChoice{Delta: &proxyMessage{}, FinishReason: &stop})
+	sse.Write([]byte("[DONE]"))
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	capi, release := s.completionAPI(s.app.model)
+	defer release()
+	models, err := capi.ListModels()
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, newErrorReport(err, s.app.provider))
+		return
+	}
+	data := []proxyModel{}
+	for _, model := range models {
+		data = append(data, proxyModel{ID: model, Object: "model", OwnedBy: s.app.provider})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+}
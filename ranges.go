@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const rangeSyntaxHelp = `Ranges use 1-based message numbers: N selects one message, A:B (or A..B) selects messages A through B (either end
+		may be omitted), negative numbers count from the end (-4: selects the last four messages), last selects the last message and last-turn
+		selects the last user message and everything after it.`
+
+type CommandArguments struct {
+	flags      []string
+	options    map[string]string
+	positional []string
+}
+
+func parseCommandArguments(args string) CommandArguments {
+	parsed := CommandArguments{options: make(map[string]string)}
+	for _, arg := range strings.Fields(args) {
+		key, value, isOption := strings.Cut(arg, "=")
+		switch {
+		case strings.HasPrefix(arg, "-") && !isMessageRange(arg):
+			parsed.flags = append(parsed.flags, arg)
+		case isOption && key != "":
+			parsed.options[key] = value
+		default:
+			parsed.positional = append(parsed.positional, arg)
+		}
+	}
+	return parsed
+}
+
+func normalizeRangeSpec(spec string) string {
+	return strings.Replace(spec, "..", ":", 1)
+}
+
+func parseMessageRange(spec string, ctx []Message) (int, int, error) {
+	spec = normalizeRangeSpec(spec)
+	switch spec {
+	case "all", ":":
+		return 0, len(ctx), nil
+	case "last":
+		if len(ctx) == 0 {
+			return 0, 0, fmt.Errorf("the context is empty")
+		}
+		return len(ctx) - 1, len(ctx), nil
+	case "last-turn":
+		for i := len(ctx) - 1; i >= 0; i-- {
+			if ctx[i].Role == "user" {
+				return i, len(ctx), nil
+			}
+		}
+		return 0, 0, fmt.Errorf("the context has no user messages")
+	}
+	first, last, isRange := strings.Cut(spec, ":")
+	start, err := parseMessageNumber(first, 1, len(ctx))
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		if first == "" {
+			return 0, 0, fmt.Errorf("empty range")
+		}
+		last = first
+	}
+	end, err := parseMessageNumber(last, len(ctx), len(ctx))
+	if err != nil {
+		return 0, 0, err
+	}
+	if start < 1 || end > len(ctx) || start > end {
+		return 0, 0, fmt.Errorf("range %v is out of bounds: the context has %v messages", spec, len(ctx))
+	}
+	return start - 1, end, nil
+}
+
+func parseMessageIndex(spec string, ctx []Message) (int, error) {
+	if strings.Contains(normalizeRangeSpec(spec), ":") {
+		return 0, fmt.Errorf("expected a single message number, got a range")
+	}
+	start, end, err := parseMessageRange(spec, ctx)
+	if err != nil {
+		return 0, err
+	}
+	if end-start != 1 {
+		return 0, fmt.Errorf("expected a single message number")
+	}
+	return start, nil
+}
+
+func parseMessageNumber(s string, fallback int, length int) (int, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid message number '%v'", s)
+	}
+	if n < 0 {
+		n = length + n + 1
+	}
+	return n, nil
+}
+
+func isMessageRange(spec string) bool {
+	if spec == "all" || spec == "last" || spec == "last-turn" {
+		return true
+	}
+	spec = normalizeRangeSpec(spec)
+	first, last, _ := strings.Cut(spec, ":")
+	for _, part := range []string{first, last} {
+		if part == "" {
+			continue
+		}
+		_, err := strconv.Atoi(part)
+		if err != nil {
+			return false
+		}
+	}
+	return spec != ""
+}
+
+func cutRangeArgument(args string) (string, string) {
+	i := strings.LastIndex(args, " ")
+	if i < 0 || !isMessageRange(args[i+1:]) {
+		return args, ""
+	}
+	return strings.TrimSpace(args[:i]), args[i+1:]
+}
+
+func (app *App) selectMessages(spec string) ([]Message, error) {
+	if spec == "" {
+		return app.context, nil
+	}
+	start, end, err := parseMessageRange(spec, app.context)
+	if err != nil {
+		return nil, err
+	}
+	return app.context[start:end], nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+type secretPattern struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+var builtinSecretPatterns = []secretPattern{
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"API key", regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"AWS secret key", regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}`)},
+}
+
+type RedactingCompletionAPI struct {
+	CompletionAPI
+	patterns []secretPattern
+	warn     func(kind string)
+	mu       *sync.Mutex
+	warned   map[string]bool
+}
+
+func newRedactingCompletionAPI(capi CompletionAPI, custom []string, warn func(kind string)) (*RedactingCompletionAPI, error) {
+	patterns := append([]secretPattern{}, builtinSecretPatterns...)
+	for _, expr := range custom {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		patterns = append(patterns, secretPattern{"custom pattern", pattern})
+	}
+	return &RedactingCompletionAPI{CompletionAPI: capi, patterns: patterns, warn: warn, mu: &sync.Mutex{}, warned: make(map[string]bool)}, nil
+}
+
+func (r *RedactingCompletionAPI) redact(text string) string {
+	for _, secret := range r.patterns {
+		text = secret.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			r.mu.Lock()
+			if !r.warned[match] {
+				r.warned[match] = true
+				r.warn(secret.kind)
+			}
+			r.mu.Unlock()
+			return "[REDACTED " + secret.kind + "]"
+		})
+	}
+	return text
+}
+
+func (r *RedactingCompletionAPI) redactMessages(messages []Message) []Message {
+	redacted := make([]Message, len(messages))
+	for i, msg := range messages {
+		redacted[i] = msg
+		redacted[i].Content = r.redact(msg.Content)
+	}
+	return redacted
+}
+
+func (r *RedactingCompletionAPI) SendContext(messages []Message) (<-chan CompletionDelta, error) {
+	return r.CompletionAPI.SendContext(r.redactMessages(messages))
+}
+
+func (app *App) startRedacting() error {
+	redactor, err := newRedactingCompletionAPI(app.capi, app.config.Redaction.Patterns, func(kind string) {
+		app.printer.PrintWarning("a message looks like it contains a secret (%v). It was masked before being sent to the model.\n", kind)
+	})
+	if err != nil {
+		return err
+	}
+	app.capi = redactor
+	app.SetModel(app.model)
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type RemoteBatch struct {
+	client       *openai.Client
+	model        string
+	pollInterval time.Duration
+	printer      UserPrinter
+	showProgress bool
+	redactor     *RedactingCompletionAPI
+}
+
+type remoteBatchOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+var remoteBatchFinalStatuses = map[string]bool{
+	"completed": true,
+	"failed":    true,
+	"expired":   true,
+	"cancelled": true,
+}
+
+func (rb *RemoteBatch) run(baseContext []Message, in io.Reader, out io.Writer, batchID string) (int, int, error) {
+	jobs, err := readBatchJobs(in)
+	if err != nil {
+		return 0, 0, err
+	}
+	results := make([]BatchResult, len(jobs))
+	request := openai.CreateBatchWithUploadFileRequest{
+		Endpoint:               openai.BatchEndpointChatCompletions,
+		UploadBatchFileRequest: openai.UploadBatchFileRequest{FileName: "gptrepl-batch.jsonl"},
+	}
+	for i, job := range jobs {
+		results[i] = BatchResult{Index: job.index, ID: job.prompt.ID, Prompt: job.prompt.Prompt}
+		messages, err := batchJobMessages(baseContext, job)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if rb.redactor != nil {
+			messages = rb.redactor.redactMessages(messages)
+		}
+		chatMessages := make([]openai.ChatCompletionMessage, len(messages))
+		for j, msg := range messages {
+			chatMessages[j] = openai.ChatCompletionMessage{Role: msg.Role, Content: msg.Content}
+		}
+		request.AddChatCompletion(strconv.Itoa(job.index), openai.ChatCompletionRequest{Model: rb.model, Messages: chatMessages})
+	}
+
+	if batchID == "" && len(request.Lines) > 0 {
+		response, err := rb.client.CreateBatchWithUploadFile(context.Background(), request)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to create batch: %v", err)
+		}
+		batchID = response.ID
+		rb.printer.PrintWarning("submitted batch %v. If interrupted, resume with -remote-id %v\n", batchID, batchID)
+	}
+	if batchID != "" {
+		err = rb.waitAndCollect(batchID, results)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	encoder := json.NewEncoder(out)
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+		err := encoder.Encode(result)
+		if err != nil {
+			return len(results), failed, fmt.Errorf("failed to write results: %v", err)
+		}
+	}
+	return len(results), failed, nil
+}
+
+func (rb *RemoteBatch) waitAndCollect(batchID string, results []BatchResult) error {
+	var batch openai.BatchResponse
+	var err error
+	for {
+		batch, err = rb.client.RetrieveBatch(context.Background(), batchID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve batch %v: %v", batchID, err)
+		}
+		if rb.showProgress {
+			counts := batch.RequestCounts
+			rb.printer.Print("batch %v: %v (%v/%v completed, %v failed)\n", batchID, batch.Status, counts.Completed, counts.Total, counts.Failed)
+		}
+		if remoteBatchFinalStatuses[batch.Status] {
+			break
+		}
+		time.Sleep(rb.pollInterval)
+	}
+
+	received := make([]bool, len(results))
+	for _, fileID := range []*string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == nil || *fileID == "" {
+			continue
+		}
+		err = rb.collectFile(*fileID, results, received)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range results {
+		if !received[i] && results[i].Error == "" {
+			results[i].Error = fmt.Sprintf("no result received (batch %v)", batch.Status)
+		}
+	}
+	return nil
+}
+
+func (rb *RemoteBatch) collectFile(fileID string, results []BatchResult, received []bool) error {
+	content, err := rb.client.GetFileContent(context.Background(), fileID)
+	if err != nil {
+		return fmt.Errorf("failed to download file %v: %v", fileID, err)
+	}
+	defer content.Close()
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var line remoteBatchOutputLine
+		if json.Unmarshal(scanner.Bytes(), &line) != nil {
+			continue
+		}
+		index, err := strconv.Atoi(line.CustomID)
+		if err != nil || index < 0 || index >= len(results) {
+			continue
+		}
+		received[index] = true
+		results[index].Error = remoteBatchLineError(line)
+		if results[index].Error != "" {
+			continue
+		}
+		var completion openai.ChatCompletionResponse
+		err = json.Unmarshal(line.Response.Body, &completion)
+		if err != nil || len(completion.Choices) == 0 {
+			results[index].Error = "malformed response"
+			continue
+		}
+		results[index].Response = completion.Choices[0].Message.Content
+	}
+	return scanner.Err()
+}
+
+func remoteBatchLineError(line remoteBatchOutputLine) string {
+	if line.Error != nil {
+		return fmt.Sprintf("%v: %v", line.Error.Code, line.Error.Message)
+	}
+	if line.Response == nil {
+		return "missing response"
+	}
+	if line.Response.StatusCode != 200 {
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(line.Response.Body, &body)
+		return fmt.Sprintf("status code %v: %v", line.Response.StatusCode, body.Error.Message)
+	}
+	return ""
+}
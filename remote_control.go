@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/Sa-RSt/gptrepl/control"
+)
+
+const controlRune = '\uE000'
+
+const maxQueuedControlLines = 16
+
+type stdinRead struct {
+	data []byte
+	err  error
+}
+
+type InjectableStdin struct {
+	stdin    io.Reader
+	reads    chan stdinRead
+	injected chan []byte
+	reading  bool
+	pending  []byte
+}
+
+func newInjectableStdin(stdin io.Reader) *InjectableStdin {
+	return &InjectableStdin{stdin: stdin, reads: make(chan stdinRead), injected: make(chan []byte, maxQueuedControlLines)}
+}
+
+func (s *InjectableStdin) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		if !s.reading {
+			s.reading = true
+			go func(size int) {
+				data := make([]byte, size)
+				n, err := s.stdin.Read(data)
+				s.reads <- stdinRead{data: data[:n], err: err}
+			}(len(p))
+		}
+		select {
+		case read := <-s.reads:
+			s.reading = false
+			if len(read.data) == 0 {
+				return 0, read.err
+			}
+			s.pending = read.data
+		case data := <-s.injected:
+			s.pending = data
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *InjectableStdin) Close() error {
+	return nil
+}
+
+func (editor *LineEditor) inject(line string) error {
+	if editor.stdin == nil {
+		return fmt.Errorf("this gptrepl doesn't accept lines from the control socket")
+	}
+	select {
+	case editor.queue <- line:
+	default:
+		return fmt.Errorf("too many lines are waiting to be run")
+	}
+	editor.stdin.injected <- []byte(string(controlRune))
+	return nil
+}
+
+func (app *App) startControl(editor *LineEditor) (net.Listener, error) {
+	listener, err := control.Listen(app.controlSocket, editor.inject)
+	if err != nil {
+		return nil, err
+	}
+	if !app.quiet {
+		app.printer.Print("Accepting lines from gptreplctl on %v.\n", app.controlSocket)
+	}
+	return listener, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var terminalResizes atomic.Uint64
+
+var watchResizeOnce sync.Once
+
+func watchResize() {
+	watchResizeOnce.Do(func() {
+		resized := make(chan os.Signal, 1)
+		notifyResize(resized)
+		go func() {
+			for range resized {
+				terminalResizes.Add(1)
+			}
+		}()
+	})
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyResize(resized chan<- os.Signal) {
+	signal.Notify(resized, syscall.SIGWINCH)
+}
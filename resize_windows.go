@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+func notifyResize(resized chan<- os.Signal) {
+}
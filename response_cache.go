@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const cacheFlagUsage = "Store the answers of the model on disk, keyed by the provider, model, temperature and messages, so that sending exactly the same messages again (e.g. in scripts) answers instantly without a request."
+
+type cachedResponse struct {
+	Model    string    `json:"model"`
+	Response string    `json:"response"`
+	Created  time.Time `json:"created"`
+}
+
+type CachingCompletionAPI struct {
+	CompletionAPI
+	dir         string
+	provider    string
+	model       string
+	temperature float32
+}
+
+func responseCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gptrepl", "responses"), nil
+}
+
+func newCachingCompletionAPI(capi CompletionAPI, dir string, provider string) *CachingCompletionAPI {
+	return &CachingCompletionAPI{CompletionAPI: capi, dir: dir, provider: provider, temperature: session.DefaultTemperature}
+}
+
+func (c *CachingCompletionAPI) SetModel(model string) {
+	c.model = model
+	c.CompletionAPI.SetModel(model)
+}
+
+func (c *CachingCompletionAPI) SetTemperature(temperature float32) {
+	c.temperature = temperature
+	c.CompletionAPI.SetTemperature(temperature)
+}
+
+func (c *CachingCompletionAPI) path(messages []Message) string {
+	key, _ := json.Marshal(struct {
+		Provider    string            `json:"provider"`
+		Model       string            `json:"model"`
+		Temperature float32           `json:"temperature"`
+		Messages    []cassetteMessage `json:"messages"`
+	}{c.provider, c.model, c.temperature, cassetteMessages(messages)})
+	hash := sha256.Sum256(key)
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+func (c *CachingCompletionAPI) SendContext(messages []Message) (<-chan CompletionDelta, error) {
+	path := c.path(messages)
+	var cached cachedResponse
+	data, err := os.ReadFile(path)
+	if err == nil && json.Unmarshal(data, &cached) == nil {
+		debugLog.Debug("cache hit", "model", c.model, "path", path)
+		out := make(chan CompletionDelta, 2)
+		out <- CompletionDelta{Text: cached.Response}
+		out <- CompletionDelta{Err: io.EOF}
+		close(out)
+		return out, nil
+	}
+	stream, err := c.CompletionAPI.SendContext(messages)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan CompletionDelta, 32)
+	go func() {
+		defer close(out)
+		var response strings.Builder
+		for delta := range stream {
+			if errors.Is(delta.Err, io.EOF) {
+				c.store(path, response.String())
+			}
+			out <- delta
+			if delta.Err != nil {
+				return
+			}
+			response.WriteString(delta.Text)
+		}
+	}()
+	return out, nil
+}
+
+func (c *CachingCompletionAPI) store(path string, response string) {
+	data, err := json.Marshal(cachedResponse{Model: c.model, Response: response, Created: time.Now()})
+	if err != nil || os.MkdirAll(c.dir, 0770) != nil {
+		return
+	}
+	session.WriteFileAtomically(path, data, 0)
+}
+
+func cachedResponseCount(dir string) int {
+	entries, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	return len(entries)
+}
+
+func clearResponseCache(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (app *App) startCaching() error {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return err
+	}
+	app.responseCache = newCachingCompletionAPI(app.capi, dir, app.provider)
+	app.capi = app.responseCache
+	app.SetModel(app.model)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/providers"
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+var routerStrategies = []string{"cheap-first"}
+
+var providerCheapModels = map[string]string{
+	"openai":    "gpt-4o-mini",
+	"anthropic": "claude-3-5-haiku-latest",
+	"mock":      providers.EchoDefaultModel,
+}
+
+const strongPrefix = "!strong"
+
+const defaultRouterThreshold = 500
+
+func (app *App) configureRouter() error {
+	if app.router == "" {
+		return nil
+	}
+	if !slices.Contains(routerStrategies, app.router) {
+		return fmt.Errorf("invalid value for -router: '%v'. Use one of: %v", app.router, strings.Join(routerStrategies, ", "))
+	}
+	if app.cheapModel == "" {
+		app.cheapModel = providerCheapModels[app.provider]
+	}
+	if app.cheapModel == "" {
+		return fmt.Errorf("-router needs -cheap-model with the %v provider", app.provider)
+	}
+	app.cheapModel = app.resolveModel(app.cheapModel)
+	return nil
+}
+
+func (app *App) routeQuestion(content string) (string, string, string) {
+	if rest, ok := strings.CutPrefix(content, strongPrefix); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\n') {
+		return strings.TrimSpace(rest), app.model, strongPrefix
+	}
+	tokens := session.EstimateTokens(content)
+	if tokens > int(app.routerThreshold) {
+		return content, app.model, fmt.Sprintf("~%v tokens, over %v", tokens, app.routerThreshold)
+	}
+	return content, app.cheapModel, fmt.Sprintf("~%v tokens", tokens)
+}
+
+func (app *App) askRouted(content string) error {
+	content, model, reason := app.routeQuestion(content)
+	if content == "" {
+		return fmt.Errorf("expected a prompt after %v", strongPrefix)
+	}
+	if !app.quiet {
+		app.printer.Print("%v\n", theme.Dim.Sprintf("Routed to %v (%v)", model, reason))
+	}
+	if model == app.model {
+		return app.askQuestion(content)
+	}
+	strongModel := app.model
+	app.SetModel(model)
+	defer app.SetModel(strongModel)
+	return app.askQuestion(content)
+}
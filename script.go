@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+type ScriptLine struct {
+	number int
+	text   string
+}
+
+func parseScript(data string) []ScriptLine {
+	var lines []ScriptLine
+	var pending strings.Builder
+	start := 0
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if pending.Len() == 0 {
+			start = i + 1
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+		}
+		if strings.HasSuffix(line, "\\") {
+			pending.WriteString(strings.TrimSuffix(line, "\\"))
+			pending.WriteString("\n")
+			continue
+		}
+		pending.WriteString(line)
+		lines = append(lines, ScriptLine{number: start, text: pending.String()})
+		pending.Reset()
+	}
+	if pending.Len() > 0 {
+		lines = append(lines, ScriptLine{number: start, text: pending.String()})
+	}
+	return lines
+}
+
+func (app *App) runScript(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		app.printer.PrintError("%v\n", err)
+		return 1
+	}
+	app.reader = nil
+	for _, line := range parseScript(string(data)) {
+		err = app.executeLine(line.text)
+		if err != nil {
+			app.printer.PrintError("%v:%v: script stopped\n", path, line.number)
+			return exitStatus(err)
+		}
+	}
+	return 0
+}
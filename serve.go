@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultListenAddress = "127.0.0.1:8080"
+
+var defaultServeCommands = []string{"help", "clear", "print", "pop", "undo", "redo", "regen", "retry", "system", "persona", "model", "stats"}
+
+type ServeConfig struct {
+	Token    string   `json:"token"`
+	Commands []string `json:"commands"`
+}
+
+type Server struct {
+	app      *App
+	token    string
+	injected []Message
+	mu       sync.Mutex
+}
+
+type ServedSession struct {
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Model    string    `json:"model,omitempty"`
+	Updated  time.Time `json:"updated"`
+	Messages int       `json:"messages"`
+}
+
+type postedMessage struct {
+	Content string `json:"content"`
+}
+
+type sseWriter struct {
+	w http.ResponseWriter
+}
+
+func (sse *sseWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		if _, err := fmt.Fprintf(sse.w, "data: %v\n", line); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := io.WriteString(sse.w, "\n"); err != nil {
+		return 0, err
+	}
+	if flusher, ok := sse.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return len(p), nil
+}
+
+func newServer(app *App) (*Server, error) {
+	token := app.serveToken
+	if token == "" {
+		token = app.config.Serve.Token
+	}
+	if token == "" {
+		return nil, fmt.Errorf("a token is required: pass -token or set \"token\" in the \"serve\" section of the configuration file")
+	}
+	if len(app.config.Serve.Commands) > 0 {
+		app.config.Commands.Allow = app.config.Serve.Commands
+	} else if len(app.config.Commands.Allow) == 0 {
+		app.config.Commands.Allow = defaultServeCommands
+	}
+	app.fileRefsDisabled = true
+	app.builtinVarsDisabled = true
+	return &Server{app: app, token: token, injected: slices.Clone(app.context)}, nil
+}
+
+func (app *App) runServer() int {
+	server, err := newServer(app)
+	if err != nil {
+		app.printer.PrintError("%v\n", err)
+		return 2
+	}
+	if !app.quiet {
+		app.printer.Print("Listening on %v.\n", app.listenAddress)
+	}
+	err = http.ListenAndServe(app.listenAddress, server.handler())
+	app.printer.PrintError("%v\n", err)
+	return 1
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", s.handleListSessions)
+	mux.HandleFunc("POST /sessions", s.handleCreateSession)
+	mux.HandleFunc("GET /sessions/{id}/context", s.handleGetContext)
+	mux.HandleFunc("PUT /sessions/{id}/context", s.handlePutContext)
+	mux.HandleFunc("POST /sessions/{id}/messages", s.handlePostMessage)
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return s.authorize(mux)
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func sessionID(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".json")
+}
+
+func (s *Server) useSession(id string) error {
+	session, err := findSession(id)
+	if err != nil {
+		return err
+	}
+	if session.path == s.app.autosaveFilePath {
+		return nil
+	}
+	return s.app.loadSession(session)
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := listSessions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	served := []ServedSession{}
+	for _, session := range sessions {
+		served = append(served, ServedSession{ID: session.id, Title: session.title, Model: session.model, Updated: session.updated, Messages: session.messages})
+	}
+	writeJSON(w, http.StatusOK, served)
+}
+
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.app.Conversation
+	s.app.Conversation = Conversation{model: s.app.model}
+	if err := s.app.startSession(); err != nil {
+		s.app.Conversation = previous
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.app.rewriteAutosaveFile(); err != nil {
+		s.app.Conversation = previous
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.app.recordAutosaveFileInfo()
+	writeJSON(w, http.StatusCreated, ServedSession{ID: sessionID(s.app.autosaveFilePath), Title: defaultSessionTitle(nil), Model: s.app.model, Updated: s.app.created})
+}
+
+func (s *Server) handleGetContext(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.useSession(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, contextFileEnvelope{Version: contextFileVersion, Metadata: s.app.contextMetadata(), Messages: s.app.context})
+}
+
+func (s *Server) handlePutContext(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	messages, ok := parsePluginContext(body)
+	if !ok {
+		http.Error(w, "expected a list of messages or an object with a \"messages\" field", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.useSession(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.app.setContext(messages)
+	writeJSON(w, http.StatusOK, contextFileEnvelope{Version: contextFileVersion, Metadata: s.app.contextMetadata(), Messages: s.app.context})
+}
+
+func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) {
+	var message postedMessage
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil || strings.TrimSpace(message.Content) == "" {
+		http.Error(w, "expected an object with a non-empty \"content\" field", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.useSession(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	printer := s.app.printer
+	s.app.printer = &JSONLPrinter{out: &sseWriter{w: w}}
+	defer func() { s.app.printer = printer }()
+	s.app.executeLine(message.Content)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.app.telemetry == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.app.telemetry.WritePrometheus(w)
+}
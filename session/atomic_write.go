@@ -0,0 +1,78 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func WriteFileAtomically(path string, data []byte, backups int) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(temp.Name(), 0660)
+	if err != nil {
+		return err
+	}
+	if backups > 0 {
+		err = rotateBackups(path, backups)
+		if err != nil {
+			return fmt.Errorf("failed to back up %v: %w", path, err)
+		}
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func BackupPath(path string, n int) string {
+	return fmt.Sprintf("%v.bak.%v", path, n)
+}
+
+func rotateBackups(path string, backups int) error {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	for n := backups - 1; n >= 1; n-- {
+		err := os.Rename(BackupPath(path, n), BackupPath(path, n+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	newest := BackupPath(path, 1)
+	os.Remove(newest)
+	if os.Link(path, newest) == nil {
+		return nil
+	}
+	return copyFile(path, newest)
+}
+
+func copyFile(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destination, source)
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
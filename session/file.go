@@ -0,0 +1,117 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const FileVersion = 1
+
+type Metadata struct {
+	Summary    string      `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Model      string      `json:"model,omitempty" yaml:"model,omitempty"`
+	Branch     string      `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Title      string      `json:"title,omitempty" yaml:"title,omitempty"`
+	Created    *time.Time  `json:"created,omitempty" yaml:"created,omitempty"`
+	Updated    *time.Time  `json:"updated,omitempty" yaml:"updated,omitempty"`
+	Parameters *Parameters `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+type Parameters struct {
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+}
+
+type File struct {
+	Version  int       `json:"version" yaml:"version"`
+	Metadata Metadata  `json:"metadata" yaml:"metadata"`
+	Messages []Message `json:"messages" yaml:"messages"`
+}
+
+var FileFormats = []string{"json", "yaml", "jsonl"}
+
+var DefaultFileFormat = "json"
+
+func FileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	case ".jsonl":
+		return "jsonl"
+	}
+	return DefaultFileFormat
+}
+
+func ReadFile(path string) (File, error) {
+	var file File
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	switch FileFormat(path) {
+	case "yaml":
+		err = unmarshalYAML(data, &file)
+	case "jsonl":
+		err = ReplayJournal(data, &file)
+	default:
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(data, &file.Messages)
+		} else {
+			err = json.Unmarshal(data, &file)
+		}
+	}
+	if err != nil {
+		return File{}, err
+	}
+	if file.Version > FileVersion {
+		return File{}, fmt.Errorf("%v: format version %v is not supported by this version of gptrepl (up to %v). Please update it", path, file.Version, FileVersion)
+	}
+	for idx, msg := range file.Messages {
+		if !IsRoleValid(msg.Role) {
+			return File{}, fmt.Errorf("%v: message #%v (starting from zero) has an invalid \"role\" attribute", path, idx)
+		}
+	}
+	return file, nil
+}
+
+func unmarshalYAML(data []byte, file *File) error {
+	var document yaml.Node
+	err := yaml.Unmarshal(data, &document)
+	if err != nil || len(document.Content) == 0 {
+		return err
+	}
+	if document.Content[0].Kind == yaml.SequenceNode {
+		return document.Content[0].Decode(&file.Messages)
+	}
+	return document.Content[0].Decode(file)
+}
+
+func WriteFile(path string, messages []Message, metadata Metadata, backups int) error {
+	if messages == nil {
+		messages = []Message{}
+	}
+	file := File{Version: FileVersion, Metadata: metadata, Messages: messages}
+	var marshaled []byte
+	var err error
+	switch FileFormat(path) {
+	case "yaml":
+		marshaled, err = yaml.Marshal(file)
+	case "jsonl":
+		marshaled, err = MarshalJournal(file)
+	default:
+		marshaled, err = json.MarshalIndent(file, "", "\t")
+	}
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomically(path, marshaled, backups)
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+type JournalEvent struct {
+	Op       string    `json:"op"`
+	Version  int       `json:"version,omitempty"`
+	Message  *Message  `json:"message,omitempty"`
+	Length   *int      `json:"length,omitempty"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+func MarshalJournal(file File) ([]byte, error) {
+	events := []JournalEvent{{Op: "metadata", Version: file.Version, Metadata: &file.Metadata}}
+	for i := range file.Messages {
+		events = append(events, JournalEvent{Op: "append", Message: &file.Messages[i]})
+	}
+	return MarshalJournalEvents(events)
+}
+
+func MarshalJournalEvents(events []JournalEvent) ([]byte, error) {
+	var result bytes.Buffer
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		result.Write(line)
+		result.WriteByte('\n')
+	}
+	return result.Bytes(), nil
+}
+
+func ReplayJournal(data []byte, file *File) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var event JournalEvent
+		err := json.Unmarshal(line, &event)
+		if err != nil {
+			return fmt.Errorf("line %v: %w", lineNumber, err)
+		}
+		switch {
+		case event.Op == "append" && event.Message != nil:
+			file.Messages = append(file.Messages, *event.Message)
+		case event.Op == "truncate" && event.Length != nil && *event.Length >= 0 && *event.Length <= len(file.Messages):
+			file.Messages = file.Messages[:*event.Length]
+		case event.Op == "metadata" && event.Metadata != nil:
+			file.Metadata = *event.Metadata
+			file.Version = max(file.Version, event.Version)
+		default:
+			return fmt.Errorf("line %v: invalid event", lineNumber)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,71 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+)
+
+type Message struct {
+	Role         string     `json:"role" yaml:"role"`
+	Content      string     `json:"content" yaml:"content"`
+	Time         *time.Time `json:"time,omitempty" yaml:"time,omitempty"`
+	DurationMs   int64      `json:"duration_ms,omitempty" yaml:"duration_ms,omitempty"`
+	InputTokens  int        `json:"input_tokens,omitempty" yaml:"input_tokens,omitempty"`
+	OutputTokens int        `json:"output_tokens,omitempty" yaml:"output_tokens,omitempty"`
+	Model        string     `json:"model,omitempty" yaml:"model,omitempty"`
+}
+
+func NewMessage(role string, content string) Message {
+	now := time.Now()
+	return Message{Role: role, Content: content, Time: &now}
+}
+
+func IsRoleValid(role string) bool {
+	return role == "user" || role == "assistant" || role == "system"
+}
+
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func NewAnswer(messages []Message, model string, content string, start time.Time) Message {
+	answer := Message{Role: "assistant", Content: content, Time: &start, DurationMs: time.Since(start).Milliseconds(), OutputTokens: EstimateTokens(content), Model: model}
+	for _, msg := range messages {
+		answer.InputTokens += EstimateTokens(msg.Content)
+	}
+	return answer
+}
+
+type Delta struct {
+	Text string
+	Err  error
+}
+
+type CompletionAPI interface {
+	SendContext([]Message) (<-chan Delta, error)
+	SetModel(string)
+	SetApiKey(string)
+	SetTemperature(float32)
+	ListModels() ([]string, error)
+}
+
+const DefaultTemperature = -1
+
+func Collect(stream <-chan Delta, onDelta func(string)) (string, error) {
+	var collect bytes.Buffer
+	for {
+		response, ok := <-stream
+		if !ok || errors.Is(response.Err, io.EOF) {
+			return collect.String(), nil
+		}
+
+		if response.Err != nil {
+			return "", response.Err
+		}
+
+		collect.WriteString(response.Text)
+		onDelta(response.Text)
+	}
+}
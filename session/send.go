@@ -0,0 +1,60 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+var ErrRetriesCanceled = errors.New("retries canceled")
+
+type Options struct {
+	MaxRetries uint
+	OnRetry    func(err error, wait time.Duration, attempt int, attempts int) bool
+	Collect    func(stream <-chan Delta) (string, error)
+}
+
+func SendWithRetries(api CompletionAPI, messages []Message, maxRetries uint, onRetry func(err error, wait time.Duration, attempt int, attempts int) bool) (<-chan Delta, error) {
+	retries := int64(maxRetries)
+	var stream <-chan Delta
+	var err error
+	const waitTimeMultiplier = 2.0
+	waitTime := 1.0
+	for attempt := 1; retries >= 0; attempt++ {
+		stream, err = api.SendContext(messages)
+		if err != nil && retries > 0 {
+			wait := time.Duration(waitTime) * time.Second
+			retries--
+			if onRetry == nil {
+				time.Sleep(wait)
+			} else if !onRetry(err, wait, attempt+1, int(maxRetries)+1) {
+				return nil, fmt.Errorf("%w: %w", ErrRetriesCanceled, err)
+			}
+			waitTime *= waitTimeMultiplier
+			waitTime += rand.Float64() / 3
+		} else {
+			break
+		}
+	}
+	return stream, err
+}
+
+func Generate(api CompletionAPI, model string, messages []Message, options Options) (Message, error) {
+	start := time.Now()
+	stream, err := SendWithRetries(api, messages, options.MaxRetries, options.OnRetry)
+	if err != nil {
+		return Message{}, err
+	}
+	collect := options.Collect
+	if collect == nil {
+		collect = func(stream <-chan Delta) (string, error) {
+			return Collect(stream, func(string) {})
+		}
+	}
+	content, err := collect(stream)
+	if err != nil {
+		return Message{}, err
+	}
+	return NewAnswer(messages, model, content, start), nil
+}
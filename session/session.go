@@ -0,0 +1,85 @@
+package session
+
+import (
+	"fmt"
+	"slices"
+)
+
+type Session struct {
+	api        CompletionAPI
+	model      string
+	maxRetries uint
+	messages   []Message
+	metadata   Metadata
+}
+
+func New(api CompletionAPI, model string) *Session {
+	s := &Session{api: api}
+	s.SetModel(model)
+	return s
+}
+
+func (s *Session) Model() string {
+	return s.model
+}
+
+func (s *Session) SetModel(model string) {
+	s.model = model
+	s.api.SetModel(model)
+}
+
+func (s *Session) SetMaxRetries(maxRetries uint) {
+	s.maxRetries = maxRetries
+}
+
+func (s *Session) Messages() []Message {
+	return slices.Clone(s.messages)
+}
+
+func (s *Session) SetMessages(messages []Message) {
+	s.messages = slices.Clone(messages)
+}
+
+func (s *Session) AppendMessage(role string, content string) error {
+	if !IsRoleValid(role) {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	s.messages = append(s.messages, NewMessage(role, content))
+	return nil
+}
+
+func (s *Session) Send(onDelta func(string)) (Message, error) {
+	if len(s.messages) == 0 {
+		return Message{}, fmt.Errorf("there are no messages to send")
+	}
+	if onDelta == nil {
+		onDelta = func(string) {}
+	}
+	answer, err := Generate(s.api, s.model, s.messages, Options{MaxRetries: s.maxRetries, Collect: func(stream <-chan Delta) (string, error) {
+		return Collect(stream, onDelta)
+	}})
+	if err != nil {
+		return Message{}, err
+	}
+	s.messages = append(s.messages, answer)
+	return answer, nil
+}
+
+func (s *Session) Save(path string) error {
+	metadata := s.metadata
+	metadata.Model = s.model
+	return WriteFile(path, s.messages, metadata, 0)
+}
+
+func (s *Session) Load(path string) error {
+	file, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.messages = file.Messages
+	s.metadata = file.Metadata
+	if file.Metadata.Model != "" {
+		s.SetModel(file.Metadata.Model)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package session
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeAPI struct {
+	model    string
+	received []Message
+	chunks   []string
+	failures int
+}
+
+func (f *fakeAPI) SendContext(messages []Message) (<-chan Delta, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("unavailable")
+	}
+	f.received = messages
+	stream := make(chan Delta, len(f.chunks)+1)
+	for _, chunk := range f.chunks {
+		stream <- Delta{Text: chunk}
+	}
+	stream <- Delta{Err: io.EOF}
+	return stream, nil
+}
+
+func (f *fakeAPI) SetModel(model string) {
+	f.model = model
+}
+
+func (f *fakeAPI) SetApiKey(string) {
+}
+
+func (f *fakeAPI) SetTemperature(float32) {
+}
+
+func (f *fakeAPI) ListModels() ([]string, error) {
+	return []string{f.model}, nil
+}
+
+func TestSessionSend(t *testing.T) {
+	api := &fakeAPI{chunks: []string{"Hello", " world"}}
+	s := New(api, "test-model")
+	if api.model != "test-model" {
+		t.Fatalf("expected the model to be set on the API, got %q", api.model)
+	}
+	if _, err := s.Send(nil); err == nil {
+		t.Fatalf("expected an error when there are no messages")
+	}
+	if err := s.AppendMessage("robot", "hi"); err == nil {
+		t.Fatalf("expected an error for an invalid role")
+	}
+	if err := s.AppendMessage("user", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	var streamed strings.Builder
+	answer, err := s.Send(func(delta string) { streamed.WriteString(delta) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Role != "assistant" || answer.Content != "Hello world" || streamed.String() != "Hello world" {
+		t.Fatalf("unexpected answer %+v (streamed %q)", answer, streamed.String())
+	}
+	if len(api.received) != 1 || api.received[0].Content != "hi" {
+		t.Fatalf("unexpected context sent %+v", api.received)
+	}
+	if messages := s.Messages(); len(messages) != 2 || messages[1].Content != "Hello world" {
+		t.Fatalf("expected the answer to be appended, got %+v", messages)
+	}
+}
+
+func TestGenerateRetries(t *testing.T) {
+	api := &fakeAPI{chunks: []string{"ok"}, failures: 2}
+	var attempts []int
+	onRetry := func(err error, wait time.Duration, attempt int, total int) bool {
+		attempts = append(attempts, attempt)
+		return true
+	}
+	answer, err := Generate(api, "test-model", []Message{{Role: "user", Content: "hi"}}, Options{MaxRetries: 2, OnRetry: onRetry})
+	if err != nil || answer.Content != "ok" || answer.Model != "test-model" {
+		t.Fatalf("unexpected answer %+v (%v)", answer, err)
+	}
+	if len(attempts) != 2 || attempts[0] != 2 || attempts[1] != 3 {
+		t.Fatalf("expected two retries, got %v", attempts)
+	}
+	api.failures = 1
+	_, err = Generate(api, "test-model", []Message{{Role: "user", Content: "hi"}}, Options{MaxRetries: 2, OnRetry: func(error, time.Duration, int, int) bool { return false }})
+	if !errors.Is(err, ErrRetriesCanceled) {
+		t.Fatalf("expected the retries to be canceled, got %v", err)
+	}
+}
+
+func TestSessionSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	s := New(&fakeAPI{}, "first-model")
+	s.SetMessages([]Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}})
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	api := &fakeAPI{}
+	loaded := New(api, "other-model")
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Model() != "first-model" || api.model != "first-model" {
+		t.Fatalf("expected the saved model, got %q", loaded.Model())
+	}
+	if messages := loaded.Messages(); len(messages) != 2 || messages[0].Content != "be brief" {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+	if err := os.WriteFile(path, []byte(`[{"role": "user", "content": "plain"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Load(path); err != nil || len(loaded.Messages()) != 1 || loaded.Model() != "first-model" {
+		t.Fatalf("expected a plain array to load, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version": 99, "messages": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Load(path); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
+
+func TestSessionSaveAndLoadFormats(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"session.yaml", "session.jsonl", "session.json"} {
+		path := filepath.Join(dir, name)
+		if err := WriteFile(path, []Message{{Role: "user", Content: "hi"}}, Metadata{Title: "Greeting"}, 0); err != nil {
+			t.Fatal(err)
+		}
+		s := New(&fakeAPI{}, "test-model")
+		if err := s.Load(path); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if err := s.AppendMessage("assistant", "hello"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Save(path); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		file, err := ReadFile(path)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if len(file.Messages) != 2 || file.Metadata.Title != "Greeting" || file.Metadata.Model != "test-model" {
+			t.Fatalf("%v: unexpected file %+v", name, file)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Fatalf("expected no temporary files to be left behind, got %v", entries)
+	}
+}
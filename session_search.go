@@ -0,0 +1,182 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+const maxExchangeEmbeddingLength = 4 * chunkSize
+
+type SessionExchange struct {
+	session  SessionInfo
+	messages []Message
+	score    float32
+}
+
+func sessionExchanges(messages []Message) [][]Message {
+	var exchanges [][]Message
+	start := -1
+	for i, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		if start >= 0 {
+			exchanges = append(exchanges, messages[start:i])
+		}
+		start = i
+	}
+	if start >= 0 {
+		exchanges = append(exchanges, messages[start:])
+	}
+	return exchanges
+}
+
+func exchangeText(exchange []Message) string {
+	text := strings.TrimSpace(formatMessages(exchange, false, 0, false))
+	if len(text) > maxExchangeEmbeddingLength {
+		text = text[:maxExchangeEmbeddingLength]
+	}
+	return text
+}
+
+func cachedEmbeddings(eapi EmbeddingAPI, cacheDir string, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	var missing []int
+	for i, text := range texts {
+		data, err := os.ReadFile(embeddingCachePath(cacheDir, eapi.Model(), []byte("exchange\x00"+text)))
+		if err != nil || json.Unmarshal(data, &embeddings[i]) != nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+	missingTexts := make([]string, len(missing))
+	for i, index := range missing {
+		missingTexts[i] = texts[index]
+	}
+	computed, err := embedAll(eapi, missingTexts)
+	if err != nil {
+		return nil, err
+	}
+	cacheAvailable := os.MkdirAll(cacheDir, 0770) == nil
+	for i, index := range missing {
+		embeddings[index] = computed[i]
+		if !cacheAvailable {
+			continue
+		}
+		data, err := json.Marshal(computed[i])
+		if err == nil {
+			session.WriteFileAtomically(embeddingCachePath(cacheDir, eapi.Model(), []byte("exchange\x00"+texts[index])), data, 0)
+		}
+	}
+	return embeddings, nil
+}
+
+func (app *App) searchSessions(query string, k int) ([]SessionExchange, error) {
+	eapi, err := app.embeddingAPI()
+	if err != nil {
+		return nil, err
+	}
+	cacheDir, err := embeddingCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := listSessions()
+	if err != nil {
+		return nil, err
+	}
+	var exchanges []SessionExchange
+	var texts []string
+	for _, session := range sessions {
+		if session.path == app.autosaveFilePath {
+			continue
+		}
+		messages, err := parseContextFile(session.path)
+		if err != nil {
+			continue
+		}
+		for _, exchange := range sessionExchanges(messages) {
+			exchanges = append(exchanges, SessionExchange{session: session, messages: exchange})
+			texts = append(texts, exchangeText(exchange))
+		}
+	}
+	if len(exchanges) == 0 {
+		return nil, nil
+	}
+	embeddings, err := cachedEmbeddings(eapi, cacheDir, texts)
+	if err != nil {
+		return nil, err
+	}
+	queryEmbedding, err := embedAll(eapi, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	for i := range exchanges {
+		exchanges[i].score = dotProduct(queryEmbedding[0], embeddings[i])
+	}
+	slices.SortStableFunc(exchanges, func(a SessionExchange, b SessionExchange) int {
+		return cmp.Compare(b.score, a.score)
+	})
+	return exchanges[:min(k, len(exchanges))], nil
+}
+
+func (exchange *SessionExchange) snippet() string {
+	question := strings.Join(strings.Fields(exchange.messages[0].Content), " ")
+	if len([]rune(question)) > 100 {
+		question = string([]rune(question)[:100]) + "..."
+	}
+	return question
+}
+
+func (exchange *SessionExchange) injectedMessage() Message {
+	header := fmt.Sprintf("Excerpt from a past conversation (\"%v\", %v):", exchange.session.title, exchange.session.updated.Local().Format(time.DateOnly))
+	return session.NewMessage("system", header+"\n\n"+strings.TrimSpace(formatMessages(exchange.messages, false, 0, false)))
+}
+
+func (app *App) recallSession(query string) error {
+	results, err := app.searchSessions(query, 5)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("there are no other saved sessions to search")
+	}
+	for i, result := range results {
+		app.printer.Print("%v %v %v (%v) %v\n    %v\n", theme.Index.Sprintf("%v.", i+1), theme.Success.Sprint(result.session.id), result.session.title, result.session.updated.Local().Format("2006-01-02 15:04"), theme.Dim.Sprintf("(%.2f)", result.score), result.snippet())
+	}
+	if app.reader == nil || app.quiet {
+		return nil
+	}
+	answer, err := app.readUserInput("Enter N to add that exchange to the context, oN to open its session, or nothing to cancel: ")
+	if err != nil || answer == "" {
+		return nil
+	}
+	open := strings.HasPrefix(strings.ToLower(answer), "o")
+	if open {
+		answer = answer[1:]
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(results) {
+		return fmt.Errorf("invalid choice: '%v'", answer)
+	}
+	chosen := results[n-1]
+	if !open {
+		app.appendToContext(chosen.injectedMessage())
+		return nil
+	}
+	err = app.loadSession(chosen.session)
+	if err != nil {
+		return err
+	}
+	app.printer.Print("Loaded session %v with %v messages.\n", chosen.session.id, len(app.context))
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const sessionIDLayout = "20060102-150405"
+
+type SessionInfo struct {
+	id       string
+	path     string
+	title    string
+	model    string
+	updated  time.Time
+	messages int
+}
+
+func sessionsDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "gptrepl", "sessions"), nil
+}
+
+func (app *App) startSession() error {
+	dir, err := sessionsDir()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0770)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	id := now.Format(sessionIDLayout)
+	for n := 2; ; n++ {
+		_, err := os.Stat(filepath.Join(dir, id+".json"))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		id = fmt.Sprintf("%v-%v", now.Format(sessionIDLayout), n)
+	}
+	app.autosaveFilePath = filepath.Join(dir, id+".json")
+	app.created = now
+	app.sessions = true
+	return nil
+}
+
+func listSessions() ([]SessionInfo, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []SessionInfo
+	for _, entry := range entries {
+		id, isJSON := strings.CutSuffix(entry.Name(), ".json")
+		if !isJSON || entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		messages, metadata, err := parseContextFileWithMetadata(path)
+		if err != nil {
+			continue
+		}
+		session := SessionInfo{id: id, path: path, title: metadata.Title, model: metadata.Model, messages: len(messages)}
+		if session.title == "" {
+			session.title = defaultSessionTitle(messages)
+		}
+		if metadata.Updated != nil {
+			session.updated = *metadata.Updated
+		} else if info, err := entry.Info(); err == nil {
+			session.updated = info.ModTime()
+		}
+		sessions = append(sessions, session)
+	}
+	slices.SortFunc(sessions, func(a, b SessionInfo) int {
+		return b.updated.Compare(a.updated)
+	})
+	return sessions, nil
+}
+
+func defaultSessionTitle(messages []Message) string {
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		title := strings.Join(strings.Fields(msg.Content), " ")
+		if len(title) > 50 {
+			title = strings.TrimSpace(title[:47]) + "..."
+		}
+		return title
+	}
+	return "(empty)"
+}
+
+func mostRecentSession() (SessionInfo, error) {
+	sessions, err := listSessions()
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	if len(sessions) == 0 {
+		return SessionInfo{}, fmt.Errorf("there are no saved sessions")
+	}
+	return sessions[0], nil
+}
+
+func findSession(name string) (SessionInfo, error) {
+	sessions, err := listSessions()
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	for _, session := range sessions {
+		if session.id == name {
+			return session, nil
+		}
+	}
+	var matches []SessionInfo
+	for _, session := range sessions {
+		if strings.EqualFold(session.title, name) || strings.HasPrefix(session.id, name) {
+			matches = append(matches, session)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return SessionInfo{}, fmt.Errorf("no session named '%v'. Use /sessions to list them", name)
+	case 1:
+		return matches[0], nil
+	}
+	return SessionInfo{}, fmt.Errorf("'%v' matches %v sessions. Use the session ID instead", name, len(matches))
+}
+
+func (app *App) loadSession(session SessionInfo) error {
+	previous := app.Conversation
+	app.Conversation = Conversation{model: app.model, autosaveFilePath: session.path}
+	err := app.loadAutosaveFile()
+	if err != nil {
+		app.Conversation = previous
+		return err
+	}
+	app.checkLoadedContextModels()
+	return nil
+}
+
+func (app *App) deleteSession(session SessionInfo) error {
+	if session.path == app.autosaveFilePath {
+		return fmt.Errorf("can't delete the current session")
+	}
+	err := os.Remove(session.path)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(session.path + ".branches")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+func shellExec(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "sh"
+	}
+	return exec.Command(shell, "-c", command)
+}
+
+func runCapturingOutput(cmd *exec.Cmd) (string, int, error) {
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(output), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return string(output), 0, nil
+}
+
+func commandOutputMessage(title string, prompt string, output string, status int) string {
+	output = strings.TrimRight(output, "\r\n")
+	fence := codeFence(output)
+	var result strings.Builder
+	if title != "" {
+		fmt.Fprintf(&result, "%v\n", title)
+	}
+	fmt.Fprintf(&result, "%v\n", fence)
+	if prompt != "" {
+		fmt.Fprintf(&result, "%v\n", prompt)
+	}
+	if output != "" {
+		fmt.Fprintf(&result, "%v\n", output)
+	}
+	result.WriteString(fence)
+	if status != 0 {
+		fmt.Fprintf(&result, "\nExit status: %v", status)
+	}
+	return result.String()
+}
+
+func (app *App) runAndAppend(title string, prompt string, cmd *exec.Cmd) error {
+	output, status, err := runCapturingOutput(cmd)
+	if err != nil {
+		return err
+	}
+	if !app.quiet {
+		app.printer.Print("%v", output)
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			app.printer.Print("\n")
+		}
+		if status != 0 {
+			app.printer.PrintWarning("exit status %v\n", status)
+		}
+	}
+	output, err = app.fitAttachment("the output", output)
+	if err != nil {
+		return err
+	}
+	app.appendToContext(session.NewMessage("user", commandOutputMessage(title, prompt, output, status)))
+	return nil
+}
+
+var codeInterpreters = map[string][]string{
+	"sh":         {"sh", "-c"},
+	"shell":      {"sh", "-c"},
+	"bash":       {"bash", "-c"},
+	"zsh":        {"zsh", "-c"},
+	"python":     {"python3", "-c"},
+	"py":         {"python3", "-c"},
+	"python3":    {"python3", "-c"},
+	"javascript": {"node", "-e"},
+	"js":         {"node", "-e"},
+	"ruby":       {"ruby", "-e"},
+	"rb":         {"ruby", "-e"},
+	"powershell": {"powershell", "-Command"},
+	"ps1":        {"powershell", "-Command"},
+	"pwsh":       {"pwsh", "-Command"},
+}
+
+func codeInterpreter(language string) ([]string, error) {
+	interpreter, ok := codeInterpreters[strings.ToLower(language)]
+	if !ok {
+		if language == "" {
+			return nil, fmt.Errorf("the code block has no language, so it can't be run")
+		}
+		return nil, fmt.Errorf("don't know how to run %v code", language)
+	}
+	if runtime.GOOS == "windows" && interpreter[0] == "python3" {
+		interpreter = []string{"python", interpreter[1]}
+	}
+	return interpreter, nil
+}
+
+func (app *App) runCodeBlock(spec string) error {
+	block, err := app.selectCodeBlock(spec)
+	if err != nil {
+		return err
+	}
+	interpreter, err := codeInterpreter(block.language)
+	if err != nil {
+		return err
+	}
+	if app.reader == nil {
+		return fmt.Errorf("running code requires confirmation, which is only possible in the interactive shell")
+	}
+	app.printer.Print("%v\n%v\n", theme.Label.Sprintf("%v (%v):", block.language, interpreter[0]), block.text)
+	if !app.confirm("Run this code?") {
+		return nil
+	}
+	cmd := exec.Command(interpreter[0], interpreter[1], block.text)
+	return app.runAndAppend(fmt.Sprintf("Output of the %v code block:", block.language), "", cmd)
+}
+
+const gitDiffReviewPrompt = "Review the changes in this diff. Point out bugs, risky changes and possible improvements."
+
+func gitDiff(staged bool, ref string) (string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff"}
+	if staged {
+		args = append(args, "--staged")
+	}
+	if ref != "" {
+		args = append(args, ref)
+	}
+	output, err := exec.Command("git", args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", fmt.Errorf("git diff failed: %v", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+func (app *App) appendGitDiff(staged bool, ref string, review bool) error {
+	diff, err := gitDiff(staged, ref)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return fmt.Errorf("no changes to show")
+	}
+	diff, err = app.fitAttachment("the diff", diff)
+	if err != nil {
+		return err
+	}
+	fence := codeFence(diff)
+	content := fmt.Sprintf("%vdiff\n%v\n%v", fence, strings.TrimRight(diff, "\n"), fence)
+	if !review {
+		app.appendToContext(session.NewMessage("user", content))
+		return nil
+	}
+	return app.sendAndStore([]Message{session.NewMessage("user", content+"\n\n"+gitDiffReviewPrompt)}, false)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+func (app *App) statusLine() string {
+	stats := app.conversationStats(app.context)
+	autosave := "off"
+	if app.autosaveFilePath != "" {
+		autosave = "on"
+	}
+	return fmt.Sprintf("%v | %v messages | ~%v tokens | cost %v | autosave %v", app.model, len(app.context), formatTokenCount(stats.Tokens), stats.formatCost(), autosave)
+}
+
+func fitStatusLine(status string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(status) <= width {
+		return status
+	}
+	return string([]rune(status)[:max(width-1, 0)]) + "…"
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultStreamFlushInterval = 30 * time.Millisecond
+
+type StreamBuffer struct {
+	printer  UserPrinter
+	interval time.Duration
+	mu       sync.Mutex
+	pending  strings.Builder
+	last     time.Time
+	timer    *time.Timer
+}
+
+func newStreamBuffer(printer UserPrinter, interval time.Duration) *StreamBuffer {
+	return &StreamBuffer{printer: printer, interval: interval}
+}
+
+func (b *StreamBuffer) write(text string) {
+	if text == "" {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending.WriteString(text)
+	elapsed := time.Since(b.last)
+	if b.interval <= 0 || elapsed >= b.interval || strings.Contains(text, "\n") {
+		b.flushLocked()
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval-elapsed, b.flush)
+	}
+}
+
+func (b *StreamBuffer) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+func (b *StreamBuffer) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.last = time.Now()
+	if b.pending.Len() == 0 {
+		return
+	}
+	b.printer.Print("%v", b.pending.String())
+	b.pending.Reset()
+}
+
+type Typewriter struct {
+	rate float64
+	next time.Time
+}
+
+func newTypewriter(rate float64) *Typewriter {
+	if rate <= 0 {
+		return nil
+	}
+	return &Typewriter{rate: rate}
+}
+
+func (t *Typewriter) pace(text string, write func(string)) {
+	if t == nil {
+		write(text)
+		return
+	}
+	interval := time.Duration(float64(time.Second) / t.rate)
+	for _, r := range text {
+		if now := time.Now(); t.next.Before(now) {
+			t.next = now
+		} else {
+			time.Sleep(t.next.Sub(now))
+		}
+		write(string(r))
+		t.next = t.next.Add(interval)
+	}
+}
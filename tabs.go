@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func (app *App) tabCount() int {
+	if len(app.tabs) == 0 {
+		return 1
+	}
+	return len(app.tabs)
+}
+
+func (app *App) storeActiveTab() {
+	if len(app.tabs) == 0 {
+		app.tabs = []Conversation{app.Conversation}
+		app.activeTab = 0
+		return
+	}
+	app.tabs[app.activeTab] = app.Conversation
+}
+
+func (app *App) newTab() {
+	app.storeActiveTab()
+	app.tabs = append(app.tabs, Conversation{model: app.model, created: time.Now()})
+	app.activateTab(len(app.tabs) - 1)
+}
+
+func (app *App) switchTab(index int) error {
+	if index < 0 || index >= app.tabCount() {
+		return fmt.Errorf("no tab number %v. There are %v tabs", index+1, app.tabCount())
+	}
+	if index == app.activeTab {
+		return nil
+	}
+	app.storeActiveTab()
+	app.activateTab(index)
+	return nil
+}
+
+func (app *App) closeTab(index int) error {
+	if app.tabCount() == 1 {
+		return fmt.Errorf("can't close the only tab")
+	}
+	if index < 0 || index >= app.tabCount() {
+		return fmt.Errorf("no tab number %v. There are %v tabs", index+1, app.tabCount())
+	}
+	app.storeActiveTab()
+	app.tabs = append(app.tabs[:index], app.tabs[index+1:]...)
+	active := app.activeTab
+	if active > index || active == len(app.tabs) {
+		active--
+	}
+	app.activateTab(active)
+	return nil
+}
+
+func (app *App) activateTab(index int) {
+	app.activeTab = index
+	app.Conversation = app.tabs[index]
+	app.capi.SetModel(app.model)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sa-RSt/gptrepl/session"
+)
+
+var latencyBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+type telemetrySeries struct {
+	provider string
+	model    string
+}
+
+type telemetryCounts struct {
+	requests         int
+	errors           int
+	promptTokens     int
+	completionTokens int
+	cost             float64
+	buckets          []int
+	latencySum       float64
+}
+
+type Telemetry struct {
+	mu       sync.Mutex
+	series   map[telemetrySeries]*telemetryCounts
+	exporter *OTLPExporter
+	tracer   *Tracer
+}
+
+type InstrumentedCompletionAPI struct {
+	CompletionAPI
+	telemetry *Telemetry
+	provider  string
+	model     string
+}
+
+func newTelemetry(otelEndpoint string) (*Telemetry, error) {
+	telemetry := &Telemetry{series: make(map[telemetrySeries]*telemetryCounts)}
+	if otelEndpoint != "" {
+		exporter, err := newOTLPExporter(otelEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		telemetry.exporter = exporter
+	}
+	return telemetry, nil
+}
+
+func (app *App) startTelemetry() error {
+	telemetry, err := newTelemetry(app.otelEndpoint)
+	if err != nil {
+		return err
+	}
+	if app.traceDestination != "" {
+		tracer, err := newTracer(app.traceDestination, app.traceTags)
+		if err != nil {
+			return err
+		}
+		telemetry.tracer = tracer
+	}
+	app.telemetry = telemetry
+	app.capi = &InstrumentedCompletionAPI{CompletionAPI: app.capi, telemetry: telemetry, provider: app.provider}
+	app.SetModel(app.model)
+	return nil
+}
+
+func (c *InstrumentedCompletionAPI) SetModel(model string) {
+	c.model = model
+	c.CompletionAPI.SetModel(model)
+}
+
+func (c *InstrumentedCompletionAPI) SendContext(messages []Message) (<-chan CompletionDelta, error) {
+	model := c.model
+	start := time.Now()
+	stream, err := c.CompletionAPI.SendContext(messages)
+	if err != nil {
+		c.telemetry.record(c.provider, model, messages, "", start, err)
+		return nil, err
+	}
+	out := make(chan CompletionDelta, 32)
+	go func() {
+		defer close(out)
+		var content strings.Builder
+		for delta := range stream {
+			out <- delta
+			if delta.Err != nil {
+				if errors.Is(delta.Err, io.EOF) {
+					delta.Err = nil
+				}
+				c.telemetry.record(c.provider, model, messages, content.String(), start, delta.Err)
+				return
+			}
+			content.WriteString(delta.Text)
+		}
+		c.telemetry.record(c.provider, model, messages, content.String(), start, nil)
+	}()
+	return out, nil
+}
+
+func (t *Telemetry) record(provider string, model string, messages []Message, content string, start time.Time, err error) {
+	end := time.Now()
+	promptTokens := 0
+	for _, msg := range messages {
+		promptTokens += session.EstimateTokens(msg.Content)
+	}
+	completionTokens := session.EstimateTokens(content)
+	var cost *float64
+	if prices, ok := modelPrices(model); ok {
+		estimated := (float64(promptTokens)*prices[0] + float64(completionTokens)*prices[1]) / 1000000
+		cost = &estimated
+	}
+	latency := end.Sub(start).Seconds()
+	t.mu.Lock()
+	key := telemetrySeries{provider: provider, model: model}
+	counts, ok := t.series[key]
+	if !ok {
+		counts = &telemetryCounts{buckets: make([]int, len(latencyBuckets))}
+		t.series[key] = counts
+	}
+	counts.requests++
+	if err != nil {
+		counts.errors++
+	}
+	counts.promptTokens += promptTokens
+	counts.completionTokens += completionTokens
+	if cost != nil {
+		counts.cost += *cost
+	}
+	counts.latencySum += latency
+	for i, bound := range latencyBuckets {
+		if latency <= bound {
+			counts.buckets[i]++
+		}
+	}
+	t.mu.Unlock()
+	if t.exporter != nil {
+		t.exporter.export(provider, model, promptTokens, completionTokens, start, end, err)
+	}
+	if t.tracer != nil {
+		record := TraceRecord{Time: start, Provider: provider, Model: model, Inputs: cassetteMessages(messages), Output: content, DurationSeconds: latency, PromptTokens: promptTokens, CompletionTokens: completionTokens, Cost: cost}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		t.tracer.trace(record)
+	}
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (key telemetrySeries) labels(extra ...string) string {
+	labels := []string{fmt.Sprintf(`provider="%v"`, prometheusLabelEscaper.Replace(key.provider)), fmt.Sprintf(`model="%v"`, prometheusLabelEscaper.Replace(key.model))}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels = append(labels, fmt.Sprintf(`%v="%v"`, extra[i], extra[i+1]))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func (t *Telemetry) WritePrometheus(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]telemetrySeries, 0, len(t.series))
+	for key := range t.series {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b telemetrySeries) int {
+		return strings.Compare(a.provider+"\x00"+a.model, b.provider+"\x00"+b.model)
+	})
+	fmt.Fprintf(w, "# HELP gptrepl_requests_total Requests sent to the model.\n# TYPE gptrepl_requests_total counter\n")
+	for _, key := range keys {
+		counts := t.series[key]
+		fmt.Fprintf(w, "gptrepl_requests_total%v %v\n", key.labels("status", "ok"), counts.requests-counts.errors)
+		fmt.Fprintf(w, "gptrepl_requests_total%v %v\n", key.labels("status", "error"), counts.errors)
+	}
+	fmt.Fprintf(w, "# HELP gptrepl_request_duration_seconds Time from sending a request to the end of its answer.\n# TYPE gptrepl_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		counts := t.series[key]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "gptrepl_request_duration_seconds_bucket%v %v\n", key.labels("le", fmt.Sprint(bound)), counts.buckets[i])
+		}
+		fmt.Fprintf(w, "gptrepl_request_duration_seconds_bucket%v %v\n", key.labels("le", "+Inf"), counts.requests)
+		fmt.Fprintf(w, "gptrepl_request_duration_seconds_sum%v %v\n", key.labels(), counts.latencySum)
+		fmt.Fprintf(w, "gptrepl_request_duration_seconds_count%v %v\n", key.labels(), counts.requests)
+	}
+	fmt.Fprintf(w, "# HELP gptrepl_tokens_total Estimated tokens sent to and received from the model.\n# TYPE gptrepl_tokens_total counter\n")
+	for _, key := range keys {
+		counts := t.series[key]
+		fmt.Fprintf(w, "gptrepl_tokens_total%v %v\n", key.labels("type", "prompt"), counts.promptTokens)
+		fmt.Fprintf(w, "gptrepl_tokens_total%v %v\n", key.labels("type", "completion"), counts.completionTokens)
+	}
+	fmt.Fprintf(w, "# HELP gptrepl_cost_dollars Estimated cost of the requests in US dollars, for models with known prices.\n# TYPE gptrepl_cost_dollars gauge\n")
+	for _, key := range keys {
+		fmt.Fprintf(w, "gptrepl_cost_dollars%v %v\n", key.labels(), t.series[key].cost)
+	}
+}
+
+func (t *Telemetry) shutdown() {
+	if t.exporter != nil {
+		t.exporter.wg.Wait()
+	}
+	if t.tracer != nil {
+		t.tracer.close()
+	}
+}
+
+type OTLPExporter struct {
+	endpoint string
+	client   *http.Client
+	wg       sync.WaitGroup
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func newOTLPExporter(endpoint string) (*OTLPExporter, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("invalid value for -otel-endpoint: '%v'. Use an http:// or https:// URL", endpoint)
+	}
+	if !strings.HasSuffix(parsed.Path, "/v1/traces") {
+		parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/v1/traces"
+	}
+	return &OTLPExporter{endpoint: parsed.String(), client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func stringAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int) otlpAttribute {
+	formatted := fmt.Sprint(value)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &formatted}}
+}
+
+func randomHex(size int) string {
+	data := make([]byte, size)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+func (e *OTLPExporter) export(provider string, model string, promptTokens int, completionTokens int, start time.Time, end time.Time, err error) {
+	span := otlpSpan{
+		TraceID:           randomHex(16),
+		SpanID:            randomHex(8),
+		Name:              "chat " + model,
+		Kind:              3,
+		StartTimeUnixNano: fmt.Sprint(start.UnixNano()),
+		EndTimeUnixNano:   fmt.Sprint(end.UnixNano()),
+		Attributes: []otlpAttribute{
+			stringAttribute("gen_ai.operation.name", "chat"),
+			stringAttribute("gen_ai.system", provider),
+			stringAttribute("gen_ai.request.model", model),
+			intAttribute("gen_ai.usage.input_tokens", promptTokens),
+			intAttribute("gen_ai.usage.output_tokens", completionTokens),
+		},
+		Status: otlpStatus{Code: 1},
+	}
+	if err != nil {
+		span.Status = otlpStatus{Code: 2, Message: err.Error()}
+	}
+	body, _ := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource":   map[string]any{"attributes": []otlpAttribute{stringAttribute("service.name", "gptrepl")}},
+			"scopeSpans": []any{map[string]any{"scope": map[string]any{"name": "gptrepl"}, "spans": []otlpSpan{span}}},
+		}},
+	})
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+		if err != nil {
+			debugLog.Debug("otel export", "error", err.Error())
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			debugLog.Debug("otel export", "status", resp.Status)
+		}
+	}()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type Theme struct {
+	Prompt       *color.Color
+	Model        *color.Color
+	Role         *color.Color
+	RoleBrackets *color.Color
+	Command      *color.Color
+	Heading      *color.Color
+	Warning      *color.Color
+	Error        *color.Color
+	Dim          *color.Color
+	Success      *color.Color
+	Argument     *color.Color
+	Label        *color.Color
+	Index        *color.Color
+	Keyword      *color.Color
+	String       *color.Color
+	Number       *color.Color
+	DiffHeader   *color.Color
+	DiffHunk     *color.Color
+	DiffAdded    *color.Color
+	DiffRemoved  *color.Color
+	NormalMode   *color.Color
+	InsertMode   *color.Color
+}
+
+var themes = map[string]func() Theme{
+	"default": func() Theme {
+		return Theme{
+			Prompt:       color.New(color.FgBlue),
+			Model:        color.New(color.FgYellow),
+			Role:         color.New(color.Bold, color.FgWhite),
+			RoleBrackets: color.New(color.FgCyan),
+			Command:      color.New(color.FgGreen),
+			Heading:      color.New(color.FgGreen),
+			Warning:      color.New(color.FgYellow),
+			Error:        color.New(color.FgRed),
+			Dim:          color.New(color.Faint),
+			Success:      color.New(color.FgGreen),
+			Argument:     color.New(color.FgMagenta),
+			Label:        color.New(color.FgCyan),
+			Index:        color.New(color.FgMagenta),
+			Keyword:      color.New(color.FgMagenta, color.Bold),
+			String:       color.New(color.FgGreen),
+			Number:       color.New(color.FgYellow),
+			DiffHeader:   color.New(color.Bold),
+			DiffHunk:     color.New(color.FgCyan),
+			DiffAdded:    color.New(color.FgGreen),
+			DiffRemoved:  color.New(color.FgRed),
+			NormalMode:   color.New(color.FgBlack, color.BgYellow),
+			InsertMode:   color.New(color.FgBlack, color.BgGreen),
+		}
+	},
+	"light": func() Theme {
+		return Theme{
+			Prompt:       color.New(color.FgBlue),
+			Model:        color.New(color.FgMagenta),
+			Role:         color.New(color.Bold, color.FgBlack),
+			RoleBrackets: color.New(color.FgBlue),
+			Command:      color.New(color.FgGreen, color.Bold),
+			Heading:      color.New(color.FgGreen, color.Bold),
+			Warning:      color.New(color.FgMagenta),
+			Error:        color.New(color.FgRed, color.Bold),
+			Dim:          color.New(color.Faint),
+			Success:      color.New(color.FgGreen, color.Bold),
+			Argument:     color.New(color.FgMagenta),
+			Label:        color.New(color.FgBlue),
+			Index:        color.New(color.FgMagenta),
+			Keyword:      color.New(color.FgMagenta, color.Bold),
+			String:       color.New(color.FgGreen),
+			Number:       color.New(color.FgBlue),
+			DiffHeader:   color.New(color.Bold),
+			DiffHunk:     color.New(color.FgBlue),
+			DiffAdded:    color.New(color.FgGreen),
+			DiffRemoved:  color.New(color.FgRed),
+			NormalMode:   color.New(color.FgWhite, color.BgBlue),
+			InsertMode:   color.New(color.FgWhite, color.BgGreen),
+		}
+	},
+	"monochrome": func() Theme {
+		return Theme{
+			Prompt:       color.New(color.Reset),
+			Model:        color.New(color.Bold),
+			Role:         color.New(color.Bold),
+			RoleBrackets: color.New(color.Reset),
+			Command:      color.New(color.Bold),
+			Heading:      color.New(color.Bold),
+			Warning:      color.New(color.Bold),
+			Error:        color.New(color.Bold, color.Underline),
+			Dim:          color.New(color.Faint),
+			Success:      color.New(color.Bold),
+			Argument:     color.New(color.Italic),
+			Label:        color.New(color.Bold),
+			Index:        color.New(color.Bold),
+			Keyword:      color.New(color.Bold),
+			String:       color.New(color.Italic),
+			Number:       color.New(color.Reset),
+			DiffHeader:   color.New(color.Bold),
+			DiffHunk:     color.New(color.Faint),
+			DiffAdded:    color.New(color.Bold),
+			DiffRemoved:  color.New(color.Faint),
+			NormalMode:   color.New(color.ReverseVideo),
+			InsertMode:   color.New(color.Bold),
+		}
+	},
+}
+
+var theme = themes["default"]()
+
+var colorAttributes = map[string]color.Attribute{
+	"bold":      color.Bold,
+	"faint":     color.Faint,
+	"italic":    color.Italic,
+	"underline": color.Underline,
+	"black":     color.FgBlack,
+	"red":       color.FgRed,
+	"green":     color.FgGreen,
+	"yellow":    color.FgYellow,
+	"blue":      color.FgBlue,
+	"magenta":   color.FgMagenta,
+	"cyan":      color.FgCyan,
+	"white":     color.FgWhite,
+}
+
+func themeNames() []string {
+	var names []string
+	for name := range themes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func parseColorSpec(spec string) (*color.Color, error) {
+	var attributes []color.Attribute
+	for _, word := range strings.Fields(strings.ToLower(spec)) {
+		bright := false
+		background := false
+		if rest, ok := strings.CutPrefix(word, "bright-"); ok {
+			bright, word = true, rest
+		}
+		if rest, ok := strings.CutPrefix(word, "bg-"); ok {
+			background, word = true, rest
+		}
+		attribute, ok := colorAttributes[word]
+		if !ok || (bright || background) && attribute < color.FgBlack {
+			return nil, fmt.Errorf("invalid color '%v'", spec)
+		}
+		if bright {
+			attribute += color.FgHiBlack - color.FgBlack
+		}
+		if background {
+			attribute += color.BgBlack - color.FgBlack
+		}
+		attributes = append(attributes, attribute)
+	}
+	if len(attributes) == 0 {
+		attributes = append(attributes, color.Reset)
+	}
+	return color.New(attributes...), nil
+}
+
+func loadTheme(name string, colors map[string]string) (Theme, error) {
+	if name == "" {
+		name = "default"
+	}
+	newTheme, ok := themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme '%v'. Use one of: %v", name, strings.Join(themeNames(), ", "))
+	}
+	result := newTheme()
+	fields := map[string]**color.Color{
+		"prompt":        &result.Prompt,
+		"model":         &result.Model,
+		"role":          &result.Role,
+		"role-brackets": &result.RoleBrackets,
+		"command":       &result.Command,
+		"heading":       &result.Heading,
+		"warning":       &result.Warning,
+		"error":         &result.Error,
+		"dim":           &result.Dim,
+		"success":       &result.Success,
+		"argument":      &result.Argument,
+		"label":         &result.Label,
+		"index":         &result.Index,
+		"keyword":       &result.Keyword,
+		"string":        &result.String,
+		"number":        &result.Number,
+		"diff-header":   &result.DiffHeader,
+		"diff-hunk":     &result.DiffHunk,
+		"diff-added":    &result.DiffAdded,
+		"diff-removed":  &result.DiffRemoved,
+		"normal-mode":   &result.NormalMode,
+		"insert-mode":   &result.InsertMode,
+	}
+	for key, spec := range colors {
+		field, ok := fields[key]
+		if !ok {
+			return Theme{}, fmt.Errorf("unknown color '%v' in theme", key)
+		}
+		c, err := parseColorSpec(spec)
+		if err != nil {
+			return Theme{}, fmt.Errorf("%v: %w", key, err)
+		}
+		*field = c
+	}
+	return result, nil
+}
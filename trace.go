@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceRecord struct {
+	Run              string            `json:"run"`
+	Time             time.Time         `json:"time"`
+	Provider         string            `json:"provider"`
+	Model            string            `json:"model"`
+	Inputs           []cassetteMessage `json:"inputs"`
+	Output           string            `json:"output"`
+	Error            string            `json:"error,omitempty"`
+	DurationSeconds  float64           `json:"duration_seconds"`
+	PromptTokens     int               `json:"prompt_tokens"`
+	CompletionTokens int               `json:"completion_tokens"`
+	Cost             *float64          `json:"cost,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+}
+
+type Tracer struct {
+	run    string
+	tags   map[string]string
+	mu     sync.Mutex
+	file   *os.File
+	url    string
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+func parseTraceTags(spec string) (map[string]string, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag for -trace-tags: '%v'. Use key=value pairs separated by commas", pair)
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+func newTracer(destination string, tagSpec string) (*Tracer, error) {
+	tags, err := parseTraceTags(tagSpec)
+	if err != nil {
+		return nil, err
+	}
+	tracer := &Tracer{run: randomHex(8), tags: tags}
+	if strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "https://") {
+		tracer.url = destination
+		tracer.client = &http.Client{Timeout: 10 * time.Second}
+		return tracer, nil
+	}
+	file, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, err
+	}
+	tracer.file = file
+	return tracer, nil
+}
+
+func (t *Tracer) trace(record TraceRecord) {
+	record.Run = t.run
+	record.Tags = t.tags
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if t.file != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.file.Write(append(data, '\n'))
+		return
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			debugLog.Debug("trace export", "error", err.Error())
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			debugLog.Debug("trace export", "status", resp.Status)
+		}
+	}()
+}
+
+func (t *Tracer) close() {
+	t.wg.Wait()
+	if t.file != nil {
+		t.file.Close()
+	}
+}
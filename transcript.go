@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Transcript struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func openTranscript(path string) (*Transcript, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, err
+	}
+	t := &Transcript{path: path, file: file}
+	t.write(fmt.Sprintf("--- Transcript started at %v ---\n", time.Now().Format(time.DateTime)))
+	return t, nil
+}
+
+func (t *Transcript) write(text string) {
+	if t == nil || strings.HasPrefix(text, "\r") {
+		return
+	}
+	text = strings.ReplaceAll(ansiEscapePattern.ReplaceAllString(text, ""), "\a", "")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.file.WriteString(text)
+}
+
+func (t *Transcript) Close() error {
+	return t.file.Close()
+}
+
+type TranscriptPrinter struct {
+	UserPrinter
+	app *App
+}
+
+func (tp *TranscriptPrinter) Print(format string, a ...interface{}) {
+	tp.UserPrinter.Print(format, a...)
+	tp.app.transcript.write(fmt.Sprintf(format, a...))
+}
+
+func (tp *TranscriptPrinter) PrintWarning(format string, a ...interface{}) {
+	tp.UserPrinter.PrintWarning(format, a...)
+	tp.app.transcript.write("Warning: " + fmt.Sprintf(format, a...))
+}
+
+func (tp *TranscriptPrinter) PrintError(format string, a ...interface{}) {
+	tp.UserPrinter.PrintError(format, a...)
+	tp.app.transcript.write("Error: " + fmt.Sprintf(format, a...))
+}
+
+func (app *App) startTranscript(path string) error {
+	transcript, err := openTranscript(path)
+	if err != nil {
+		return err
+	}
+	app.stopTranscript()
+	app.transcript = transcript
+	app.transcriptPath = path
+	return nil
+}
+
+func (app *App) stopTranscript() {
+	if app.transcript == nil {
+		return
+	}
+	app.transcript.Close()
+	app.transcript = nil
+}
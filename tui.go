@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const tuiInputHeight = 3
+
+type tuiOutputMsg string
+
+type tuiPromptMsg string
+
+type tuiDoneMsg struct{}
+
+type TUIPrinter struct {
+	send func(tea.Msg)
+}
+
+func (tp *TUIPrinter) Print(format string, a ...interface{}) {
+	tp.send(tuiOutputMsg(fmt.Sprintf(format, a...)))
+}
+
+func (tp *TUIPrinter) PrintWarning(format string, a ...interface{}) {
+	tp.send(tuiOutputMsg(theme.Warning.Sprint("Warning: ") + fmt.Sprintf(format, a...)))
+}
+
+func (tp *TUIPrinter) PrintError(format string, a ...interface{}) {
+	tp.send(tuiOutputMsg(theme.Error.Sprint("Error: ") + fmt.Sprintf(format, a...)))
+}
+
+type TUIReader struct {
+	send   func(tea.Msg)
+	prompt string
+	lines  chan string
+}
+
+func (tr *TUIReader) SetPrompt(prompt string) {
+	tr.prompt = prompt
+}
+
+func (tr *TUIReader) Readline() (string, error) {
+	tr.send(tuiPromptMsg(tr.prompt))
+	line, ok := <-tr.lines
+	if !ok {
+		return "", io.EOF
+	}
+	return line, nil
+}
+
+type TUIModel struct {
+	app      *App
+	reader   *TUIReader
+	viewport viewport.Model
+	input    textarea.Model
+	output   strings.Builder
+	status   string
+	busy     bool
+	prompt   string
+	waiting  bool
+	width    int
+}
+
+func newTUIModel(app *App, reader *TUIReader) *TUIModel {
+	input := textarea.New()
+	input.Placeholder = "Ask a question or enter a command (Alt+Enter inserts a new line)"
+	input.ShowLineNumbers = false
+	input.SetHeight(tuiInputHeight)
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+	m := &TUIModel{app: app, reader: reader, viewport: viewport.New(0, 0), input: input}
+	if len(app.context) > 0 {
+		m.output.WriteString(formatMessages(app.context, true, 0, false))
+	}
+	if !app.slashCommandsDisabled {
+		fmt.Fprintf(&m.output, "Enter \"%v\" for a list of commands.\n", theme.Command.Sprint("/help"))
+	}
+	m.updateStatus()
+	return m
+}
+
+func (m *TUIModel) updateStatus() {
+	m.status = " " + m.app.statusLine() + " "
+}
+
+func (m *TUIModel) refreshOutput() {
+	atBottom := m.viewport.AtBottom()
+	m.viewport.SetContent(lipgloss.NewStyle().Width(m.width).Render(m.output.String()))
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+func (m *TUIModel) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+func (m *TUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.viewport.Width = msg.Width
+		m.viewport.Height = max(msg.Height-tuiInputHeight-1, 1)
+		m.input.SetWidth(msg.Width)
+		m.refreshOutput()
+		m.viewport.GotoBottom()
+		return m, nil
+	case tuiOutputMsg:
+		m.output.WriteString(string(msg))
+		m.refreshOutput()
+		return m, nil
+	case tuiPromptMsg:
+		m.waiting = true
+		m.prompt = string(msg)
+		m.output.WriteString(m.prompt)
+		m.refreshOutput()
+		return m, nil
+	case tuiDoneMsg:
+		m.busy = false
+		m.updateStatus()
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyCtrlD:
+			return m, tea.Quit
+		case tea.KeyEnter:
+			if !msg.Alt {
+				return m, m.submit()
+			}
+		case tea.KeyPgUp, tea.KeyPgDown:
+			var cmd tea.Cmd
+			m.viewport, cmd = m.viewport.Update(msg)
+			return m, cmd
+		}
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *TUIModel) submit() tea.Cmd {
+	line := strings.TrimSpace(m.input.Value())
+	if m.waiting {
+		m.input.Reset()
+		m.waiting = false
+		m.output.WriteString(line + "\n")
+		m.refreshOutput()
+		m.reader.lines <- line
+		return nil
+	}
+	if m.busy || line == "" {
+		return nil
+	}
+	m.input.Reset()
+	if line == "/exit" || strings.HasPrefix(line, "/exit ") {
+		return tea.Quit
+	}
+	m.output.WriteString(theme.Prompt.Sprint("> ") + line + "\n")
+	m.refreshOutput()
+	m.viewport.GotoBottom()
+	m.busy = true
+	return func() tea.Msg {
+		m.app.executeLine(line)
+		return tuiDoneMsg{}
+	}
+}
+
+func (m *TUIModel) View() string {
+	status := m.status
+	if m.busy && !m.waiting {
+		status += "| working... "
+	}
+	bar := lipgloss.NewStyle().Reverse(true).Width(m.width).Render(status)
+	return m.viewport.View() + "\n" + bar + "\n" + m.input.View()
+}
+
+func (app *App) runTUI() error {
+	if !stdinIsTerminal() {
+		return fmt.Errorf("the TUI requires a terminal")
+	}
+	var program *tea.Program
+	send := func(msg tea.Msg) {
+		program.Send(msg)
+	}
+	app.checkLoadedContextModels()
+	reader := &TUIReader{send: send, lines: make(chan string, 1)}
+	previousPrinter := app.printer
+	app.printer = &TranscriptPrinter{UserPrinter: &TUIPrinter{send: send}, app: app}
+	app.reader = reader
+	app.pagerDisabled = true
+	app.wrapDisabled = true
+	defer func() {
+		app.printer = previousPrinter
+		app.reader = nil
+	}()
+	program = tea.NewProgram(newTUIModel(app, reader), tea.WithAltScreen(), tea.WithMouseCellMotion())
+	_, err := program.Run()
+	close(reader.lines)
+	return err
+}
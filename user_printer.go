@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/fatih/color"
 )
@@ -16,16 +17,32 @@ type UserPrinter interface {
 type ConsoleUserPrinter struct{}
 
 func (*ConsoleUserPrinter) Print(format string, a ...interface{}) {
-	fmt.Printf(format, a...)
+	fmt.Fprintf(color.Output, format, a...)
 	os.Stdout.Sync()
 }
 
 func (*ConsoleUserPrinter) PrintWarning(format string, a ...interface{}) {
-	fmt.Fprint(os.Stderr, color.YellowString("Warning: "), fmt.Sprintf(format, a...))
+	fmt.Fprint(color.Error, theme.Warning.Sprint("Warning: "), fmt.Sprintf(format, a...))
 	os.Stderr.Sync()
 }
 
 func (*ConsoleUserPrinter) PrintError(format string, a ...interface{}) {
-	fmt.Fprint(os.Stderr, color.RedString("Error: "), fmt.Sprintf(format, a...))
+	fmt.Fprint(color.Error, theme.Error.Sprint("Error: "), fmt.Sprintf(format, a...))
 	os.Stderr.Sync()
 }
+
+var colorModes = []string{"auto", "always", "never"}
+
+func configureColor(mode string) error {
+	switch mode {
+	case "auto":
+		color.NoColor = os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" || !stdoutIsTerminal()
+	case "always":
+		color.NoColor = false
+	case "never":
+		color.NoColor = true
+	default:
+		return fmt.Errorf("invalid value for -color: '%v'. Use one of: %v", mode, strings.Join(colorModes, ", "))
+	}
+	return nil
+}
@@ -2,89 +2,195 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
+	"unicode"
 
-	"github.com/fatih/color"
+	"github.com/Sa-RSt/gptrepl/session"
+	"github.com/chzyer/readline"
 )
 
+type ContextMetadata = session.Metadata
+
+type ContextParameters = session.Parameters
+
+const contextFileVersion = session.FileVersion
+
+type contextFileEnvelope = session.File
+
+var contextFileFormats = session.FileFormats
+
+func contextFileFormat(path string) string {
+	return session.FileFormat(path)
+}
+
 func parseContextFile(path string) ([]Message, error) {
+	messages, _, err := parseContextFileWithMetadata(path)
+	return messages, err
+}
+
+func parseContextFileWithMetadata(path string) ([]Message, ContextMetadata, error) {
+	file, err := session.ReadFile(path)
+	return file.Messages, file.Metadata, err
+}
+
+func writeContextFile(path string, context []Message) error {
+	return writeContextFileWithMetadata(path, context, ContextMetadata{})
+}
+
+func writeContextFileWithMetadata(path string, context []Message, metadata ContextMetadata) error {
+	return writeContextFileWithBackups(path, context, metadata, 0)
+}
+
+func writeContextFileWithBackups(path string, context []Message, metadata ContextMetadata, backups int) error {
+	return session.WriteFile(path, context, metadata, backups)
+}
+
+func parsePlainTextContextFile(path string) ([]Message, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	var unmarshaled []Message
-	err = json.Unmarshal(data, &unmarshaled)
+	messages, err := parseUncoloredPlainTextRepresentation(string(data))
 	if err != nil {
-		return nil, err
-	}
-	for idx, msg := range unmarshaled {
-		if !isRoleValid(msg.Role) {
-			return nil, fmt.Errorf("%v: message #%v (starting from zero) has an invalid \"role\" attribute", path, idx)
-		}
+		return nil, fmt.Errorf("%v: %w", path, err)
 	}
-	return unmarshaled, nil
+	return messages, nil
 }
 
-func writeContextFile(path string, context []Message) error {
-	marshaled, err := json.MarshalIndent(context, "", "\t")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(path, marshaled, 0660)
+func writePlainTextContextFile(path string, context []Message) error {
+	return os.WriteFile(path, []byte(plainTextRepresentation(context, false)), 0660)
 }
 
 func plainTextRepresentation(context []Message, useColor bool) string {
+	return formatMessages(context, useColor, 0, false)
+}
+
+func numberedPlainTextRepresentation(context []Message, useColor bool, firstNumber int) string {
+	return formatMessages(context, useColor, firstNumber, false)
+}
+
+func formatMessages(context []Message, useColor bool, firstNumber int, verbose bool) string {
 	var maybeBoldFgWhiteString func(string, ...interface{}) string
 	var maybeCyanString func(string, ...interface{}) string
+	var maybeFaintString func(string, ...interface{}) string
 
 	if useColor {
-		maybeBoldFgWhiteString = color.Set(color.Bold, color.FgWhite).Sprintf
-		maybeCyanString = color.CyanString
+		maybeBoldFgWhiteString = theme.Role.Sprintf
+		maybeCyanString = theme.RoleBrackets.Sprintf
+		maybeFaintString = theme.Dim.Sprintf
 	} else {
 		maybeBoldFgWhiteString = fmt.Sprintf
 		maybeCyanString = fmt.Sprintf
+		maybeFaintString = fmt.Sprintf
 	}
 	var result bytes.Buffer
-	for _, msg := range context {
-		result.WriteString(fmt.Sprintf("%v%v%v\n", maybeCyanString("["), maybeBoldFgWhiteString("%v", msg.Role), maybeCyanString("]")))
-		result.WriteString(fmt.Sprintf("%v\n\n", msg.Content))
+	for i, msg := range context {
+		if firstNumber > 0 {
+			result.WriteString(maybeFaintString("#%v ", firstNumber+i))
+		}
+		result.WriteString(fmt.Sprintf("%v%v%v", maybeCyanString("["), maybeBoldFgWhiteString("%v", msg.Role), maybeCyanString("]")))
+		if details := messageDetails(msg); verbose && details != "" {
+			result.WriteString(maybeFaintString(" %v", details))
+		}
+		result.WriteString("\n")
+		content := msg.Content
+		if !useColor {
+			content = escapePlainTextContent(content)
+		} else if msg.Role == "assistant" {
+			content = highlightCodeBlocks(content)
+		}
+		result.WriteString(fmt.Sprintf("%v\n\n", content))
 	}
 	return result.String()
 }
 
+func messageDetails(msg Message) string {
+	var details []string
+	if msg.Time != nil {
+		details = append(details, msg.Time.Local().Format(time.DateTime))
+	}
+	if msg.DurationMs > 0 {
+		details = append(details, fmt.Sprintf("took %v", (time.Duration(msg.DurationMs)*time.Millisecond).Round(100*time.Millisecond)))
+	}
+	if msg.InputTokens > 0 || msg.OutputTokens > 0 {
+		details = append(details, fmt.Sprintf("~%v input tokens, ~%v output tokens", msg.InputTokens, msg.OutputTokens))
+	}
+	return strings.Join(details, ", ")
+}
+
 func parseUncoloredPlainTextRepresentation(repr string) ([]Message, error) {
 	context := []Message{}
-	var currentMessageContent bytes.Buffer
+	var lines []string
 	currentRole := ""
 	for _, line := range strings.Split(repr, "\n") {
-		line = strings.TrimSpace(line)
-		if len(line) >= 3 && line[0] == '[' && line[len(line)-1] == ']' {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if isPlainTextHeader(trimmed) {
 			if currentRole != "" {
-				context = append(context, Message{Role: currentRole, Content: strings.TrimSpace(currentMessageContent.String())})
+				context = append(context, Message{Role: currentRole, Content: joinTrimmingBlankLines(lines)})
 			}
-			currentRole = line[1 : len(line)-1]
-			currentMessageContent.Reset()
-			if !isRoleValid(currentRole) {
+			currentRole = trimmed[1 : len(trimmed)-1]
+			lines = nil
+			if !session.IsRoleValid(currentRole) {
 				return nil, fmt.Errorf("invalid role: %v", currentRole)
 			}
-		} else if currentRole != "" && len(line) > 0 {
-			currentMessageContent.WriteString(line)
-			currentMessageContent.WriteString("\n")
-		} else if line != "" {
-			return nil, fmt.Errorf("expected a [role], found %v", line)
+		} else if currentRole != "" {
+			if isPlainTextHeader(strings.TrimLeft(trimmed, "\\")) && strings.HasPrefix(trimmed, "\\") {
+				line = strings.Replace(line, "\\", "", 1)
+			}
+			lines = append(lines, line)
+		} else if trimmed != "" {
+			return nil, fmt.Errorf("expected a [role], found %v", trimmed)
 		}
 	}
-	if currentMessageContent.Len() > 0 {
-		context = append(context, Message{Role: currentRole, Content: strings.TrimSpace(currentMessageContent.String())})
+	if currentRole != "" {
+		context = append(context, Message{Role: currentRole, Content: joinTrimmingBlankLines(lines)})
 	}
 	return context, nil
 }
 
-func isRoleValid(role string) bool {
-	return role == "user" || role == "assistant" || role == "system"
+func isPlainTextHeader(line string) bool {
+	if len(line) < 3 || line[0] != '[' || line[len(line)-1] != ']' {
+		return false
+	}
+	for _, c := range line[1 : len(line)-1] {
+		if !unicode.IsLetter(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func escapePlainTextContent(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if isPlainTextHeader(strings.TrimLeft(trimmed, "\\")) {
+			lines[i] = strings.Replace(line, trimmed, "\\"+trimmed, 1)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func joinTrimmingBlankLines(lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func stdinIsTerminal() bool {
+	return readline.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func stdoutIsTerminal() bool {
+	return readline.IsTerminal(int(os.Stdout.Fd()))
 }
 
 func textWrap(text string, maxLineLen int) []string {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var varNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var varReferencePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+var builtinVars = map[string]func() (string, error){
+	"date": func() (string, error) {
+		return time.Now().Format(time.DateOnly), nil
+	},
+	"time": func() (string, error) {
+		return time.Now().Format(time.TimeOnly), nil
+	},
+	"cwd": os.Getwd,
+	"clipboard": func() (string, error) {
+		text, err := readClipboard()
+		if err != nil {
+			return "", fmt.Errorf("failed to read the clipboard: %w", err)
+		}
+		return text, nil
+	},
+}
+
+func builtinVarNames() []string {
+	names := make([]string, 0, len(builtinVars))
+	for name := range builtinVars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (app *App) setVar(name string, value string) error {
+	if !varNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid variable name: '%v'. Use only letters, digits and underscores, not starting with a digit", name)
+	}
+	if _, ok := builtinVars[name]; ok {
+		return fmt.Errorf("{{%v}} is a built-in variable and can't be set", name)
+	}
+	if app.vars == nil {
+		app.vars = make(map[string]string)
+	}
+	app.vars[name] = value
+	return nil
+}
+
+func (app *App) expandVars(text string) (string, error) {
+	var err error
+	expanded := varReferencePattern.ReplaceAllStringFunc(text, func(reference string) string {
+		name := varReferencePattern.FindStringSubmatch(reference)[1]
+		if value, ok := app.vars[name]; ok {
+			return value
+		}
+		builtin, ok := builtinVars[name]
+		if !ok || err != nil || app.builtinVarsDisabled {
+			return reference
+		}
+		value, builtinErr := builtin()
+		if builtinErr != nil {
+			err = builtinErr
+			return reference
+		}
+		return value
+	})
+	return expanded, err
+}
+
+func (app *App) varNames() []string {
+	names := make([]string, 0, len(app.vars))
+	for name := range app.vars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type FileWatcher struct {
+	path    string
+	watcher *fsnotify.Watcher
+	changed atomic.Bool
+}
+
+func (app *App) startWatching() error {
+	if app.autosaveFilePath == "" {
+		return fmt.Errorf("-watch requires an autosave file (see -autosave)")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(app.autosaveFilePath)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	fileWatcher := &FileWatcher{path: app.autosaveFilePath, watcher: watcher}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == path && event.Has(fsnotify.Write|fsnotify.Create) {
+					fileWatcher.changed.Store(true)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	app.watcher = fileWatcher
+	return nil
+}
+
+func (app *App) applyExternalChanges() {
+	if app.watcher == nil || !app.watcher.changed.Swap(false) || app.watcher.path != app.autosaveFilePath || !app.autosaveChangedExternally() {
+		return
+	}
+	messages, metadata, err := parseContextFileWithMetadata(app.autosaveFilePath)
+	if err != nil {
+		app.printer.PrintWarning("\"%v\" was changed, but it couldn't be reloaded: %v\n", app.autosaveFilePath, err)
+		return
+	}
+	app.undoStack = append(app.undoStack, app.context)
+	app.redoStack = nil
+	app.context = messages
+	app.resumeJournal(metadata)
+	app.recordAutosaveFileInfo()
+	if !app.quiet {
+		app.printer.Print("Reloaded \"%v\", which was changed externally. The context now has %v messages.\n", app.autosaveFilePath, len(app.context))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const defaultHelpWidth = 50
+
+type SoftWrapper struct {
+	width  int
+	column int
+	word   strings.Builder
+	spaces string
+	line   strings.Builder
+	rows   []int
+	inCode bool
+}
+
+func newSoftWrapper(width int) *SoftWrapper {
+	return &SoftWrapper{width: width}
+}
+
+func (w *SoftWrapper) write(text string) string {
+	if w.width <= 0 {
+		return text
+	}
+	var out strings.Builder
+	for _, r := range text {
+		w.line.WriteRune(r)
+		switch {
+		case r == '\n':
+			w.finishWord(&out)
+			out.WriteRune(r)
+			w.endLine()
+		case w.inCode || strings.HasPrefix(strings.TrimLeft(w.line.String(), " \t"), "|"):
+			out.WriteString(w.spaces)
+			w.spaces = ""
+			out.WriteRune(r)
+			w.column++
+		case r == ' ' || r == '\t':
+			w.finishWord(&out)
+			w.spaces += string(r)
+		default:
+			w.word.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+func (w *SoftWrapper) flush() string {
+	var out strings.Builder
+	w.finishWord(&out)
+	out.WriteString(w.spaces)
+	w.endLine()
+	w.inCode = false
+	return out.String()
+}
+
+func (w *SoftWrapper) finishWord(out *strings.Builder) {
+	if w.word.Len() == 0 {
+		return
+	}
+	length := utf8.RuneCountInString(w.word.String())
+	if w.column > 0 && w.column+len(w.spaces)+length > w.width {
+		out.WriteString("\n")
+		w.rows = append(w.rows, w.column)
+		w.column = 0
+	} else {
+		out.WriteString(w.spaces)
+		w.column += len(w.spaces)
+	}
+	out.WriteString(w.word.String())
+	w.column += length
+	w.spaces = ""
+	w.word.Reset()
+}
+
+func (w *SoftWrapper) endLine() {
+	if strings.HasPrefix(strings.TrimSpace(w.line.String()), "```") {
+		w.inCode = !w.inCode
+	}
+	w.line.Reset()
+	w.rows = nil
+	w.column = 0
+	w.spaces = ""
+}
+
+func (w *SoftWrapper) resize(width int) string {
+	if w.width <= 0 || width <= 0 || width == w.width {
+		return ""
+	}
+	line := w.line.String()
+	if w.inCode || strings.HasPrefix(strings.TrimLeft(line, " \t"), "|") {
+		w.width = width
+		return ""
+	}
+	screenRows := 0
+	for _, length := range append(w.rows, w.column) {
+		screenRows += max((length+width-1)/width, 1)
+	}
+	word := w.word.String()
+	spaces := w.spaces
+	printed := line[:len(line)-len(spaces)-len(word)]
+	var out strings.Builder
+	out.WriteString("\r")
+	if screenRows > 1 {
+		fmt.Fprintf(&out, "\x1b[%vA", screenRows-1)
+	}
+	out.WriteString("\x1b[J")
+	w.width = width
+	w.line.Reset()
+	w.rows = nil
+	w.column = 0
+	w.spaces = ""
+	w.word.Reset()
+	out.WriteString(w.write(printed))
+	w.finishWord(&out)
+	w.spaces = spaces
+	w.word.WriteString(word)
+	w.line.WriteString(spaces + word)
+	return out.String()
+}
+
+func helpWidth() int {
+	width, _, ok := terminalSize()
+	if !ok {
+		return defaultHelpWidth
+	}
+	return max(width-2, 20)
+}